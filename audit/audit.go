@@ -0,0 +1,106 @@
+// Package audit บันทึก security event ลง collection audit_events
+//
+// แอปเขียน event ได้อย่างเดียว (store.AuditStore ไม่มี update หรือ delete) แต่ database ไม่ได้บังคับ
+// ใครที่มีสิทธิ์เขียน database ตรง ๆ ยังแก้หรือลบ event ได้ ถ้าต้องกันตรงนี้ให้แยก Mongo user ของแอป
+// ออกจากสิทธิ์ update/remove บน audit_events หรือส่ง export ไปเก็บที่อื่นเป็นระยะ
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"mychat-auth/models"
+	"mychat-auth/shared/contextkey"
+	"mychat-auth/shared/logger"
+	"mychat-auth/store"
+)
+
+// Recorder เติมข้อมูลจาก request ลงใน audit event แล้วส่งต่อให้ store
+type Recorder struct {
+	store   store.AuditStore
+	proxies []*net.IPNet
+}
+
+// NewRecorder รับ IP หรือ CIDR ของ reverse proxy ที่เชื่อ X-Forwarded-For ได้
+// ค่าที่ parse ไม่ได้จะถูกข้าม (config.Validate ตรวจรูปแบบไว้ก่อนแล้ว)
+func NewRecorder(s store.AuditStore, trustedProxies []string) *Recorder {
+	rec := &Recorder{store: s}
+	for _, p := range trustedProxies {
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+		if _, n, err := net.ParseCIDR(p); err == nil {
+			rec.proxies = append(rec.proxies, n)
+		}
+	}
+	return rec
+}
+
+// Record เติมข้อมูลจาก request (IP, user agent, request ID, เวลา) แล้วบันทึก event
+// ถ้าบันทึกไม่สำเร็จจะแค่ log ไว้ ไม่ทำให้ request หลักล้ม
+func (rec *Recorder) Record(r *http.Request, ev models.AuditEvent) {
+	ev.IP = rec.clientIP(r)
+	ev.UserAgent = r.UserAgent()
+	ev.RequestID, _ = r.Context().Value(contextkey.RequestID).(string)
+	ev.CreatedAt = time.Now().UTC()
+
+	// ไม่ผูกกับ context ของ request เพื่อให้ยังบันทึกได้แม้ client ตัดการเชื่อมต่อไปแล้ว
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 3*time.Second)
+	defer cancel()
+
+	if err := rec.store.Insert(ctx, ev); err != nil {
+		logger.FromContext(r.Context()).Error("❌ Failed to write audit event", "action", ev.Action, "error", err)
+	}
+}
+
+// clientIP คืน IP ของ client ที่เชื่อถือได้สำหรับ audit
+// เชื่อ X-Forwarded-For เฉพาะเมื่อ connection มาจาก proxy ที่ตั้งไว้ แล้วไล่จากขวาไปซ้าย
+// เอาตัวแรกที่ไม่ใช่ proxy ของเรา ค่าทางซ้ายกว่านั้น client ใส่มาเองได้จึงไม่ใช้
+func (rec *Recorder) clientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !rec.trusted(remote) {
+		return remote
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !rec.trusted(hops[i]) {
+			return hops[i]
+		}
+	}
+	// ทุก hop เป็น proxy ของเราเอง ตัวซ้ายสุดใกล้ client ที่สุด
+	if len(hops) > 0 {
+		return hops[0]
+	}
+	return remote
+}
+
+func (rec *Recorder) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range rec.proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
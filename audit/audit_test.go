@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	rec := NewRecorder(nil, []string{"10.0.0.0/8", "192.168.1.5", "not-an-ip"})
+
+	for _, tc := range []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"no proxy header", "203.0.113.7:5555", nil, "203.0.113.7"},
+		{"untrusted peer cannot spoof", "203.0.113.7:5555", []string{"1.2.3.4"}, "203.0.113.7"},
+		{"trusted peer", "10.1.2.3:443", []string{"198.51.100.9"}, "198.51.100.9"},
+		{"single trusted IP", "192.168.1.5:443", []string{"198.51.100.9"}, "198.51.100.9"},
+		// client ใส่ค่าซ้ายสุดเองได้ ต้องเอาตัวขวาสุดที่ไม่ใช่ proxy ของเรา
+		{"spoofed left-most hop", "10.1.2.3:443", []string{"1.2.3.4, 198.51.100.9, 10.9.9.9"}, "198.51.100.9"},
+		{"multiple headers", "10.1.2.3:443", []string{"1.2.3.4", "198.51.100.9"}, "198.51.100.9"},
+		{"all hops trusted", "10.1.2.3:443", []string{"10.0.0.1, 10.0.0.2"}, "10.0.0.1"},
+		{"trusted peer without header", "10.1.2.3:443", nil, "10.1.2.3"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.remote
+		for _, v := range tc.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := rec.clientIP(r); got != tc.want {
+			t.Errorf("%s: clientIP = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	rec := NewRecorder(nil, nil)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.1.2.3:443"
+	r.Header.Set("X-Forwarded-For", "198.51.100.9")
+	if got := rec.clientIP(r); got != "10.1.2.3" {
+		t.Fatalf("clientIP = %q, want the peer address when no proxy is trusted", got)
+	}
+}
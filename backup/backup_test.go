@@ -0,0 +1,257 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// writeTestArchive เขียน backup จากเอกสารที่ให้มาโดยไม่ต้องมี Mongo แล้วให้ edit แก้ manifest ก่อนเขียนได้
+func writeTestArchive(t *testing.T, docs map[string][]bson.D, edit func(*Manifest)) string {
+	t.Helper()
+	dir := t.TempDir()
+	m := &Manifest{FormatVersion: FormatVersion, ID: "test-backup", CreatedAt: time.Now().UTC(), Database: "mychat"}
+	temps := map[string]*os.File{}
+	for _, name := range collections {
+		var buf bytes.Buffer
+		for _, doc := range docs[name] {
+			line, err := bson.MarshalExtJSON(doc, true, false)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+		f, err := os.Create(filepath.Join(dir, name+".jsonl"))
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		t.Cleanup(func() { f.Close() })
+		f.Write(buf.Bytes())
+		temps[name] = f
+		sum := sha256.Sum256(buf.Bytes())
+		m.Files = append(m.Files, File{Name: fileName(name), Collection: name, Count: int64(len(docs[name])), SHA256: hex.EncodeToString(sum[:])})
+	}
+	if edit != nil {
+		edit(m)
+	}
+
+	path := filepath.Join(dir, "backup.tar.gz")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	defer out.Close()
+	if err := writeArchive(out, m, temps); err != nil {
+		t.Fatalf("writeArchive: %v", err)
+	}
+	return path
+}
+
+func sampleDocs() map[string][]bson.D {
+	userID, roomID := primitive.NewObjectID(), primitive.NewObjectID()
+	parentID := primitive.NewObjectID()
+	return map[string][]bson.D{
+		"users": {{{Key: "_id", Value: userID}, {Key: "email", Value: "alice@example.com"}, {Key: "password", Value: "hash"}}},
+		"rooms": {{{Key: "_id", Value: roomID}, {Key: "name", Value: "general"}, {Key: "type", Value: "public"}, {Key: "owner_id", Value: userID},
+			{Key: "members", Value: bson.A{bson.D{{Key: "_id", Value: userID}, {Key: "role", Value: "owner"}}}}}},
+		"messages": {
+			{{Key: "_id", Value: parentID}, {Key: "room_id", Value: roomID}, {Key: "sender_id", Value: userID}, {Key: "content", Value: "question"}, {Key: "created_at", Value: time.Now().UTC().Truncate(time.Millisecond)}},
+			{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "room_id", Value: roomID}, {Key: "sender_id", Value: userID}, {Key: "content", Value: "answer"}, {Key: "parent_id", Value: parentID}, {Key: "created_at", Value: time.Now().UTC().Truncate(time.Millisecond)}},
+		},
+	}
+}
+
+func TestVerify(t *testing.T) {
+	m, err := Verify(writeTestArchive(t, sampleDocs(), nil))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(m.Files) != 3 || m.Files[2].Count != 2 {
+		t.Fatalf("manifest = %+v, want three files with two messages", m.Files)
+	}
+}
+
+func TestVerifyChecksumMismatch(t *testing.T) {
+	for name, edit := range map[string]func(*Manifest){
+		"sha256": func(m *Manifest) { m.Files[1].SHA256 = hex.EncodeToString(make([]byte, 32)) },
+		"count":  func(m *Manifest) { m.Files[2].Count++ },
+	} {
+		if _, err := Verify(writeTestArchive(t, sampleDocs(), edit)); !errors.Is(err, ErrChecksum) {
+			t.Errorf("%s: Verify = %v, want ErrChecksum", name, err)
+		}
+	}
+}
+
+func TestVerifyFormat(t *testing.T) {
+	for name, edit := range map[string]func(*Manifest){
+		"newer format": func(m *Manifest) { m.FormatVersion = FormatVersion + 1 },
+		"out of order": func(m *Manifest) { m.Files[0], m.Files[1] = m.Files[1], m.Files[0] },
+		"unknown file": func(m *Manifest) { m.Files[2].Name = "other.jsonl" },
+	} {
+		if _, err := Verify(writeTestArchive(t, sampleDocs(), edit)); !errors.Is(err, ErrFormat) {
+			t.Errorf("%s: Verify = %v, want ErrFormat", name, err)
+		}
+	}
+
+	notArchive := filepath.Join(t.TempDir(), "plain.txt")
+	os.WriteFile(notArchive, []byte("hello"), 0o600)
+	if _, err := Verify(notArchive); !errors.Is(err, ErrFormat) {
+		t.Errorf("plain file: Verify = %v, want ErrFormat", err)
+	}
+}
+
+func TestMapperRemap(t *testing.T) {
+	old := primitive.NewObjectID()
+
+	if id := (&mapper{seed: "a", merged: map[primitive.ObjectID]primitive.ObjectID{}}).id(old); id != old {
+		t.Fatalf("without remap id = %s, want the original %s", id.Hex(), old.Hex())
+	}
+
+	// backup เดิม restore ซ้ำได้ ID เดิม
+	a1 := (&mapper{seed: "backup-a", remap: true, merged: map[primitive.ObjectID]primitive.ObjectID{}}).id(old)
+	a2 := (&mapper{seed: "backup-a", remap: true, merged: map[primitive.ObjectID]primitive.ObjectID{}}).id(old)
+	b := (&mapper{seed: "backup-b", remap: true, merged: map[primitive.ObjectID]primitive.ObjectID{}}).id(old)
+	if a1 != a2 {
+		t.Fatalf("remap is not deterministic: %s vs %s", a1.Hex(), a2.Hex())
+	}
+	if a1 == old || a1 == b {
+		t.Fatalf("remap gave %s (old %s, other backup %s), want an ID unique to the backup", a1.Hex(), old.Hex(), b.Hex())
+	}
+	if !a1.Timestamp().Equal(old.Timestamp()) {
+		t.Fatalf("remap changed the timestamp from %v to %v", old.Timestamp(), a1.Timestamp())
+	}
+
+	// เอกสารที่ merge แล้วชี้ไปที่ของเดิมเสมอ
+	existing := primitive.NewObjectID()
+	mp := &mapper{seed: "backup-a", remap: true, merged: map[primitive.ObjectID]primitive.ObjectID{old: existing}}
+	if id := mp.remapValue(old); id != existing {
+		t.Fatalf("merged id = %v, want %s", id, existing.Hex())
+	}
+	if v := mp.remapValue("not an id"); v != "not an id" {
+		t.Fatalf("remapValue changed a non-ID value to %v", v)
+	}
+}
+
+// testDB คืน database ใหม่บน Mongo จริงเมื่อตั้ง MONGO_TEST_URI ไว้ ลบทิ้งเมื่อ test จบ
+func testDB(t *testing.T) *mongo.Database {
+	t.Helper()
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	db := client.Database("mychat_backup_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		_ = db.Drop(context.Background())
+		_ = client.Disconnect(context.Background())
+	})
+	return db
+}
+
+func countDocs(t *testing.T, db *mongo.Database, name string) int64 {
+	t.Helper()
+	n, err := db.Collection(name).CountDocuments(context.Background(), bson.M{})
+	if err != nil {
+		t.Fatalf("count %s: %v", name, err)
+	}
+	return n
+}
+
+func TestExportRestoreRoundTrip(t *testing.T) {
+	src := testDB(t)
+	ctx := context.Background()
+	for name, docs := range sampleDocs() {
+		for _, doc := range docs {
+			if _, err := src.Collection(name).InsertOne(ctx, doc); err != nil {
+				t.Fatalf("seed %s: %v", name, err)
+			}
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "backup.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := Export(ctx, src, f, ExportOptions{}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	f.Close()
+	if _, err := Verify(path); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	dst := testDB(t)
+	for i := 0; i < 2; i++ {
+		// restore ซ้ำต้องได้ผลเหมือนเดิม ไม่เพิ่มเอกสาร
+		if _, _, err := Restore(ctx, dst, path, RestoreOptions{Remap: true}); err != nil {
+			t.Fatalf("Restore #%d: %v", i+1, err)
+		}
+		for _, name := range collections {
+			if got, want := countDocs(t, dst, name), countDocs(t, src, name); got != want {
+				t.Fatalf("after restore #%d %s has %d documents, want %d", i+1, name, got, want)
+			}
+		}
+	}
+
+	// ห้องชื่อซ้ำที่เป็นคนละห้องต้องรายงานเป็น conflict ไม่ merge เงียบ ๆ
+	if _, _, err := Restore(ctx, dst, path, RestoreOptions{}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Restore over a same-name room = %v, want ErrConflict", err)
+	}
+	_, results, err := Restore(ctx, dst, path, RestoreOptions{MergeRooms: true})
+	if err != nil {
+		t.Fatalf("Restore with MergeRooms: %v", err)
+	}
+	if countDocs(t, dst, "rooms") != 1 {
+		t.Fatal("MergeRooms created a second room with the same name")
+	}
+	for _, res := range results {
+		if res.Collection == "rooms" && res.Merged != 1 {
+			t.Fatalf("rooms result = %+v, want one merged room", res)
+		}
+	}
+}
+
+func TestExportTimeRangeIncludesThreadParents(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	docs := sampleDocs()
+	// ต้นเรื่องอยู่นอกช่วง reply อยู่ในช่วง
+	old := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Millisecond)
+	docs["messages"][0][4].Value = old
+	for name, list := range docs {
+		for _, doc := range list {
+			if _, err := db.Collection(name).InsertOne(ctx, doc); err != nil {
+				t.Fatalf("seed %s: %v", name, err)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	m, err := Export(ctx, db, &buf, ExportOptions{From: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	for _, f := range m.Files {
+		if f.Collection == "messages" && f.Count != 2 {
+			t.Fatalf("exported %d messages, want the reply and its parent", f.Count)
+		}
+	}
+}
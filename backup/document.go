@@ -0,0 +1,49 @@
+package backup
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func sortByID() *options.FindOptions {
+	return options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+}
+
+func splitPath(path string) []string {
+	return strings.Split(path, ".")
+}
+
+// walkPath เรียก fn กับค่าทุกตัวที่ path ชี้ถึงใน doc แล้วแทนค่าด้วยผลของ fn
+// ถ้าระหว่างทางเจอ array จะเดินเข้าไปทุกสมาชิก
+func walkPath(v interface{}, path []string, fn func(interface{}) interface{}) interface{} {
+	if len(path) == 0 {
+		return fn(v)
+	}
+	switch node := v.(type) {
+	case bson.D:
+		for i := range node {
+			if node[i].Key == path[0] {
+				node[i].Value = walkPath(node[i].Value, path[1:], fn)
+			}
+		}
+		return node
+	case bson.A:
+		for i := range node {
+			node[i] = walkPath(node[i], path, fn)
+		}
+		return node
+	}
+	return v
+}
+
+// field คืนค่าของ key ชั้นบนสุดใน doc
+func field(doc bson.D, key string) interface{} {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
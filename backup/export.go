@@ -0,0 +1,247 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"mychat-auth/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ExportOptions กรองข้อมูลที่ export ทุกช่องเป็น optional
+// RoomIDs จำกัดห้องและข้อความ ส่วน From/To จำกัดเฉพาะข้อความตาม created_at ([From, To))
+// ห้องและ user ไม่ถูกกรองตามเวลา ทุกห้องที่ตรง RoomIDs (หรือทุกห้องถ้าไม่ระบุ) ยังอยู่ในไฟล์แม้ไม่มีข้อความในช่วงนั้น
+// reply ในช่วงเวลาจะดึงข้อความต้นเรื่องมาด้วยแม้อยู่นอกช่วง เพื่อไม่ให้ parent_id ชี้ไปที่ข้อความที่ไม่มี
+// ถ้ากรองตามห้อง จะ export เฉพาะ user ที่เป็นสมาชิก เจ้าของ หรือผู้ส่งข้อความในห้องเหล่านั้น
+type ExportOptions struct {
+	RoomIDs []primitive.ObjectID
+	From    time.Time
+	To      time.Time
+}
+
+// Export เขียน backup แบบ .tar.gz ลง w แล้วคืน manifest ที่เขียนไป
+// แต่ละ collection ถูกเขียนลงไฟล์ชั่วคราวก่อน เพราะ tar ต้องรู้ขนาดไฟล์ล่วงหน้า
+func Export(ctx context.Context, db *mongo.Database, w io.Writer, opts ExportOptions) (*Manifest, error) {
+	m := &Manifest{
+		FormatVersion: FormatVersion,
+		ID:            utils.RandomID(),
+		CreatedAt:     time.Now().UTC(),
+		Database:      db.Name(),
+	}
+	for _, id := range opts.RoomIDs {
+		m.Filter.RoomIDs = append(m.Filter.RoomIDs, id.Hex())
+	}
+	if !opts.From.IsZero() {
+		from := opts.From.UTC()
+		m.Filter.From = &from
+	}
+	if !opts.To.IsZero() {
+		to := opts.To.UTC()
+		m.Filter.To = &to
+	}
+
+	roomFilter, messageFilter := bson.M{}, bson.M{}
+	if len(opts.RoomIDs) > 0 {
+		roomFilter["_id"] = bson.M{"$in": opts.RoomIDs}
+		messageFilter["room_id"] = bson.M{"$in": opts.RoomIDs}
+	}
+	if created := timeRange(opts.From, opts.To); created != nil {
+		inRange := bson.M{"created_at": created}
+		for k, v := range messageFilter {
+			inRange[k] = v
+		}
+		parents, err := db.Collection("messages").Distinct(ctx, "parent_id", bson.M{"$and": bson.A{inRange, bson.M{"parent_id": bson.M{"$ne": nil}}}})
+		if err != nil {
+			return nil, fmt.Errorf("export messages: %w", err)
+		}
+		if len(parents) > 0 {
+			messageFilter = bson.M{"$or": bson.A{inRange, bson.M{"_id": bson.M{"$in": parents}}}}
+		} else {
+			messageFilter = inRange
+		}
+	}
+
+	// เก็บ user ที่ห้องและข้อความอ้างถึง ใช้กรอง users ตอน export ตามห้อง
+	userIDs := map[primitive.ObjectID]struct{}{}
+	collect := func(raw bson.Raw, path string) {
+		for _, id := range lookupIDs(raw, path) {
+			userIDs[id] = struct{}{}
+		}
+	}
+
+	temps := map[string]*os.File{}
+	defer func() {
+		for _, f := range temps {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	dump := func(name string, filter bson.M, each func(bson.Raw)) error {
+		f, err := os.CreateTemp("", "mychat-backup-"+name+"-*.jsonl")
+		if err != nil {
+			return err
+		}
+		temps[name] = f
+		file, err := dumpCollection(ctx, db.Collection(name), filter, f, each)
+		if err != nil {
+			return fmt.Errorf("export %s: %w", name, err)
+		}
+		m.Files = append(m.Files, file)
+		return nil
+	}
+
+	if err := dump("rooms", roomFilter, func(raw bson.Raw) {
+		collect(raw, "owner_id")
+		collect(raw, "members._id")
+	}); err != nil {
+		return nil, err
+	}
+	if err := dump("messages", messageFilter, func(raw bson.Raw) {
+		collect(raw, "sender_id")
+		collect(raw, "deleted_by")
+	}); err != nil {
+		return nil, err
+	}
+	userFilter := bson.M{}
+	if len(opts.RoomIDs) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(userIDs))
+		for id := range userIDs {
+			ids = append(ids, id)
+		}
+		userFilter["_id"] = bson.M{"$in": ids}
+	}
+	if err := dump("users", userFilter, nil); err != nil {
+		return nil, err
+	}
+
+	// เรียง Files ตามลำดับ restore ให้ตรงกับลำดับไฟล์ใน tar
+	ordered := make([]File, 0, len(m.Files))
+	for _, name := range collections {
+		for _, f := range m.Files {
+			if f.Collection == name {
+				ordered = append(ordered, f)
+			}
+		}
+	}
+	m.Files = ordered
+
+	if err := writeArchive(w, m, temps); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// dumpCollection เขียนเอกสารที่ตรง filter เป็น Extended JSON บรรทัดละตัว เรียงตาม _id
+func dumpCollection(ctx context.Context, coll *mongo.Collection, filter bson.M, out io.Writer, each func(bson.Raw)) (File, error) {
+	file := File{Name: fileName(coll.Name()), Collection: coll.Name()}
+
+	cursor, err := coll.Find(ctx, filter, sortByID())
+	if err != nil {
+		return file, err
+	}
+	defer cursor.Close(ctx)
+
+	hash := sha256.New()
+	bw := bufio.NewWriter(io.MultiWriter(out, hash))
+	for cursor.Next(ctx) {
+		line, err := bson.MarshalExtJSON(cursor.Current, true, false)
+		if err != nil {
+			return file, err
+		}
+		bw.Write(line)
+		bw.WriteByte('\n')
+		file.Count++
+		if each != nil {
+			each(cursor.Current)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return file, err
+	}
+	if err := bw.Flush(); err != nil {
+		return file, err
+	}
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return file, nil
+}
+
+// writeArchive เขียน manifest ตามด้วยไฟล์ของแต่ละ collection ลง tar.gz
+func writeArchive(w io.Writer, m *Manifest, temps map[string]*os.File) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0o600, Size: int64(len(manifest)), ModTime: m.CreatedAt}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+
+	for _, file := range m.Files {
+		f := temps[file.Collection]
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: file.Name, Mode: 0o600, Size: info.Size(), ModTime: m.CreatedAt}); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, f); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func timeRange(from, to time.Time) bson.M {
+	if from.IsZero() && to.IsZero() {
+		return nil
+	}
+	r := bson.M{}
+	if !from.IsZero() {
+		r["$gte"] = from
+	}
+	if !to.IsZero() {
+		r["$lt"] = to
+	}
+	return r
+}
+
+// lookupIDs คืน ObjectID ทุกตัวที่ path ชี้ถึง (เข้าไปใน array ให้เอง)
+func lookupIDs(raw bson.Raw, path string) []primitive.ObjectID {
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil
+	}
+	var ids []primitive.ObjectID
+	walkPath(doc, splitPath(path), func(v interface{}) interface{} {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+		return v
+	})
+	return ids
+}
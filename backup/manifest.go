@@ -0,0 +1,64 @@
+// Package backup export และ restore ข้อมูลแชต (users, rooms, messages) เป็นไฟล์ .tar.gz
+//
+// ในไฟล์มี manifest.json ตามด้วยไฟล์ JSON Lines หนึ่งไฟล์ต่อ collection ตามลำดับ users, rooms, messages
+// แต่ละบรรทัดคือเอกสารหนึ่งตัวในรูป MongoDB Extended JSON (canonical) จึงเก็บชนิดข้อมูล
+// เช่น ObjectID และวันที่ได้ครบ manifest เก็บจำนวนเอกสารและ sha256 ของแต่ละไฟล์ไว้ตรวจก่อน restore
+package backup
+
+import (
+	"errors"
+	"time"
+)
+
+// FormatVersion คือเวอร์ชันของรูปแบบไฟล์ เพิ่มเมื่อเปลี่ยนโครงสร้างจนของเก่าอ่านไม่ได้
+const FormatVersion = 1
+
+const manifestName = "manifest.json"
+
+// collections เรียงตามลำดับที่ต้อง restore (ห้องอ้าง user, ข้อความอ้างห้องและ user)
+var collections = []string{"users", "rooms", "messages"}
+
+// refs คือ field ที่อ้างถึง _id ของเอกสารอื่น ต้องแปลงตามเมื่อ ID ถูก remap
+// path ที่ผ่าน array (เช่น members._id) จะแปลงทุกสมาชิกใน array
+var refs = map[string][]string{
+	"rooms":    {"owner_id", "members._id"},
+	"messages": {"room_id", "sender_id", "deleted_by", "parent_id"},
+}
+
+var (
+	// ErrChecksum คือไฟล์ในที่เก็บไม่ตรงกับ manifest (เสียหายหรือถูกแก้)
+	ErrChecksum = errors.New("backup: checksum mismatch")
+	// ErrFormat คือไฟล์ไม่ใช่ backup ที่อ่านได้ หรือเป็นเวอร์ชันที่ใหม่กว่าที่รู้จัก
+	ErrFormat = errors.New("backup: unsupported archive")
+	// ErrConflict คือห้องใน backup มีชื่อซ้ำกับห้องอื่นที่มีอยู่แล้วในปลายทาง และไม่ได้สั่งให้ merge
+	ErrConflict = errors.New("backup: conflicts with existing data")
+)
+
+// Manifest อธิบายเนื้อหาของ backup หนึ่งไฟล์
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	ID            string    `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Database      string    `json:"database"`
+	Filter        Filter    `json:"filter"`
+	Files         []File    `json:"files"`
+}
+
+// Filter คือเงื่อนไขที่ใช้ตอน export ช่องว่างหมายถึงไม่กรอง
+type Filter struct {
+	RoomIDs []string   `json:"room_ids,omitempty"`
+	From    *time.Time `json:"from,omitempty"`
+	To      *time.Time `json:"to,omitempty"`
+}
+
+// File คือไฟล์ JSON Lines ของ collection หนึ่งตัว SHA256 คิดจากเนื้อหาที่ยังไม่บีบอัด
+type File struct {
+	Name       string `json:"name"`
+	Collection string `json:"collection"`
+	Count      int64  `json:"count"`
+	SHA256     string `json:"sha256"`
+}
+
+func fileName(collection string) string {
+	return collection + ".jsonl"
+}
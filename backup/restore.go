@@ -0,0 +1,386 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	restoreBatchSize = 500
+	maxLineSize      = 16 << 20
+)
+
+// uniqueKeys คือ field ที่ต้องไม่ซ้ำใน collection ถ้าปลายทางมีเอกสารที่ค่านี้ตรงกันแต่ _id ต่างกัน
+// จะถือว่าเป็นตัวเดียวกัน (merge) แล้วชี้ทุก reference ไปที่เอกสารเดิมแทนการเขียนทับ
+// user ที่อีเมลตรงกันคือคนเดียวกันเสมอ แต่ห้องชื่อซ้ำอาจเป็นคนละห้องกัน จึง merge เฉพาะเมื่อสั่ง MergeRooms
+var uniqueKeys = map[string]string{
+	"users": "email",
+	"rooms": "name",
+}
+
+// RestoreOptions กำหนดวิธี restore
+type RestoreOptions struct {
+	// Remap ให้ ObjectID ใหม่กับทุกเอกสารแล้วแปลง reference ตาม ใช้ย้ายข้อมูลเข้า environment ที่มีข้อมูลอยู่แล้ว
+	// ID ใหม่คำนวณจาก ID ของ backup และ ID เดิม จึง restore ไฟล์เดิมซ้ำได้ผลเหมือนเดิม
+	Remap bool
+	// MergeRooms รวมห้องใน backup เข้ากับห้องชื่อเดียวกันที่มีอยู่แล้ว (สมาชิกและข้อความย้ายไปห้องเดิม)
+	// ถ้าไม่ตั้ง ห้องชื่อซ้ำทำให้ Restore คืน ErrConflict ก่อนเขียนอะไรลง db
+	MergeRooms bool
+}
+
+// Result สรุปผลของแต่ละ collection
+type Result struct {
+	Collection string
+	Written    int64 // เขียนหรือเขียนทับตาม _id
+	Merged     int64 // ตรงกับเอกสารที่มีอยู่แล้วตาม uniqueKeys จึงไม่ได้เขียน
+}
+
+// Verify อ่าน backup ทั้งไฟล์เพื่อตรวจ manifest จำนวนเอกสาร และ checksum โดยไม่แตะ database
+func Verify(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var m *Manifest
+	next := 0
+	err = readArchive(f, func(hdr *tar.Header, r io.Reader) error {
+		if m == nil {
+			if hdr.Name != manifestName {
+				return fmt.Errorf("%w: first entry is %q, want %s", ErrFormat, hdr.Name, manifestName)
+			}
+			m = &Manifest{}
+			if err := json.NewDecoder(r).Decode(m); err != nil {
+				return fmt.Errorf("%w: manifest: %v", ErrFormat, err)
+			}
+			if m.FormatVersion < 1 || m.FormatVersion > FormatVersion {
+				return fmt.Errorf("%w: format version %d (this build reads up to %d)", ErrFormat, m.FormatVersion, FormatVersion)
+			}
+			return nil
+		}
+		if next >= len(m.Files) || m.Files[next].Name != hdr.Name {
+			return fmt.Errorf("%w: unexpected entry %q", ErrFormat, hdr.Name)
+		}
+		want := m.Files[next]
+		next++
+
+		hash := sha256.New()
+		count, err := countLines(io.TeeReader(r, hash))
+		if err != nil {
+			return err
+		}
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != want.SHA256 || count != want.Count {
+			return fmt.Errorf("%w: %s has %d documents (sha256 %s), manifest says %d (sha256 %s)",
+				ErrChecksum, want.Name, count, sum, want.Count, want.SHA256)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, fmt.Errorf("%w: empty archive", ErrFormat)
+	}
+	if next != len(m.Files) {
+		return nil, fmt.Errorf("%w: %s is missing", ErrFormat, m.Files[next].Name)
+	}
+	if err := checkOrder(m.Files); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Restore ตรวจไฟล์ด้วย Verify ก่อน แล้วเขียนเอกสารลง db ด้วย upsert ตาม _id
+// ถ้าไม่ได้ตั้ง MergeRooms จะตรวจห้องชื่อซ้ำก่อน เจอแล้วคืน ErrConflict โดยไม่เขียนอะไร
+// รันซ้ำกับไฟล์เดิมได้ผลเหมือนเดิม เอกสารที่ _id ตรงกันจะถูกเขียนทับด้วยค่าใน backup
+func Restore(ctx context.Context, db *mongo.Database, path string, opts RestoreOptions) (*Manifest, []Result, error) {
+	m, err := Verify(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	mp := &mapper{seed: m.ID, remap: opts.Remap, merged: map[primitive.ObjectID]primitive.ObjectID{}}
+	if !opts.MergeRooms {
+		names, err := roomConflicts(ctx, db.Collection("rooms"), f, mp)
+		if err != nil {
+			return m, nil, err
+		}
+		if len(names) > 0 {
+			return m, nil, fmt.Errorf("%w: rooms %s already exist in the target as different rooms", ErrConflict, strings.Join(names, ", "))
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return m, nil, err
+		}
+	}
+
+	var results []Result
+	err = readArchive(f, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name == manifestName {
+			return nil
+		}
+		for _, file := range m.Files {
+			if file.Name == hdr.Name {
+				res, err := restoreCollection(ctx, db.Collection(file.Collection), r, mp, opts)
+				if err != nil {
+					return fmt.Errorf("restore %s: %w", file.Collection, err)
+				}
+				results = append(results, res)
+			}
+		}
+		return nil
+	})
+	return m, results, err
+}
+
+func restoreCollection(ctx context.Context, coll *mongo.Collection, r io.Reader, mp *mapper, opts RestoreOptions) (Result, error) {
+	res := Result{Collection: coll.Name()}
+	uniqueKey := uniqueKeys[coll.Name()]
+
+	var batch []mongo.WriteModel
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := coll.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		batch = batch[:0]
+		return err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &doc); err != nil {
+			return res, err
+		}
+		oldID, ok := field(doc, "_id").(primitive.ObjectID)
+		if !ok {
+			return res, errors.New("document without ObjectID _id")
+		}
+		newID := mp.id(oldID)
+
+		if uniqueKey != "" {
+			existing, found, err := findIDBy(ctx, coll, uniqueKey, field(doc, uniqueKey))
+			if err != nil {
+				return res, err
+			}
+			if found && existing != newID {
+				// ห้องที่เพิ่งถูกสร้างหลังตรวจ roomConflicts ก็ต้องไม่ถูก merge เงียบ ๆ
+				if coll.Name() == "rooms" && !opts.MergeRooms {
+					return res, fmt.Errorf("%w: room %q already exists", ErrConflict, field(doc, uniqueKey))
+				}
+				mp.merged[oldID] = existing
+				res.Merged++
+				if coll.Name() == "rooms" {
+					if err := mergeMembers(ctx, coll, existing, doc, mp); err != nil {
+						return res, err
+					}
+				}
+				continue
+			}
+		}
+
+		walkPath(doc, []string{"_id"}, func(interface{}) interface{} { return newID })
+		for _, path := range refs[coll.Name()] {
+			walkPath(doc, splitPath(path), mp.remapValue)
+		}
+		batch = append(batch, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": newID}).
+			SetReplacement(doc).
+			SetUpsert(true))
+		res.Written++
+		if len(batch) >= restoreBatchSize {
+			if err := flush(); err != nil {
+				return res, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return res, err
+	}
+	return res, flush()
+}
+
+// mergeMembers เพิ่มสมาชิกจากห้องใน backup เข้าห้องที่มีชื่อเดียวกันอยู่แล้ว คนที่อยู่แล้วไม่ถูกแตะ
+// ถ้าห้องเดิมยังไม่มีเจ้าของ คนที่เป็น owner ใน backup จะเข้ามาเป็น moderator แทน
+func mergeMembers(ctx context.Context, coll *mongo.Collection, roomID primitive.ObjectID, doc bson.D, mp *mapper) error {
+	members, _ := field(doc, "members").(bson.A)
+	for _, item := range members {
+		member, ok := item.(bson.D)
+		if !ok {
+			continue
+		}
+		walkPath(member, []string{"_id"}, mp.remapValue)
+		walkPath(member, []string{"role"}, func(v interface{}) interface{} {
+			if v == "owner" {
+				return "moderator"
+			}
+			return v
+		})
+		filter := bson.M{"_id": roomID, "members._id": bson.M{"$ne": field(member, "_id")}}
+		if _, err := coll.UpdateOne(ctx, filter, bson.M{"$push": bson.M{"members": member}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// roomConflicts คืนชื่อห้องใน backup ที่ปลายทางมีห้องชื่อนี้อยู่แล้วแต่ _id ไม่ตรงกับที่จะเขียน
+func roomConflicts(ctx context.Context, coll *mongo.Collection, r io.Reader, mp *mapper) ([]string, error) {
+	var names []string
+	err := readArchive(r, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name != fileName("rooms") {
+			return nil
+		}
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+		for scanner.Scan() {
+			var doc bson.D
+			if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &doc); err != nil {
+				return err
+			}
+			oldID, ok := field(doc, "_id").(primitive.ObjectID)
+			if !ok {
+				return errors.New("document without ObjectID _id")
+			}
+			name := field(doc, "name")
+			existing, found, err := findIDBy(ctx, coll, "name", name)
+			if err != nil {
+				return err
+			}
+			if found && existing != mp.id(oldID) {
+				names = append(names, fmt.Sprintf("%q", name))
+			}
+		}
+		return scanner.Err()
+	})
+	return names, err
+}
+
+func findIDBy(ctx context.Context, coll *mongo.Collection, key string, value interface{}) (primitive.ObjectID, bool, error) {
+	if value == nil {
+		return primitive.NilObjectID, false, nil
+	}
+	var found struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	err := coll.FindOne(ctx, bson.M{key: value}, options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&found)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return primitive.NilObjectID, false, nil
+	}
+	return found.ID, err == nil, err
+}
+
+// mapper ตัดสิน ID ปลายทางของเอกสารแต่ละตัว
+type mapper struct {
+	seed   string
+	remap  bool
+	merged map[primitive.ObjectID]primitive.ObjectID
+}
+
+func (mp *mapper) id(old primitive.ObjectID) primitive.ObjectID {
+	if id, ok := mp.merged[old]; ok {
+		return id
+	}
+	if !mp.remap {
+		return old
+	}
+	h := sha256.Sum256(append([]byte(mp.seed), old[:]...))
+	var id primitive.ObjectID
+	// คง 4 byte แรก (เวลาที่สร้าง) ไว้ ให้เรียงตาม _id ได้เหมือนต้นทาง
+	copy(id[:4], old[:4])
+	copy(id[4:], h[:8])
+	return id
+}
+
+func (mp *mapper) remapValue(v interface{}) interface{} {
+	if old, ok := v.(primitive.ObjectID); ok {
+		return mp.id(old)
+	}
+	return v
+}
+
+// readArchive เปิด tar.gz แล้วเรียก fn กับไฟล์ทีละตัวตามลำดับในที่เก็บ
+func readArchive(r io.Reader, fn func(hdr *tar.Header, r io.Reader) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// checkOrder ตรวจว่าไฟล์เรียงตามลำดับที่ restore ได้ (users ก่อน rooms ก่อน messages)
+func checkOrder(files []File) error {
+	last := -1
+	for _, f := range files {
+		idx := -1
+		for i, name := range collections {
+			if name == f.Collection {
+				idx = i
+			}
+		}
+		if idx < 0 || f.Name != fileName(f.Collection) {
+			return fmt.Errorf("%w: unknown file %q", ErrFormat, f.Name)
+		}
+		if idx <= last {
+			return fmt.Errorf("%w: %s is out of order", ErrFormat, f.Name)
+		}
+		last = idx
+	}
+	return nil
+}
+
+func countLines(r io.Reader) (int64, error) {
+	var n int64
+	buf := make([]byte, 32*1024)
+	for {
+		c, err := r.Read(buf)
+		n += int64(bytes.Count(buf[:c], []byte{'\n'}))
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"mychat-auth/config"
+	"mychat-auth/database"
+	"mychat-auth/models"
+	"mychat-auth/shared/logger"
+	"mychat-auth/store"
+	"mychat-auth/utils"
+)
+
+// cliTimeout คือเวลาสูงสุดของคำสั่ง admin หนึ่งครั้ง (ไม่รวม migrate ที่อาจนานกว่า)
+const cliTimeout = time.Minute
+
+// cliEnv คือ dependency ที่คำสั่ง admin ใช้ร่วมกัน สร้างด้วย openCLI
+type cliEnv struct {
+	cfg    *config.Config
+	stores store.Stores
+	jwt    *utils.JWTManager
+}
+
+// newFlagSet สร้าง FlagSet ของคำสั่งย่อย พร้อม -config ที่ทุกคำสั่งรับเหมือนกัน
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("mychat-auth "+name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to YAML or TOML config file")
+	return fs, configFile
+}
+
+// openCLI โหลด config แล้วเชื่อม Mongo (และ Redis ถ้า withRedis) คืน cleanup ที่ผู้เรียกต้อง defer
+// log ออก stderr แบบ text เพื่อให้ stdout เหลือแต่ผลลัพธ์ของคำสั่ง
+func openCLI(configFile string, withRedis bool) (*cliEnv, func(), error) {
+	var args []string
+	if configFile != "" {
+		args = []string{"-config", configFile}
+	}
+	cfg, err := config.Load(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.Init(logger.Options{
+		Level:     cfg.Log.Level,
+		Format:    "text",
+		PIIFields: cfg.Log.RedactFields,
+		Output:    os.Stderr,
+	})
+
+	if err := database.InitMongo(context.Background(), cfg.Mongo.URI, cfg.Mongo.Database); err != nil {
+		return nil, nil, fmt.Errorf("connect mongo: %w", err)
+	}
+	env := &cliEnv{
+		cfg:    cfg,
+		stores: store.NewMongo(database.DB),
+		jwt:    utils.NewJWTManager(cfg.JWT.Secret, cfg.JWT.AccessTTL, cfg.JWT.RefreshTTL),
+	}
+	cleanup := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		database.Disconnect(ctx)
+		utils.CloseRedis()
+	}
+
+	if withRedis {
+		if err := utils.InitRedis(context.Background(), cfg.Redis.Addr); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("connect redis: %w", err)
+		}
+		env.stores.Sessions = store.NewRedisSessionStore(utils.RedisClient)
+	}
+	return env, cleanup, nil
+}
+
+// audit บันทึกการกระทำจาก CLI ลง audit log เดียวกับ HTTP โดยระบุ source เป็น cli และ user ของ OS
+func (env *cliEnv) audit(ctx context.Context, ev models.AuditEvent) {
+	if ev.Metadata == nil {
+		ev.Metadata = map[string]string{}
+	}
+	ev.Metadata["source"] = "cli"
+	if u := os.Getenv("USER"); u != "" {
+		ev.Metadata["os_user"] = u
+	}
+	ev.UserAgent = "mychat-auth-cli"
+	ev.CreatedAt = time.Now().UTC()
+	if err := env.stores.Audit.Insert(ctx, ev); err != nil {
+		slog.Warn("⚠️ Failed to write audit event", "action", ev.Action, "error", err)
+	}
+}
+
+// userByEmail หา user ตามอีเมล แปลง ErrNotFound เป็นข้อความที่อ่านง่าย
+func (env *cliEnv) userByEmail(ctx context.Context, email string) (models.User, error) {
+	user, err := env.stores.Users.ByEmail(ctx, email)
+	if errors.Is(err, store.ErrNotFound) {
+		return user, fmt.Errorf("no user with email %q", email)
+	}
+	return user, err
+}
+
+// readSecret คืนค่าจาก flag ถ้ามี ไม่งั้นอ่านบรรทัดแรกจาก stdin เช่น
+// echo "$ADMIN_PASSWORD" | mychat-auth seed -admin-email admin@example.com
+// ค่าที่ส่งผ่าน flag จะติดอยู่ใน shell history และ ps จึงควรใช้ stdin ใน production
+func readSecret(prompt, value string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, prompt)
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("password is required (pass -password or pipe it on stdin)")
+	}
+	return line, nil
+}
+
+// validPassword ใช้กฎเดียวกับ POST /register
+func validPassword(password string) error {
+	if len(password) < 6 {
+		return errors.New("password must be at least 6 characters")
+	}
+	return nil
+}
+
+// flagsExit แปลง error จาก FlagSet.Parse เป็น exit code (-h ไม่ถือว่าผิด)
+func flagsExit(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
+
+// fail พิมพ์ error ของคำสั่งออก stderr แล้วคืน exit code 1
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	return 1
+}
+
+// subcommand แยกชื่อ action ตัวแรกออกจาก args เช่น "user create -email ..." → "create"
+func subcommand(name string, args []string, actions map[string]func([]string) int) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintf(os.Stderr, "usage: mychat-auth %s <%s> [flags]\n", name, strings.Join(actionNames(actions), "|"))
+		return 2
+	}
+	action, ok := actions[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown %s action %q (use %s)\n", name, args[0], strings.Join(actionNames(actions), ", "))
+		return 2
+	}
+	return action(args[1:])
+}
+
+func actionNames(actions map[string]func([]string) int) []string {
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
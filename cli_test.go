@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"mychat-auth/models"
+	"mychat-auth/store"
+	"mychat-auth/utils"
+)
+
+// runCLI รันคำสั่งแล้วคืน exit code กับสิ่งที่เขียนออก stderr
+// กรณีที่ test ใช้ต้องล้มที่การตรวจ flag ก่อน openCLI จึงไม่ต้องมี Mongo
+func runCLI(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	code := run(args)
+	os.Stderr = stderr
+	w.Close()
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	return code, buf.String()
+}
+
+func TestCLIUsage(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"room"}, "usage: mychat-auth room <archive|create>"},
+		{[]string{"room", "rename"}, `unknown room action "rename"`},
+		{[]string{"keys", "-h"}, "usage: mychat-auth keys <list|rotate>"},
+	} {
+		code, stderr := runCLI(t, tc.args...)
+		if code != 2 || !strings.Contains(stderr, tc.want) {
+			t.Errorf("%v: exit %d, stderr %q; want 2 and %q", tc.args, code, stderr, tc.want)
+		}
+	}
+	if code, _ := runCLI(t, "room", "create", "-h"); code != 0 {
+		t.Errorf("room create -h: exit %d, want 0", code)
+	}
+	if code, _ := runCLI(t, "room", "create", "-no-such-flag"); code != 2 {
+		t.Errorf("unknown flag: exit %d, want 2", code)
+	}
+}
+
+func TestCLIFlagValidation(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"room", "create"}, "-name is required"},
+		{[]string{"room", "create", "-name", "x", "-type", "dm"}, "-type must be public or private"},
+		{[]string{"room", "create", "-name", "staff", "-type", "private"}, "-owner is required for private rooms"},
+		{[]string{"room", "create", "-name", "DM:abc"}, "reserved for direct messages"},
+		{[]string{"room", "archive"}, "pass exactly one of -id or -name"},
+		{[]string{"room", "archive", "-id", "a", "-name", "b"}, "pass exactly one of -id or -name"},
+		{[]string{"seed", "-admin-email", "nope"}, "-admin-email"},
+		{[]string{"seed", "-admin-email", "admin@example.com", "-room", "dm:squat"}, "reserved for direct messages"},
+		{[]string{"user", "create", "-email", "a@example.com", "-role", "owner"}, "-role must be member or admin"},
+		{[]string{"user", "create", "-email", "a@example.com", "-password", "short"}, "at least 6 characters"},
+		{[]string{"user", "promote", "-email", "a@example.com", "-role", "root"}, "-role must be member or admin"},
+		{[]string{"sessions", "revoke"}, "pass exactly one of -email or -user-id"},
+		{[]string{"keys", "rotate", "-activate-in", "-1m"}, "-activate-in must not be negative"},
+		{[]string{"backup", "export"}, "-out is required"},
+		{[]string{"backup", "export", "-out", "x.tar.gz", "-rooms", "nope"}, `invalid room ID "nope"`},
+		{[]string{"backup", "export", "-out", "x.tar.gz", "-from", "yesterday"}, "-from: want RFC3339 or YYYY-MM-DD"},
+		{[]string{"backup", "restore"}, "-in is required"},
+	} {
+		code, stderr := runCLI(t, tc.args...)
+		if code != 1 || !strings.Contains(stderr, tc.want) {
+			t.Errorf("%v: exit %d, stderr %q; want 1 and %q", tc.args, code, stderr, tc.want)
+		}
+	}
+}
+
+func TestParseTimeFlag(t *testing.T) {
+	if got, err := parseTimeFlag("from", "2026-01-02"); err != nil || !got.Equal(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("date = %v, %v; want midnight UTC", got, err)
+	}
+	if got, err := parseTimeFlag("from", "2026-01-02T03:04:05+07:00"); err != nil || got.UTC().Hour() != 20 {
+		t.Fatalf("RFC3339 = %v, %v", got, err)
+	}
+	if got, err := parseTimeFlag("from", ""); err != nil || !got.IsZero() {
+		t.Fatalf("empty = %v, %v; want zero time", got, err)
+	}
+}
+
+func TestResealKeys(t *testing.T) {
+	ctx := context.Background()
+	env := &cliEnv{stores: store.NewMemory()}
+	kc := utils.NewKeyCipher("keyring-secret")
+
+	legacy := models.SigningKey{ID: "legacy", PlainSecret: []byte("plain-secret"), ActiveAt: time.Now().Add(-time.Hour)}
+	sealed, err := kc.Seal(models.SigningKey{ID: "sealed", Secret: []byte("sealed-secret"), ActiveAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	for _, k := range []models.SigningKey{legacy, sealed} {
+		if err := env.stores.Keys.Create(ctx, k); err != nil {
+			t.Fatalf("create key: %v", err)
+		}
+	}
+
+	existing, _ := env.stores.Keys.List(ctx)
+	resealed, err := resealKeys(ctx, env, kc, existing)
+	if err != nil || len(resealed) != 1 || resealed[0] != "legacy" {
+		t.Fatalf("resealKeys = %v, %v; want only the legacy key", resealed, err)
+	}
+
+	keys, _ := env.stores.Keys.List(ctx)
+	if len(keys) != 2 {
+		t.Fatalf("keyring has %d keys after resealing, want 2", len(keys))
+	}
+	for _, k := range keys {
+		if !k.Sealed() || k.PlainSecret != nil {
+			t.Fatalf("key %s still stores its secret in plaintext", k.ID)
+		}
+		opened, err := kc.Open(k)
+		if err != nil {
+			t.Fatalf("Open %s: %v", k.ID, err)
+		}
+		if k.ID == "legacy" && string(opened.Secret) != "plain-secret" {
+			t.Fatalf("legacy key secret = %q after resealing", opened.Secret)
+		}
+	}
+
+	// รันซ้ำไม่มีอะไรต้องทำ
+	if again, err := resealKeys(ctx, env, kc, keys); err != nil || len(again) != 0 {
+		t.Fatalf("second resealKeys = %v, %v; want nothing", again, err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mychat-auth/backup"
+	"mychat-auth/database"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// runBackup จัดการคำสั่ง "backup export|restore"
+func runBackup(args []string) int {
+	return subcommand("backup", args, map[string]func([]string) int{
+		"export":  backupExport,
+		"restore": backupRestore,
+	})
+}
+
+func backupExport(args []string) int {
+	fs, configFile := newFlagSet("backup export")
+	out := fs.String("out", "", "archive to write, e.g. mychat-2026-01-01.tar.gz (required)")
+	rooms := fs.String("rooms", "", "comma-separated room IDs to export (default all rooms)")
+	from := fs.String("from", "", "only messages created at or after this time (RFC3339 or YYYY-MM-DD)")
+	to := fs.String("to", "", "only messages created before this time (RFC3339 or YYYY-MM-DD)")
+	if err := fs.Parse(args); err != nil {
+		return flagsExit(err)
+	}
+	if *out == "" {
+		return fail(errors.New("-out is required"))
+	}
+
+	var opts backup.ExportOptions
+	for _, raw := range strings.Split(*rooms, ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		id, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			return fail(fmt.Errorf("-rooms: invalid room ID %q", raw))
+		}
+		opts.RoomIDs = append(opts.RoomIDs, id)
+	}
+	var err error
+	if opts.From, err = parseTimeFlag("from", *from); err != nil {
+		return fail(err)
+	}
+	if opts.To, err = parseTimeFlag("to", *to); err != nil {
+		return fail(err)
+	}
+
+	_, cleanup, err := openCLI(*configFile, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	// เขียนลงไฟล์ชั่วคราวข้าง ๆ ก่อนแล้วค่อย rename จะได้ไม่มีไฟล์ครึ่ง ๆ ถ้าล้มกลางทาง
+	// ในไฟล์มี password hash จึงให้สิทธิ์เจ้าของอ่านได้คนเดียว
+	tmp, err := os.CreateTemp(filepath.Dir(*out), ".mychat-backup-*")
+	if err != nil {
+		return fail(err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fail(err)
+	}
+
+	m, err := backup.Export(ctx, database.DB, tmp, opts)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmp.Name(), *out); err != nil {
+		return fail(err)
+	}
+
+	for _, f := range m.Files {
+		fmt.Fprintf(os.Stdout, "%-10s %8d documents\n", f.Collection, f.Count)
+	}
+	fmt.Fprintf(os.Stdout, "wrote %s (backup %s)\n", *out, m.ID)
+	return 0
+}
+
+func backupRestore(args []string) int {
+	fs, configFile := newFlagSet("backup restore")
+	in := fs.String("in", "", "archive to restore (required)")
+	remap := fs.Bool("remap", false, "give every document a new ObjectID (for importing into an environment that already has data)")
+	mergeRooms := fs.Bool("merge-rooms", false, "merge rooms into existing rooms with the same name instead of failing")
+	dryRun := fs.Bool("dry-run", false, "verify the archive and print its contents without writing")
+	if err := fs.Parse(args); err != nil {
+		return flagsExit(err)
+	}
+	if *in == "" {
+		return fail(errors.New("-in is required"))
+	}
+
+	if *dryRun {
+		m, err := backup.Verify(*in)
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Fprintf(os.Stdout, "backup %s of %s taken %s (format %d)\n", m.ID, m.Database, m.CreatedAt.Format(time.RFC3339), m.FormatVersion)
+		for _, f := range m.Files {
+			fmt.Fprintf(os.Stdout, "%-10s %8d documents  sha256 ok\n", f.Collection, f.Count)
+		}
+		return 0
+	}
+
+	_, cleanup, err := openCLI(*configFile, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	m, results, err := backup.Restore(ctx, database.DB, *in, backup.RestoreOptions{Remap: *remap, MergeRooms: *mergeRooms})
+	for _, res := range results {
+		fmt.Fprintf(os.Stdout, "%-10s %8d written  %6d merged with existing\n", res.Collection, res.Written, res.Merged)
+	}
+	if errors.Is(err, backup.ErrConflict) {
+		return fail(fmt.Errorf("%w; pass -merge-rooms to merge them into the existing rooms", err))
+	}
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Fprintf(os.Stdout, "restored backup %s\n", m.ID)
+	return 0
+}
+
+// parseTimeFlag รับทั้ง RFC3339 และวันที่ล้วน (ตีความเป็นเที่ยงคืน UTC)
+func parseTimeFlag(name, v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("-%s: want RFC3339 or YYYY-MM-DD, got %q", name, v)
+	}
+	return t, nil
+}
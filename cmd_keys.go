@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"time"
+
+	"mychat-auth/models"
+	"mychat-auth/utils"
+)
+
+// runKeys จัดการคำสั่ง "keys rotate|list" ของ keyring ที่ใช้เซ็น JWT
+func runKeys(args []string) int {
+	return subcommand("keys", args, map[string]func([]string) int{
+		"rotate": keysRotate,
+		"list":   keysList,
+	})
+}
+
+// keysRotate เพิ่ม key ใหม่ที่เริ่มเซ็นหลัง -activate-in แล้วลบ key ที่ถูกแทนนานกว่า JWT_REFRESH_TTL
+// (token ทุกตัวที่เซ็นด้วย key นั้นหมดอายุไปแล้ว) secret เก็บแบบเข้ารหัสด้วย JWT_KEYRING_SECRET
+// key รุ่นก่อนที่ยังเก็บ secret ไว้ตรง ๆ จะถูกเข้ารหัสใหม่ในรอบนี้ด้วย
+// เมื่อ key แรกใน keyring active แล้ว token ที่เซ็นด้วย JWT_SECRET (ไม่มี kid) จะใช้ไม่ได้อีก
+func keysRotate(args []string) int {
+	fs, configFile := newFlagSet("keys rotate")
+	activateIn := fs.Duration("activate-in", 2*keyReloadInterval, "delay before the new key starts signing; must exceed the servers' key reload interval")
+	if err := fs.Parse(args); err != nil {
+		return flagsExit(err)
+	}
+	if *activateIn < 0 {
+		return fail(fmt.Errorf("-activate-in must not be negative"))
+	}
+
+	env, cleanup, err := openCLI(*configFile, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+
+	kc := utils.NewKeyCipher(env.cfg.JWT.KeyringSecret)
+	if kc == nil {
+		return fail(utils.ErrKeyringSecretMissing)
+	}
+	existing, err := env.stores.Keys.List(ctx)
+	if err != nil {
+		return fail(err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fail(err)
+	}
+	now := time.Now().UTC()
+	key := models.SigningKey{
+		ID:        utils.RandomID()[:16],
+		Secret:    secret,
+		ActiveAt:  now.Add(*activateIn),
+		CreatedAt: now,
+	}
+	sealed, err := kc.Seal(key)
+	if err != nil {
+		return fail(err)
+	}
+	if err := env.stores.Keys.Create(ctx, sealed); err != nil {
+		return fail(err)
+	}
+
+	resealed, err := resealKeys(ctx, env, kc, existing)
+	if err != nil {
+		return fail(err)
+	}
+
+	keys, err := env.stores.Keys.List(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	var pruned []string
+	for i := 0; i < len(keys)-1; i++ {
+		if keys[i+1].ActiveAt.Add(env.cfg.JWT.RefreshTTL).Before(now) {
+			if err := env.stores.Keys.Delete(ctx, keys[i].ID); err != nil {
+				return fail(fmt.Errorf("prune key %s: %w", keys[i].ID, err))
+			}
+			pruned = append(pruned, keys[i].ID)
+		}
+	}
+
+	meta := map[string]string{"kid": key.ID, "active_at": key.ActiveAt.Format(time.RFC3339)}
+	if len(pruned) > 0 {
+		meta["pruned"] = fmt.Sprint(pruned)
+	}
+	if len(resealed) > 0 {
+		meta["encrypted"] = fmt.Sprint(resealed)
+	}
+	env.audit(ctx, models.AuditEvent{Action: models.AuditKeyRotate, Outcome: models.AuditSuccess, TargetType: "signing_key", TargetID: key.ID, Metadata: meta})
+	fmt.Fprintf(os.Stdout, "new key %s signs from %s\n", key.ID, key.ActiveAt.Format(time.RFC3339))
+	if len(existing) == 0 {
+		fmt.Fprintln(os.Stdout, "tokens signed with JWT_SECRET stop working once this key is active; users will have to log in again")
+	}
+	for _, kid := range resealed {
+		fmt.Fprintf(os.Stdout, "encrypted key %s\n", kid)
+	}
+	for _, kid := range pruned {
+		fmt.Fprintf(os.Stdout, "pruned key %s\n", kid)
+	}
+	return 0
+}
+
+// resealKeys เข้ารหัส key ที่ยังเก็บ secret ไว้ตรง ๆ โดยลบแล้วสร้างใหม่ด้วย kid เดิม
+// replica ที่โหลด keyring ระหว่างนี้อาจไม่เห็น key นั้นครู่หนึ่ง WatchKeys รอบถัดไปจะโหลดกลับมาเอง
+func resealKeys(ctx context.Context, env *cliEnv, kc *utils.KeyCipher, keys []models.SigningKey) ([]string, error) {
+	var resealed []string
+	for _, k := range keys {
+		if k.Sealed() {
+			continue
+		}
+		k.Secret = k.PlainSecret
+		sealed, err := kc.Seal(k)
+		if err != nil {
+			return resealed, err
+		}
+		if err := env.stores.Keys.Delete(ctx, k.ID); err != nil {
+			return resealed, fmt.Errorf("encrypt key %s: %w", k.ID, err)
+		}
+		if err := env.stores.Keys.Create(ctx, sealed); err != nil {
+			return resealed, fmt.Errorf("encrypt key %s: %w", k.ID, err)
+		}
+		resealed = append(resealed, k.ID)
+	}
+	return resealed, nil
+}
+
+func keysList(args []string) int {
+	fs, configFile := newFlagSet("keys list")
+	if err := fs.Parse(args); err != nil {
+		return flagsExit(err)
+	}
+
+	env, cleanup, err := openCLI(*configFile, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+
+	keys, err := env.stores.Keys.List(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	if len(keys) == 0 {
+		fmt.Fprintln(os.Stdout, "no keys in the keyring, tokens are signed with JWT_SECRET")
+		return 0
+	}
+	now := time.Now()
+	for i, k := range keys {
+		status := "retired"
+		switch {
+		case k.ActiveAt.After(now):
+			status = "pending"
+		case i == len(keys)-1 || keys[i+1].ActiveAt.After(now):
+			status = "signing"
+		}
+		storage := "encrypted"
+		if !k.Sealed() {
+			storage = "plaintext"
+		}
+		fmt.Fprintf(os.Stdout, "%-16s  %-8s  %-9s  active_at=%s\n", k.ID, status, storage, k.ActiveAt.Format(time.RFC3339))
+	}
+	return 0
+}
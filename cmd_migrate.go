@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"mychat-auth/database"
+	"mychat-auth/migrate"
+)
+
+// runMigrate จัดการคำสั่ง "migrate": up (ค่าเริ่มต้น) รัน migration ที่ค้าง, status แสดงสถานะทุกเวอร์ชัน
+func runMigrate(args []string) int {
+	action := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	if action != "" && action != "up" && action != "status" {
+		fmt.Fprintf(os.Stderr, "unknown migrate action %q (use up or status)\n", action)
+		return 2
+	}
+
+	fs, configFile := newFlagSet("migrate")
+	if err := fs.Parse(args); err != nil {
+		return flagsExit(err)
+	}
+	_, cleanup, err := openCLI(*configFile, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	if action == "status" {
+		list, err := migrate.List(ctx, database.DB)
+		if err != nil {
+			slog.Error("❌ Failed to read migration status", "error", err)
+			return 1
+		}
+		for _, st := range list {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(os.Stdout, "%4d  %-32s  %s\n", st.Version, st.Name, applied)
+		}
+		return 0
+	}
+
+	ran, err := migrate.Up(ctx, database.DB)
+	if err != nil {
+		slog.Error("❌ Migration failed", "error", err, "applied", ran)
+		return 1
+	}
+	if len(ran) == 0 {
+		slog.Info("✅ Schema is up to date")
+	} else {
+		slog.Info("✅ Migrations applied", "versions", ran)
+	}
+	return 0
+}
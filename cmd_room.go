@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"mychat-auth/models"
+	"mychat-auth/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// runRoom จัดการคำสั่ง "room create|archive"
+func runRoom(args []string) int {
+	return subcommand("room", args, map[string]func([]string) int{
+		"create":  roomCreate,
+		"archive": roomArchive,
+	})
+}
+
+func roomCreate(args []string) int {
+	fs, configFile := newFlagSet("room create")
+	name := fs.String("name", "", "room name (required)")
+	roomType := fs.String("type", models.RoomTypePublic, "room type: public or private")
+	ownerEmail := fs.String("owner", "", "email of the room owner (required for private rooms)")
+	if err := fs.Parse(args); err != nil {
+		return flagsExit(err)
+	}
+	if *name == "" {
+		return fail(errors.New("-name is required"))
+	}
+	if *roomType != models.RoomTypePublic && *roomType != models.RoomTypePrivate {
+		return fail(errors.New("-type must be public or private"))
+	}
+	// ห้อง private ที่ไม่มีสมาชิกไม่มีใครเห็นหรือเชิญคนเข้าได้
+	if *roomType == models.RoomTypePrivate && *ownerEmail == "" {
+		return fail(errors.New("-owner is required for private rooms"))
+	}
+	if models.ReservedRoomName(*name) {
+		return fail(errors.New("-name must not start with \"dm:\", it is reserved for direct messages"))
+	}
+
+	env, cleanup, err := openCLI(*configFile, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+
+	room := models.Room{
+		Name:      *name,
+		Type:      *roomType,
+		Members:   []models.RoomMember{},
+		CreatedAt: time.Now(),
+	}
+	if *ownerEmail != "" {
+		owner, err := env.userByEmail(ctx, *ownerEmail)
+		if err != nil {
+			return fail(err)
+		}
+		room.OwnerID = owner.ID
+		room.Members = []models.RoomMember{{SafeUser: owner.ToSafeUser(), Role: models.RoomRoleOwner}}
+	}
+
+	err = env.stores.Rooms.Create(ctx, &room)
+	if errors.Is(err, store.ErrConflict) {
+		return fail(fmt.Errorf("a room named %q already exists", *name))
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	env.audit(ctx, models.AuditEvent{Action: models.AuditRoomCreate, Outcome: models.AuditSuccess, TargetType: "room", TargetID: room.ID.Hex(), Metadata: map[string]string{"name": room.Name, "type": room.Type}})
+	fmt.Fprintln(os.Stdout, room.ID.Hex())
+	return 0
+}
+
+func roomArchive(args []string) int {
+	fs, configFile := newFlagSet("room archive")
+	id := fs.String("id", "", "room ID")
+	name := fs.String("name", "", "room name (when -id is not given)")
+	if err := fs.Parse(args); err != nil {
+		return flagsExit(err)
+	}
+	if (*id == "") == (*name == "") {
+		return fail(errors.New("pass exactly one of -id or -name"))
+	}
+
+	env, cleanup, err := openCLI(*configFile, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+
+	room, err := env.findRoom(ctx, *id, *name)
+	if err != nil {
+		return fail(err)
+	}
+	if room.Archived {
+		fmt.Fprintf(os.Stdout, "room %q is already archived\n", room.Name)
+		return 0
+	}
+	if err := env.stores.Rooms.SetArchived(ctx, room.ID, true); err != nil {
+		return fail(err)
+	}
+
+	env.audit(ctx, models.AuditEvent{Action: models.AuditRoomArchive, Outcome: models.AuditSuccess, TargetType: "room", TargetID: room.ID.Hex(), Metadata: map[string]string{"name": room.Name}})
+	fmt.Fprintf(os.Stdout, "room %q archived\n", room.Name)
+	return 0
+}
+
+// findRoom หาห้องตาม ID ถ้าระบุ ไม่งั้นตามชื่อ
+func (env *cliEnv) findRoom(ctx context.Context, id, name string) (models.Room, error) {
+	if id != "" {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return models.Room{}, fmt.Errorf("-id: %w", err)
+		}
+		room, err := env.stores.Rooms.ByID(ctx, oid)
+		if errors.Is(err, store.ErrNotFound) {
+			return room, fmt.Errorf("no room with ID %s", id)
+		}
+		return room, err
+	}
+	rooms, err := env.stores.Rooms.List(ctx)
+	if err != nil {
+		return models.Room{}, err
+	}
+	for _, room := range rooms {
+		if room.Name == name {
+			return room, nil
+		}
+	}
+	return models.Room{}, fmt.Errorf("no room named %q", name)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+
+	"mychat-auth/models"
+	"mychat-auth/utils"
+)
+
+// runSeed สร้าง admin คนแรกและห้องเริ่มต้นให้ environment ใหม่ รันซ้ำได้ (ข้ามของที่มีอยู่แล้ว)
+func runSeed(args []string) int {
+	fs, configFile := newFlagSet("seed")
+	email := fs.String("admin-email", "", "email of the admin user (required)")
+	password := fs.String("admin-password", "", "admin password (read from stdin when omitted)")
+	roomName := fs.String("room", "general", "name of the default public room; empty to skip")
+	if err := fs.Parse(args); err != nil {
+		return flagsExit(err)
+	}
+	if _, err := mail.ParseAddress(*email); err != nil {
+		return fail(fmt.Errorf("-admin-email: %w", err))
+	}
+	if models.ReservedRoomName(*roomName) {
+		return fail(errors.New("-room must not start with \"dm:\", it is reserved for direct messages"))
+	}
+	pw, err := readSecret("Admin password: ", *password)
+	if err != nil {
+		return fail(err)
+	}
+	if err := validPassword(pw); err != nil {
+		return fail(err)
+	}
+
+	env, cleanup, err := openCLI(*configFile, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+
+	admin, created, err := utils.SeedAdminUser(ctx, env.stores.Users, *email, pw)
+	if err != nil {
+		return fail(fmt.Errorf("seed admin: %w", err))
+	}
+	if created {
+		env.audit(ctx, models.AuditEvent{Action: models.AuditUserCreate, Outcome: models.AuditSuccess, TargetType: "user", TargetID: admin.ID.Hex(), Metadata: map[string]string{"role": admin.Role}})
+		fmt.Fprintf(os.Stdout, "admin %s created\n", *email)
+	} else {
+		// ไม่แตะรหัสผ่านหรือ role ของ user ที่มีอยู่แล้ว ใช้ "user reset-password" / "user promote" แทน
+		fmt.Fprintf(os.Stdout, "user %s already exists, left unchanged\n", *email)
+	}
+
+	if *roomName == "" {
+		return 0
+	}
+	created, err = utils.SeedRoom(ctx, env.stores.Rooms, *roomName, admin)
+	if err != nil {
+		return fail(fmt.Errorf("seed room: %w", err))
+	}
+	if created {
+		fmt.Fprintf(os.Stdout, "room %q created\n", *roomName)
+	} else {
+		fmt.Fprintf(os.Stdout, "room %q already exists, left unchanged\n", *roomName)
+	}
+	return 0
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"mychat-auth/config"
+	"mychat-auth/database"
+	"mychat-auth/handlers"
+	"mychat-auth/middleware"
+	"mychat-auth/migrate"
+	"mychat-auth/shared/logger"
+	"mychat-auth/store"
+	"mychat-auth/tracing"
+	"mychat-auth/utils"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// keyReloadInterval คือความถี่ที่ server โหลด keyring ของ JWT ใหม่
+// "keys rotate" ตั้ง ActiveAt ของ key ใหม่ไว้เกินค่านี้ ทุก replica จึงรู้จัก key ก่อนมีใครเริ่มเซ็นด้วยมัน
+const keyReloadInterval = time.Minute
+
+// runServe เปิด HTTP/WebSocket server จนได้ SIGINT/SIGTERM
+func runServe(args []string) int {
+	// โหลด config ทั้งหมดครั้งเดียว ถ้าขาดค่าที่จำเป็นให้หยุดตั้งแต่ตอนนี้
+	cfg, err := config.Load(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// log แบบ JSON ผ่าน redaction ทุกบรรทัด (secret, token, password และ PII ที่กำหนด)
+	logger.Init(logger.Options{
+		Level:     cfg.Log.Level,
+		Format:    cfg.Log.Format,
+		PIIFields: cfg.Log.RedactFields,
+	})
+
+	// tracing ต้องพร้อมก่อนเชื่อม Mongo/Redis เพราะ instrumentation อ่าน provider ตอนสร้าง client
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		ServiceName: cfg.Tracing.ServiceName,
+		Env:         cfg.Env,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		slog.Error("❌ Tracing setup error", "error", err)
+		return 1
+	}
+
+	// เชื่อม MongoDB และ Redis แบบ retry เผื่อ dependency ยังเปิดไม่เสร็จตอน deploy พร้อมกัน
+	retry := utils.RetryPolicy{
+		Attempts:       cfg.Startup.RetryAttempts,
+		InitialBackoff: cfg.Startup.RetryInitialBackoff,
+		MaxBackoff:     cfg.Startup.RetryMaxBackoff,
+	}
+	err = utils.Retry(context.Background(), "mongo", retry, func(ctx context.Context) error {
+		return database.InitMongo(ctx, cfg.Mongo.URI, cfg.Mongo.Database)
+	})
+	if err != nil {
+		slog.Error("❌ MongoDB connection error", "error", err)
+		return 1
+	}
+
+	if cfg.Mongo.AutoMigrate {
+		ran, err := migrate.Up(context.Background(), database.DB)
+		if err != nil {
+			slog.Error("❌ Migration failed", "error", err)
+			return 1
+		}
+		if len(ran) > 0 {
+			slog.Info("✅ Migrations applied", "versions", ran)
+		}
+	}
+
+	err = utils.Retry(context.Background(), "redis", retry, func(ctx context.Context) error {
+		return utils.InitRedis(ctx, cfg.Redis.Addr)
+	})
+	if err != nil {
+		slog.Error("❌ Redis connection error", "error", err)
+		return 1
+	}
+
+	origins, err := utils.NewOriginPolicy(cfg.HTTP.AllowedOrigins)
+	if err != nil {
+		slog.Error("invalid allowed origins", "error", err)
+		return 1
+	}
+
+	stores := store.NewMongo(database.DB)
+	stores.Sessions = store.NewRedisSessionStore(utils.RedisClient)
+
+	jwtManager := utils.NewJWTManager(cfg.JWT.Secret, cfg.JWT.AccessTTL, cfg.JWT.RefreshTTL)
+	keyCipher := utils.NewKeyCipher(cfg.JWT.KeyringSecret)
+	if err := jwtManager.LoadKeys(context.Background(), stores.Keys, keyCipher); err != nil {
+		slog.Error("❌ Failed to load signing keys", "error", err)
+		return 1
+	}
+	cookies := utils.NewCookiePolicy(cfg, cfg.JWT.AccessTTL, cfg.JWT.RefreshTTL)
+	csrfSigner, err := utils.NewCSRFSigner(cfg.CSRF.Secret)
+	if err != nil {
+		slog.Error("❌ Failed to create CSRF signer", "error", err)
+		return 1
+	}
+	if cfg.CSRF.Secret == "" {
+		slog.Warn("⚠️ CSRF_SECRET is not set, using a random key; CSRF tokens reset on restart and do not work across replicas")
+	}
+
+	auth := middleware.NewAuth(jwtManager, cookies, stores.Sessions)
+	csrf := middleware.NewCSRF(csrfSigner, cookies, origins, jwtManager)
+	srv := handlers.NewServer(cfg, stores, jwtManager, cookies, csrfSigner, origins)
+	srv.ReadyChecks = map[string]func(context.Context) error{
+		"mongo": database.Ping,
+		"redis": utils.PingRedis,
+	}
+
+	router := newRouter(srv, auth)
+	handler := middleware.RequestID(middleware.RequestLogger(middleware.Metrics(middleware.CORS(origins, cfg.HTTP.CORSMaxAge)(csrf.Protect(router)))))
+	// otelhttp อยู่นอกสุดเพื่อรับ traceparent จาก client และให้ทุกชั้นข้างในเห็น span เดียวกัน
+	handler = otelhttp.NewHandler(handler, "http.request",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return r.URL.Path != "/healthz" && r.URL.Path != "/readyz" && r.URL.Path != "/metrics"
+		}),
+	)
+
+	httpServer := &http.Server{
+		Addr:              cfg.HTTP.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go jwtManager.WatchKeys(ctx, stores.Keys, keyCipher, keyReloadInterval)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Auth service running", "addr", cfg.HTTP.Addr, "env", cfg.Env)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		slog.Error("server stopped", "error", err)
+		stop()
+		return 1
+	case <-ctx.Done():
+	}
+	stop()
+	srv.MarkDraining()
+
+	slog.Info("🛑 Shutdown signal received, draining connections", "timeout", cfg.HTTP.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+
+	// 1) หยุดรับ connection ใหม่และรอ HTTP request ที่ค้างอยู่
+	// 2) ปิด WebSocket ด้วย close frame "going away" หลัง flush ข้อความที่ค้าง
+	// 3) ปิด Mongo และ Redis
+	// 4) flush span ที่ยังค้างใน exporter เป็นลำดับสุดท้าย
+	exitCode := 0
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		slog.Error("HTTP shutdown incomplete", "error", err)
+		exitCode = 1
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("WebSocket shutdown incomplete", "error", err)
+		exitCode = 1
+	}
+	if err := database.Disconnect(shutdownCtx); err != nil {
+		slog.Error("Mongo disconnect failed", "error", err)
+		exitCode = 1
+	}
+	if err := utils.CloseRedis(); err != nil {
+		slog.Error("Redis close failed", "error", err)
+		exitCode = 1
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Trace flush failed", "error", err)
+		exitCode = 1
+	}
+
+	slog.Info("👋 Auth service stopped")
+	return exitCode
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"mychat-auth/models"
+	"mychat-auth/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// runSessions จัดการคำสั่ง "sessions revoke"
+func runSessions(args []string) int {
+	return subcommand("sessions", args, map[string]func([]string) int{
+		"revoke": sessionsRevoke,
+	})
+}
+
+// sessionsRevoke ทำให้ access และ refresh token ทุกตัวของ user ที่ออกไปแล้วใช้ไม่ได้ (logout ทุกเครื่อง)
+func sessionsRevoke(args []string) int {
+	fs, configFile := newFlagSet("sessions revoke")
+	email := fs.String("email", "", "email of the user")
+	userID := fs.String("user-id", "", "ID of the user (when -email is not given)")
+	if err := fs.Parse(args); err != nil {
+		return flagsExit(err)
+	}
+	if (*email == "") == (*userID == "") {
+		return fail(errors.New("pass exactly one of -email or -user-id"))
+	}
+
+	env, cleanup, err := openCLI(*configFile, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+
+	var user models.User
+	if *email != "" {
+		user, err = env.userByEmail(ctx, *email)
+	} else {
+		var oid primitive.ObjectID
+		if oid, err = primitive.ObjectIDFromHex(*userID); err != nil {
+			return fail(fmt.Errorf("-user-id: %w", err))
+		}
+		user, err = env.stores.Users.ByID(ctx, oid)
+		if errors.Is(err, store.ErrNotFound) {
+			err = fmt.Errorf("no user with ID %s", *userID)
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := env.jwt.RevokeUserSessions(ctx, env.stores.Sessions, user.ID.Hex()); err != nil {
+		return fail(err)
+	}
+
+	env.audit(ctx, models.AuditEvent{Action: models.AuditSessionRevoke, Outcome: models.AuditSuccess, TargetType: "user", TargetID: user.ID.Hex()})
+	fmt.Fprintf(os.Stdout, "all sessions of %s revoked\n", user.Email)
+	return 0
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"time"
+
+	"mychat-auth/models"
+	"mychat-auth/store"
+	"mychat-auth/utils"
+)
+
+// runUser จัดการคำสั่ง "user create|promote|reset-password|disable"
+func runUser(args []string) int {
+	return subcommand("user", args, map[string]func([]string) int{
+		"create":         userCreate,
+		"promote":        userPromote,
+		"reset-password": userResetPassword,
+		"disable":        userDisable,
+	})
+}
+
+func userCreate(args []string) int {
+	fs, configFile := newFlagSet("user create")
+	email := fs.String("email", "", "email of the new user (required)")
+	role := fs.String("role", "member", "role: member or admin")
+	password := fs.String("password", "", "password (read from stdin when omitted)")
+	imageURL := fs.String("image-url", "", "avatar URL")
+	if err := fs.Parse(args); err != nil {
+		return flagsExit(err)
+	}
+	if _, err := mail.ParseAddress(*email); err != nil {
+		return fail(fmt.Errorf("-email: %w", err))
+	}
+	if *role != "member" && *role != "admin" {
+		return fail(errors.New("-role must be member or admin"))
+	}
+	pw, err := readSecret("Password: ", *password)
+	if err != nil {
+		return fail(err)
+	}
+	if err := validPassword(pw); err != nil {
+		return fail(err)
+	}
+
+	env, cleanup, err := openCLI(*configFile, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+
+	hashed, err := utils.HashPassword(pw)
+	if err != nil {
+		return fail(err)
+	}
+	user := models.User{
+		Email:     *email,
+		Password:  hashed,
+		Role:      *role,
+		ImageURL:  *imageURL,
+		CreatedAt: time.Now(),
+	}
+	err = env.stores.Users.Create(ctx, &user)
+	if errors.Is(err, store.ErrConflict) {
+		return fail(fmt.Errorf("a user with email %q already exists", *email))
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	env.audit(ctx, models.AuditEvent{Action: models.AuditUserCreate, Outcome: models.AuditSuccess, TargetType: "user", TargetID: user.ID.Hex(), Metadata: map[string]string{"role": user.Role}})
+	fmt.Fprintln(os.Stdout, user.ID.Hex())
+	return 0
+}
+
+func userPromote(args []string) int {
+	fs, configFile := newFlagSet("user promote")
+	email := fs.String("email", "", "email of the user (required)")
+	role := fs.String("role", "admin", "new role: admin or member")
+	if err := fs.Parse(args); err != nil {
+		return flagsExit(err)
+	}
+	if *email == "" {
+		return fail(errors.New("-email is required"))
+	}
+	if *role != "member" && *role != "admin" {
+		return fail(errors.New("-role must be member or admin"))
+	}
+
+	env, cleanup, err := openCLI(*configFile, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+
+	user, err := env.userByEmail(ctx, *email)
+	if err != nil {
+		return fail(err)
+	}
+	if err := env.stores.Users.SetRole(ctx, user.ID, *role); err != nil {
+		return fail(err)
+	}
+
+	env.audit(ctx, models.AuditEvent{Action: models.AuditUserRoleChange, Outcome: models.AuditSuccess, TargetType: "user", TargetID: user.ID.Hex(), Metadata: map[string]string{"from": user.Role, "to": *role}})
+	// role อยู่ใน access token ด้วย จึงมีผลเมื่อ client refresh ครั้งถัดไป (ไม่เกิน JWT_ACCESS_TTL)
+	fmt.Fprintf(os.Stdout, "%s is now %s (takes effect on the next token refresh)\n", *email, *role)
+	return 0
+}
+
+func userResetPassword(args []string) int {
+	fs, configFile := newFlagSet("user reset-password")
+	email := fs.String("email", "", "email of the user (required)")
+	password := fs.String("password", "", "new password (read from stdin when omitted)")
+	if err := fs.Parse(args); err != nil {
+		return flagsExit(err)
+	}
+	if *email == "" {
+		return fail(errors.New("-email is required"))
+	}
+	pw, err := readSecret("New password: ", *password)
+	if err != nil {
+		return fail(err)
+	}
+	if err := validPassword(pw); err != nil {
+		return fail(err)
+	}
+
+	env, cleanup, err := openCLI(*configFile, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+
+	user, err := env.userByEmail(ctx, *email)
+	if err != nil {
+		return fail(err)
+	}
+	hashed, err := utils.HashPassword(pw)
+	if err != nil {
+		return fail(err)
+	}
+	if err := env.stores.Users.SetPassword(ctx, user.ID, hashed); err != nil {
+		return fail(err)
+	}
+	// session เดิมอาจเป็นของคนที่รู้รหัสเก่า ให้ login ใหม่ทุกเครื่อง
+	if err := env.jwt.RevokeUserSessions(ctx, env.stores.Sessions, user.ID.Hex()); err != nil {
+		return fail(fmt.Errorf("password changed but revoking sessions failed: %w", err))
+	}
+
+	env.audit(ctx, models.AuditEvent{Action: models.AuditUserPasswordReset, Outcome: models.AuditSuccess, TargetType: "user", TargetID: user.ID.Hex()})
+	fmt.Fprintf(os.Stdout, "password reset for %s, existing sessions revoked\n", *email)
+	return 0
+}
+
+func userDisable(args []string) int {
+	fs, configFile := newFlagSet("user disable")
+	email := fs.String("email", "", "email of the user (required)")
+	if err := fs.Parse(args); err != nil {
+		return flagsExit(err)
+	}
+	if *email == "" {
+		return fail(errors.New("-email is required"))
+	}
+
+	env, cleanup, err := openCLI(*configFile, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+
+	user, err := env.userByEmail(ctx, *email)
+	if err != nil {
+		return fail(err)
+	}
+	if err := env.stores.Users.SetDisabled(ctx, user.ID, true); err != nil {
+		return fail(err)
+	}
+	if err := env.jwt.RevokeUserSessions(ctx, env.stores.Sessions, user.ID.Hex()); err != nil {
+		return fail(fmt.Errorf("user disabled but revoking sessions failed: %w", err))
+	}
+
+	env.audit(ctx, models.AuditEvent{Action: models.AuditUserDisable, Outcome: models.AuditSuccess, TargetType: "user", TargetID: user.ID.Hex()})
+	fmt.Fprintf(os.Stdout, "%s disabled, existing sessions revoked\n", *email)
+	return 0
+}
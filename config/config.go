@@ -0,0 +1,420 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config รวมค่าตั้งทั้งหมดของ service โหลดครั้งเดียวตอนเริ่มแล้วส่งต่อให้ส่วนที่ต้องใช้
+type Config struct {
+	Env     string        `yaml:"env" toml:"env"`
+	HTTP    HTTPConfig    `yaml:"http" toml:"http"`
+	Mongo   MongoConfig   `yaml:"mongo" toml:"mongo"`
+	Redis   RedisConfig   `yaml:"redis" toml:"redis"`
+	JWT     JWTConfig     `yaml:"jwt" toml:"jwt"`
+	Cookie  CookieConfig  `yaml:"cookie" toml:"cookie"`
+	CSRF    CSRFConfig    `yaml:"csrf" toml:"csrf"`
+	Log     LogConfig     `yaml:"log" toml:"log"`
+	Startup StartupConfig `yaml:"startup" toml:"startup"`
+	Tracing TracingConfig `yaml:"tracing" toml:"tracing"`
+	Chat    ChatConfig    `yaml:"chat" toml:"chat"`
+}
+
+type HTTPConfig struct {
+	Addr string `yaml:"addr" toml:"addr"`
+	// AllowedOrigins คือ origin ของ frontend ที่เชื่อถือได้ เช่น https://chat.paodev.xyz
+	// รองรับ wildcard subdomain เช่น https://*.paodev.xyz
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"`
+	// CORSMaxAge คือเวลาที่ browser cache ผล preflight ได้
+	CORSMaxAge time.Duration `yaml:"cors_max_age" toml:"cors_max_age"`
+	// TrustedProxies คือ IP หรือ CIDR ของ reverse proxy ที่เชื่อ X-Forwarded-For ได้
+	// ว่างคือไม่เชื่อ header นี้เลย ใช้ IP ของ connection ตรง ๆ
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	// ShutdownTimeout คือเวลาสูงสุดที่รอ request และ WebSocket ปิดตัวหลังได้ SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+type MongoConfig struct {
+	URI      string `yaml:"uri" toml:"uri"`
+	Database string `yaml:"database" toml:"database"`
+	// AutoMigrate รัน migration ที่ค้างตอน start ถ้าปิดต้องรัน "mychat-auth migrate" เองก่อน deploy
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate"`
+}
+
+type RedisConfig struct {
+	Addr string `yaml:"addr" toml:"addr"`
+}
+
+type JWTConfig struct {
+	Secret string `yaml:"secret" toml:"secret"`
+	// KeyringSecret เข้ารหัส secret ของ signing key ที่เก็บใน database ต้องตั้งก่อนใช้ "keys rotate"
+	KeyringSecret string        `yaml:"keyring_secret" toml:"keyring_secret"`
+	AccessTTL     time.Duration `yaml:"access_ttl" toml:"access_ttl"`
+	RefreshTTL    time.Duration `yaml:"refresh_ttl" toml:"refresh_ttl"`
+}
+
+// CookieConfig ใน production จะบังคับ Secure เสมอไม่ว่าตั้งไว้อย่างไร
+type CookieConfig struct {
+	Domain     string `yaml:"domain" toml:"domain"`
+	Secure     bool   `yaml:"secure" toml:"secure"`
+	SameSite   string `yaml:"same_site" toml:"same_site"`     // strict, lax หรือ none
+	HostPrefix bool   `yaml:"host_prefix" toml:"host_prefix"` // ใช้ชื่อ __Host- (ต้อง Secure และไม่มี Domain)
+}
+
+// CSRFConfig ต้องตั้ง Secret ใน production นอก production ถ้าไม่ตั้งจะสุ่ม key ใหม่ทุกครั้งที่ start
+type CSRFConfig struct {
+	Secret string `yaml:"secret" toml:"secret"`
+}
+
+// StartupConfig กำหนดการ retry ตอนเชื่อม Mongo/Redis ครั้งแรก แทนการล้มทันที
+type StartupConfig struct {
+	RetryAttempts       int           `yaml:"retry_attempts" toml:"retry_attempts"`
+	RetryInitialBackoff time.Duration `yaml:"retry_initial_backoff" toml:"retry_initial_backoff"`
+	RetryMaxBackoff     time.Duration `yaml:"retry_max_backoff" toml:"retry_max_backoff"`
+}
+
+// TracingConfig ใช้ชื่อ env ตามมาตรฐาน OTEL_* เพื่อให้ตั้งร่วมกับ collector ได้ตรง ๆ
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter"` // none, stdout หรือ otlp
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint"` // OTLP/HTTP เช่น http://otel-collector:4318
+	ServiceName string  `yaml:"service_name" toml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"` // 0.0–1.0 ใช้กับ trace ที่ไม่มี parent มาจาก client
+}
+
+// ChatConfig ปรับพฤติกรรมของข้อความในห้อง
+type ChatConfig struct {
+	// KeepEditHistory เก็บเนื้อหาเดิมทุกครั้งที่แก้ข้อความ ปิดแล้วจะเก็บแค่เวลาที่แก้ล่าสุด
+	KeepEditHistory bool `yaml:"keep_edit_history" toml:"keep_edit_history"`
+}
+
+type LogConfig struct {
+	Level        string   `yaml:"level" toml:"level"`
+	Format       string   `yaml:"format" toml:"format"`
+	RedactFields []string `yaml:"redact_fields" toml:"redact_fields"`
+}
+
+// Default คืนค่าเริ่มต้นที่ใช้ตอน dev
+func Default() *Config {
+	return &Config{
+		Env: "development",
+		HTTP: HTTPConfig{
+			Addr:              ":4001",
+			CORSMaxAge:        10 * time.Minute,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		Mongo: MongoConfig{Database: "mychat", AutoMigrate: true},
+		JWT: JWTConfig{
+			AccessTTL:  15 * time.Minute,
+			RefreshTTL: 7 * 24 * time.Hour,
+		},
+		// Domain ว่างคือ host-only cookie ตั้ง COOKIE_DOMAIN เมื่อต้องแชร์ cookie ข้าม subdomain
+		Cookie: CookieConfig{SameSite: "strict"},
+		Log: LogConfig{
+			Level:        "info",
+			Format:       "json",
+			RedactFields: []string{"email"},
+		},
+		Startup: StartupConfig{
+			RetryAttempts:       8,
+			RetryInitialBackoff: 500 * time.Millisecond,
+			RetryMaxBackoff:     15 * time.Second,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "mychat-auth",
+			SampleRatio: 1,
+		},
+		Chat: ChatConfig{KeepEditHistory: true},
+	}
+}
+
+// IsProduction บอกว่ารันอยู่ใน production หรือไม่
+func (c *Config) IsProduction() bool {
+	return c.Env == "production"
+}
+
+// Load อ่านค่าตามลำดับ: ค่าเริ่มต้น → ไฟล์ config (-config หรือ CONFIG_FILE) → env → flags
+// ไฟล์ที่ลงท้าย .toml อ่านเป็น TOML นอกนั้นอ่านเป็น YAML
+// แล้ว validate ก่อนคืนค่า ถ้ามีอะไรขาดให้ล้มตั้งแต่ตอนเริ่ม
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("mychat-auth", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to YAML or TOML config file")
+	addr := fs.String("addr", "", "HTTP listen address (overrides HTTP_ADDR)")
+	env := fs.String("env", "", "environment name (overrides APP_ENV)")
+	logLevel := fs.String("log-level", "", "log level: debug, info, warn, error (overrides LOG_LEVEL)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, fmt.Errorf("read config file: %w", err)
+		}
+		if err := parseFile(*configFile, data, cfg); err != nil {
+			return nil, fmt.Errorf("parse config file %s: %w", *configFile, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if *addr != "" {
+		cfg.HTTP.Addr = *addr
+	}
+	if *env != "" {
+		cfg.Env = *env
+	}
+	if *logLevel != "" {
+		cfg.Log.Level = *logLevel
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// parseFile เลือก parser ตามนามสกุลไฟล์ ทั้งสองแบบใช้ชื่อ key เดียวกัน
+func parseFile(path string, data []byte, cfg *Config) error {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		return toml.Unmarshal(data, cfg)
+	}
+	return yaml.Unmarshal(data, cfg)
+}
+
+func (c *Config) applyEnv() error {
+	setString(&c.Env, "APP_ENV")
+	setString(&c.HTTP.Addr, "HTTP_ADDR")
+	if v, ok := os.LookupEnv("ALLOWED_ORIGINS"); ok {
+		c.HTTP.AllowedOrigins = splitList(v)
+	}
+	if v, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		c.HTTP.TrustedProxies = splitList(v)
+	}
+	if port := os.Getenv("PORT"); port != "" && os.Getenv("HTTP_ADDR") == "" {
+		c.HTTP.Addr = ":" + port
+	}
+	setString(&c.Mongo.URI, "MONGO_URI")
+	setString(&c.Mongo.Database, "MONGO_DATABASE")
+	setString(&c.Redis.Addr, "REDIS_URL")
+	setString(&c.JWT.Secret, "JWT_SECRET")
+	setString(&c.JWT.KeyringSecret, "JWT_KEYRING_SECRET")
+	setString(&c.CSRF.Secret, "CSRF_SECRET")
+	setString(&c.Cookie.Domain, "COOKIE_DOMAIN")
+	setString(&c.Cookie.SameSite, "COOKIE_SAMESITE")
+	setString(&c.Log.Level, "LOG_LEVEL")
+	setString(&c.Log.Format, "LOG_FORMAT")
+	if v, ok := os.LookupEnv("LOG_REDACT_FIELDS"); ok {
+		c.Log.RedactFields = splitList(v)
+	}
+	setString(&c.Tracing.Exporter, "OTEL_TRACES_EXPORTER")
+	setString(&c.Tracing.Endpoint, "OTEL_EXPORTER_OTLP_ENDPOINT")
+	setString(&c.Tracing.ServiceName, "OTEL_SERVICE_NAME")
+	if err := setFloat(&c.Tracing.SampleRatio, "OTEL_TRACES_SAMPLER_ARG"); err != nil {
+		return err
+	}
+
+	// JWT_EXPIRES_IN เป็นชื่อเดิม ยังรับไว้ถ้าไม่ได้ตั้ง JWT_ACCESS_TTL
+	if err := setDuration(&c.JWT.AccessTTL, "JWT_EXPIRES_IN"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.JWT.AccessTTL, "JWT_ACCESS_TTL"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.JWT.RefreshTTL, "JWT_REFRESH_TTL"); err != nil {
+		return err
+	}
+	durations := map[string]*time.Duration{
+		"CORS_MAX_AGE":              &c.HTTP.CORSMaxAge,
+		"HTTP_READ_HEADER_TIMEOUT":  &c.HTTP.ReadHeaderTimeout,
+		"HTTP_READ_TIMEOUT":         &c.HTTP.ReadTimeout,
+		"HTTP_WRITE_TIMEOUT":        &c.HTTP.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":         &c.HTTP.IdleTimeout,
+		"SHUTDOWN_TIMEOUT":          &c.HTTP.ShutdownTimeout,
+		"STARTUP_RETRY_BACKOFF":     &c.Startup.RetryInitialBackoff,
+		"STARTUP_RETRY_MAX_BACKOFF": &c.Startup.RetryMaxBackoff,
+	}
+	for key, dst := range durations {
+		if err := setDuration(dst, key); err != nil {
+			return err
+		}
+	}
+	if err := setInt(&c.Startup.RetryAttempts, "STARTUP_RETRY_ATTEMPTS"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Mongo.AutoMigrate, "MONGO_AUTO_MIGRATE"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Cookie.Secure, "COOKIE_SECURE"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Cookie.HostPrefix, "COOKIE_HOST_PREFIX"); err != nil {
+		return err
+	}
+	if err := setBool(&c.Chat.KeepEditHistory, "CHAT_KEEP_EDIT_HISTORY"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate ตรวจค่าที่จำเป็นต้องมีก่อนเปิด service
+func (c *Config) Validate() error {
+	var errs []error
+	if c.JWT.Secret == "" {
+		errs = append(errs, errors.New("JWT_SECRET is required"))
+	} else if c.IsProduction() && len(c.JWT.Secret) < 32 {
+		errs = append(errs, errors.New("JWT_SECRET must be at least 32 characters in production"))
+	}
+	if c.IsProduction() {
+		// CSRF และ keyring ต้องใช้ secret ของตัวเอง ไม่งั้นคนที่ได้ JWT_SECRET ไปก็ปลอมได้หมด
+		switch {
+		case len(c.CSRF.Secret) < 32:
+			errs = append(errs, errors.New("CSRF_SECRET must be at least 32 characters in production"))
+		case c.CSRF.Secret == c.JWT.Secret:
+			errs = append(errs, errors.New("CSRF_SECRET must differ from JWT_SECRET"))
+		}
+		if c.JWT.KeyringSecret != "" && len(c.JWT.KeyringSecret) < 32 {
+			errs = append(errs, errors.New("JWT_KEYRING_SECRET must be at least 32 characters in production"))
+		}
+	}
+	if c.JWT.KeyringSecret != "" && c.JWT.KeyringSecret == c.JWT.Secret {
+		errs = append(errs, errors.New("JWT_KEYRING_SECRET must differ from JWT_SECRET"))
+	}
+	if c.Mongo.URI == "" {
+		errs = append(errs, errors.New("MONGO_URI is required"))
+	}
+	if c.Mongo.Database == "" {
+		errs = append(errs, errors.New("MONGO_DATABASE must not be empty"))
+	}
+	if c.Redis.Addr == "" {
+		errs = append(errs, errors.New("REDIS_URL is required"))
+	}
+	if c.HTTP.Addr == "" {
+		errs = append(errs, errors.New("HTTP_ADDR must not be empty"))
+	}
+	for _, p := range c.HTTP.TrustedProxies {
+		if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil {
+			errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %q is not an IP or CIDR", p))
+		}
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT must be positive"))
+	}
+	if c.JWT.AccessTTL <= 0 {
+		errs = append(errs, errors.New("JWT_ACCESS_TTL must be positive"))
+	}
+	if c.JWT.RefreshTTL <= c.JWT.AccessTTL {
+		errs = append(errs, errors.New("JWT_REFRESH_TTL must be longer than JWT_ACCESS_TTL"))
+	}
+	switch strings.ToLower(c.Cookie.SameSite) {
+	case "strict", "lax", "none":
+	default:
+		errs = append(errs, errors.New("COOKIE_SAMESITE must be strict, lax or none"))
+	}
+	if c.Cookie.HostPrefix && c.Cookie.Domain != "" {
+		errs = append(errs, errors.New("COOKIE_HOST_PREFIX cannot be combined with COOKIE_DOMAIN"))
+	}
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		errs = append(errs, errors.New("OTEL_TRACES_EXPORTER must be none, stdout or otlp"))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("OTEL_TRACES_SAMPLER_ARG must be between 0 and 1"))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func setString(dst *string, key string) {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		*dst = v
+	}
+}
+
+func setDuration(dst *time.Duration, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	*dst = d
+	return nil
+}
+
+func setInt(dst *int, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	*dst = n
+	return nil
+}
+
+func setFloat(dst *float64, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	*dst = f
+	return nil
+}
+
+func setBool(dst *bool, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	*dst = b
+	return nil
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -2,34 +2,88 @@ package database
 
 import (
 	"context"
-	"log"
-	"os"
+	"errors"
+	"log/slog"
 	"time"
 
+	"mychat-auth/metrics"
+
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 var Client *mongo.Client
-var UserCollection *mongo.Collection
-var RoomCollection *mongo.Collection
-var MessageCollection *mongo.Collection
 
-func InitMongo() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// DB คือ database ของ service ใช้สร้าง store (ดู store.NewMongo) แทนการแตะ collection ตรง ๆ
+var DB *mongo.Database
+
+var errNotConnected = errors.New("mongo client not initialized")
+
+// InitMongo เชื่อม Mongo แล้ว ping เพื่อยืนยันว่าเชื่อมได้จริง (mongo.Connect เองไม่ได้ต่อ server)
+// ผู้เรียกใช้ utils.Retry ครอบเพื่อรอ Mongo ที่ยังไม่พร้อมตอน start
+func InitMongo(ctx context.Context, uri, dbName string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	var err error
-	Client, err = mongo.Connect(ctx, options.Client().ApplyURI(os.Getenv("MONGO_URI")))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetMonitor(combineMonitors(
+		metrics.MongoMonitor(),
+		otelmongo.NewMonitor(),
+	)))
 	if err != nil {
-		log.Fatal("❌ MongoDB connection error:", err)
+		return err
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return err
 	}
+	Client = client
 
-	db := Client.Database("mychat")
-	UserCollection = db.Collection("users")
-	RoomCollection = db.Collection("rooms")
-	MessageCollection = db.Collection("messages")
-	log.Println("🧪 Mongo URI:", os.Getenv("MONGO_URI"))
-	log.Println("🧪 Using DB:", db.Name())
-	log.Println("✅ Connected to MongoDB and initialized collections")
+	DB = Client.Database(dbName)
+	slog.Info("✅ Connected to MongoDB", "mongo_uri", uri, "database", DB.Name())
+	return nil
+}
+
+// combineMonitors รวมหลาย CommandMonitor เพราะ driver รับได้ตัวเดียว (metrics + tracing)
+func combineMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
+
+// Ping ใช้ตรวจ readiness
+func Ping(ctx context.Context) error {
+	if Client == nil {
+		return errNotConnected
+	}
+	return Client.Ping(ctx, nil)
+}
+
+// Disconnect ปิด connection pool ของ Mongo ใช้ตอน shutdown
+func Disconnect(ctx context.Context) error {
+	if Client == nil {
+		return nil
+	}
+	return Client.Disconnect(ctx)
 }
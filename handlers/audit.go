@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mychat-auth/models"
+	"mychat-auth/shared/logger"
+	"mychat-auth/shared/response"
+	"mychat-auth/store"
+)
+
+// parseAuditFilter อ่าน filter จาก query string: action, outcome, actor_id, target_id, request_id, from, to (RFC3339)
+func parseAuditFilter(r *http.Request) (store.AuditFilter, error) {
+	q := r.URL.Query()
+	f := store.AuditFilter{
+		Action:    q.Get("action"),
+		Outcome:   q.Get("outcome"),
+		ActorID:   q.Get("actor_id"),
+		TargetID:  q.Get("target_id"),
+		RequestID: q.Get("request_id"),
+	}
+
+	var err error
+	if v := q.Get("from"); v != "" {
+		if f.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, err
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if f.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// GET /admin/audit — ค้นหา audit event แบบแบ่งหน้า (admin เท่านั้น)
+func (s *Server) AuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		response.Error(w, r, "Invalid from/to, expected RFC3339", http.StatusBadRequest)
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > store.MaxAuditPageSize {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	events, total, err := s.Store.Audit.Query(ctx, filter, page, limit)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("❌ Failed to query audit events", "error", err)
+		response.Error(w, r, "Failed to fetch audit events", http.StatusInternalServerError)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"events": events,
+		"page":   page,
+		"limit":  limit,
+		"total":  total,
+	})
+}
+
+// GET /admin/audit/export — ส่งออก audit event ตาม filter เป็น JSON Lines
+func (s *Server) AuditExportHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		response.Error(w, r, "Invalid from/to, expected RFC3339", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-`+time.Now().UTC().Format("20060102T150405Z")+`.jsonl"`)
+
+	enc := json.NewEncoder(w)
+	err = s.Store.Audit.Stream(r.Context(), filter, func(ev models.AuditEvent) error {
+		return enc.Encode(ev)
+	})
+	if err != nil {
+		// header ถูกส่งไปแล้ว ทำได้แค่ log แล้วตัด stream
+		logger.FromContext(r.Context()).Error("❌ Audit export aborted", "error", err)
+	}
+}
@@ -3,155 +3,142 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
-	"mychat-auth/database"
+	"mychat-auth/metrics"
 	"mychat-auth/models"
 	"mychat-auth/shared/contextkey"
+	"mychat-auth/shared/logger"
+	"mychat-auth/shared/response"
+	"mychat-auth/store"
 	"mychat-auth/types"
 	"mychat-auth/utils"
 
-	"github.com/go-playground/validator/v10"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var validate = validator.New()
-
 // RegisterHandler รับ POST /register
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("📥 RegisterHandler called")
+func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context())
 
 	var req models.User
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println("❌ Failed to decode body:", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Warn("❌ Failed to decode body", "error", err)
+		response.Error(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	// ✅ Validate input
 	if err := validate.Struct(req); err != nil {
-		log.Println("❌ Validation error:", err)
-		http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
+		log.Warn("❌ Validation error", "error", err)
+		response.Validation(w, r, err)
 		return
 	}
 
-	log.Println("🔍 Checking duplicate email:", req.Email)
-	count, err := database.UserCollection.CountDocuments(context.TODO(), bson.M{"email": req.Email})
-	if err != nil {
-		log.Println("❌ DB count error:", err)
-		http.Error(w, "DB error", http.StatusInternalServerError)
-		return
-	}
-	if count > 0 {
-		log.Println("⚠️ Email already exists")
-		http.Error(w, "Email already exists", http.StatusConflict)
-		return
-	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
 
 	// ✅ Hash password
-	log.Println("🔐 Hashing password...")
 	hashedPwd, err := utils.HashPassword(req.Password)
 	if err != nil {
-		log.Println("❌ Password hash error:", err)
-		http.Error(w, "Hash error", http.StatusInternalServerError)
+		log.Error("❌ Password hash error", "error", err)
+		response.Error(w, r, "Hash error", http.StatusInternalServerError)
 		return
 	}
 	req.Password = hashedPwd
 	req.CreatedAt = time.Now()
 	req.Role = "member"
 
-	// ✅ Insert user
-	log.Println("📝 Inserting new user into DB:", req.Email)
-	res, err := database.UserCollection.InsertOne(context.TODO(), req)
+	// ✅ Insert user (store ตรวจอีเมลซ้ำให้)
+	log.Debug("📝 Inserting new user into DB", "email", req.Email)
+	err = s.Store.Users.Create(ctx, &req)
+	if errors.Is(err, store.ErrConflict) {
+		log.Info("⚠️ Email already exists", "email", req.Email)
+		s.Audit.Record(r, models.AuditEvent{Action: models.AuditRegister, Outcome: models.AuditFailure, ActorEmail: req.Email, Reason: "email already exists"})
+		response.Error(w, r, "Email already exists", http.StatusConflict)
+		return
+	}
 	if err != nil {
-		log.Println("❌ Insert DB error:", err)
-		http.Error(w, "DB error", http.StatusInternalServerError)
+		log.Error("❌ Insert DB error", "error", err)
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
 		return
 	}
 
-	userID := res.InsertedID.(primitive.ObjectID).Hex()
-	log.Println("✅ User created with ID:", userID)
+	userID := req.ID.Hex()
+	log.Info("✅ User created", "new_user_id", userID)
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRegister, Outcome: models.AuditSuccess, ActorID: userID, ActorEmail: req.Email})
 
-	w.WriteHeader(http.StatusCreated)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	response.JSON(w, http.StatusCreated, map[string]string{
 		"userID": userID,
 	})
 }
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
+func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.User
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Invalid request format",
-		})
+		response.Error(w, r, "Invalid request format", http.StatusBadRequest)
 		return
 	}
 
-	var user models.User
-	err := database.UserCollection.FindOne(context.TODO(), bson.M{"email": req.Email}).Decode(&user)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.Store.Users.ByEmail(ctx, req.Email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logger.FromContext(r.Context()).Error("❌ Failed to load user", "error", err)
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
 	if err != nil || !utils.CheckPassword(req.Password, user.Password) {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Invalid email or password",
-		})
+		s.Audit.Record(r, models.AuditEvent{Action: models.AuditLogin, Outcome: models.AuditFailure, ActorEmail: req.Email, Reason: "invalid credentials"})
+		metrics.Logins.WithLabelValues("failure").Inc()
+		response.Fail(w, r, response.NewError(http.StatusUnauthorized, response.CodeInvalidCredentials, "Invalid email or password"))
+		return
+	}
+	if user.Disabled {
+		s.Audit.Record(r, models.AuditEvent{Action: models.AuditLogin, Outcome: models.AuditDenied, ActorID: user.ID.Hex(), ActorEmail: user.Email, Reason: "account disabled"})
+		metrics.Logins.WithLabelValues("failure").Inc()
+		response.Fail(w, r, response.NewError(http.StatusForbidden, response.CodeForbidden, "Account disabled"))
 		return
 	}
 
-	accessToken, refreshToken, err := utils.GenerateTokens(user.ID.Hex(), user.Email, user.Role, user.ImageURL)
+	accessToken, refreshToken, err := s.JWT.GenerateTokens(user.ID.Hex(), user.Email, user.Role, user.ImageURL)
 	if err != nil {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Failed to generate token",
-		})
+		response.Error(w, r, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    accessToken,
-		HttpOnly: true,
-		Path:     "/",
-		Domain:   "paodev.xyz",
-		Expires:  time.Now().Add(1 * time.Minute),
-		Secure:   false,
-		SameSite: http.SameSiteStrictMode,
-	})
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		HttpOnly: true,
-		Path:     "/",
-		Domain:   "paodev.xyz",
-		Expires:  time.Now().Add(7 * 24 * time.Hour),
-		Secure:   false,
-		SameSite: http.SameSiteStrictMode,
-	})
+	s.Cookies.SetAuthCookies(w, accessToken, refreshToken)
+	csrfToken, err := s.rotateCSRF(w, user.ID.Hex())
+	if err != nil {
+		response.Error(w, r, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditLogin, Outcome: models.AuditSuccess, ActorID: user.ID.Hex(), ActorEmail: user.Email})
+	metrics.Logins.WithLabelValues("success").Inc()
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"csrf_token": csrfToken,
 	})
 }
 
-func MeHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) MeHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(contextkey.UserID).(string)
 	if !ok || userID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		response.Error(w, r, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	var user models.User
-	err := database.UserCollection.FindOne(context.TODO(), bson.M{"_id": models.StringToObjectID(userID)}).Decode(&user)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.Store.Users.ByID(ctx, models.StringToObjectID(userID))
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		response.Error(w, r, "User not found", http.StatusNotFound)
 		return
 	}
 
@@ -165,115 +152,168 @@ func MeHandler(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: user.CreatedAt,
 	}
 
-	json.NewEncoder(w).Encode(safeUser)
+	response.JSON(w, http.StatusOK, safeUser)
 }
 
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("token")
-	if err != nil || cookie.Value == "" {
-		http.Error(w, "No token to logout", http.StatusBadRequest)
+func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	token := s.Cookies.AccessToken(r)
+	if token == "" {
+		response.Error(w, r, "No token to logout", http.StatusBadRequest)
 		return
 	}
 
 	// แบล็คลิสต์ token ตามเดิม (optional)
-	claims, err := utils.ValidateToken(cookie.Value)
+	claims, err := s.JWT.ValidateToken(token)
 	if err == nil {
-		_ = utils.BlacklistToken(cookie.Value, claims.ExpiresAt.Time) // ไม่ต้อง panic ถ้า error
+		_ = s.Store.Sessions.Revoke(r.Context(), token, claims.ExpiresAt.Time) // ไม่ต้อง panic ถ้า error
+		s.Audit.Record(r, models.AuditEvent{Action: models.AuditLogout, Outcome: models.AuditSuccess, ActorID: claims.UserID, ActorEmail: claims.Email})
 	}
 
-	// ✅ ลบ cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    "",
-		Path:     "/",
-		Domain:   "paodev.xyz",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteStrictMode,
-	})
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		Path:     "/",
-		Domain:   "paodev.xyz",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteStrictMode,
-	})
+	// ✅ ลบ cookie และเปลี่ยน CSRF token เป็นของผู้ที่ยังไม่ login
+	s.Cookies.ClearAuthCookies(w)
+	csrfToken, err := s.rotateCSRF(w, "")
+	if err != nil {
+		response.Error(w, r, "Token generation failed", http.StatusInternalServerError)
+		return
+	}
 
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Logged out successfully",
+	response.JSON(w, http.StatusOK, map[string]string{
+		"message":    "Logged out successfully",
+		"csrf_token": csrfToken,
 	})
 }
 
-func RefreshHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("refresh_token")
-	if err != nil {
-		http.Error(w, "Missing refresh token", http.StatusUnauthorized)
+func (s *Server) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	refreshToken := s.Cookies.RefreshToken(r)
+	if refreshToken == "" {
+		utils.TokenMissing()
+		metrics.Refreshes.WithLabelValues("failure").Inc()
+		response.Error(w, r, "Missing refresh token", http.StatusUnauthorized)
 		return
 	}
 
-	claims, err := utils.ValidateToken(cookie.Value)
+	claims, err := s.JWT.ValidateToken(refreshToken)
 	if err != nil {
-		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		s.Audit.Record(r, models.AuditEvent{Action: models.AuditRefresh, Outcome: models.AuditFailure, Reason: "invalid refresh token"})
+		metrics.Refreshes.WithLabelValues("failure").Inc()
+		response.Error(w, r, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if s.rejectRevoked(w, r, claims) {
+		metrics.Refreshes.WithLabelValues("failure").Inc()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// อ่าน user ใหม่ทุกครั้ง ให้ role ที่เปลี่ยนผ่าน CLI มีผลตั้งแต่ refresh ครั้งถัดไป และกัน user ที่ถูก disable
+	user, err := s.Store.Users.ByID(ctx, models.StringToObjectID(claims.UserID))
+	if err != nil || user.Disabled {
+		s.Audit.Record(r, models.AuditEvent{Action: models.AuditRefresh, Outcome: models.AuditFailure, ActorID: claims.UserID, Reason: "user not found or disabled"})
+		metrics.Refreshes.WithLabelValues("failure").Inc()
+		response.Error(w, r, "Invalid refresh token", http.StatusUnauthorized)
 		return
 	}
+
 	// Generate access token ใหม่
-	accessToken, _, err := utils.GenerateTokens(claims.UserID, claims.Email, claims.Role, claims.ImageURL)
+	accessToken, _, err := s.JWT.GenerateTokens(user.ID.Hex(), user.Email, user.Role, user.ImageURL)
 	if err != nil {
-		http.Error(w, "Token generation failed", http.StatusInternalServerError)
+		response.Error(w, r, "Token generation failed", http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    accessToken,
-		HttpOnly: true,
-		Path:     "/",
-		Domain:   "paodev.xyz",
-		Expires:  claims.ExpiresAt.Time,
-		Secure:   false,
-		SameSite: http.SameSiteStrictMode,
-	})
+	s.Cookies.SetAccessCookie(w, accessToken)
+	csrfToken, err := s.rotateCSRF(w, user.ID.Hex())
+	if err != nil {
+		response.Error(w, r, "Token generation failed", http.StatusInternalServerError)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRefresh, Outcome: models.AuditSuccess, ActorID: claims.UserID, ActorEmail: claims.Email})
+	metrics.Refreshes.WithLabelValues("success").Inc()
+	response.JSON(w, http.StatusOK, map[string]string{
+		"csrf_token": csrfToken,
+	})
 }
 
-func UsersHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) UsersHandler(w http.ResponseWriter, r *http.Request) {
 	idsParam := r.URL.Query().Get("ids")
 	if idsParam == "" {
-		http.Error(w, "Missing ids parameter", http.StatusBadRequest)
+		response.Error(w, r, "Missing ids parameter", http.StatusBadRequest)
 		return
 	}
 
-	idList := strings.Split(idsParam, ",")
-
-	// สร้าง filter: {"id": {"$in": [id1, id2, id3]}}
-	filter := bson.M{
-		"id": bson.M{
-			"$in": idList,
-		},
+	var ids []primitive.ObjectID
+	for _, raw := range strings.Split(idsParam, ",") {
+		id, err := primitive.ObjectIDFromHex(strings.TrimSpace(raw))
+		if err != nil {
+			response.Error(w, r, "Invalid user ID: "+raw, http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	cursor, err := database.UserCollection.Find(ctx, filter)
+	users, err := s.Store.Users.ByIDs(ctx, ids)
 	if err != nil {
-		http.Error(w, "Error fetching users", http.StatusInternalServerError)
+		response.Error(w, r, "Error fetching users", http.StatusInternalServerError)
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var users []bson.M
-	if err := cursor.All(ctx, &users); err != nil {
-		http.Error(w, "Error decoding users", http.StatusInternalServerError)
-		return
+	// ส่งเฉพาะข้อมูลสาธารณะ ไม่ให้ password hash หลุดออกไป
+	safeUsers := make([]models.SafeUser, 0, len(users))
+	for _, u := range users {
+		safeUsers = append(safeUsers, u.ToSafeUser())
+	}
+	response.JSON(w, http.StatusOK, safeUsers)
+}
+
+// rejectRevoked ตอบ 401 ถ้า session ของ user ถูกเพิกถอนหลังจากออก token นี้ คืน true ถ้าตอบไปแล้ว
+func (s *Server) rejectRevoked(w http.ResponseWriter, r *http.Request, claims *utils.Claims) bool {
+	revoked, err := utils.SessionRevoked(r.Context(), s.Store.Sessions, claims)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("❌ Session revocation check failed", "error", err)
+		response.Error(w, r, "Server error", http.StatusInternalServerError)
+		return true
+	}
+	if revoked {
+		response.Error(w, r, "Token revoked", http.StatusUnauthorized)
+		return true
+	}
+	return false
+}
+
+// GET /auth/csrf — ให้ SPA ขอ CSRF token ไปใส่ header X-CSRF-Token ทุกครั้งที่ส่ง request ที่เปลี่ยน state
+// ถ้า cookie เดิมยังใช้ได้กับ session นี้จะคืน token เดิม เพื่อไม่ให้แท็บอื่นที่เปิดอยู่พัง
+func (s *Server) CSRFTokenHandler(w http.ResponseWriter, r *http.Request) {
+	subject := utils.CSRFSubject(r, s.Cookies, s.JWT)
+	token := s.Cookies.CSRFToken(r)
+	if !s.CSRF.Valid(token, subject) {
+		var err error
+		token, err = s.CSRF.NewToken(subject)
+		if err != nil {
+			response.Error(w, r, "Token generation failed", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	s.Cookies.SetCSRFCookie(w, token)
+	w.Header().Set("Cache-Control", "no-store")
+	response.JSON(w, http.StatusOK, map[string]string{
+		"csrf_token": token,
+	})
+}
+
+// rotateCSRF ออก CSRF token ใหม่ให้ subject แล้วตั้ง cookie ใช้ทุกครั้งที่ session เปลี่ยน (login, refresh, logout)
+// token เก่าที่อาจถูกวางไว้ก่อน login จะได้ใช้ต่อไม่ได้
+func (s *Server) rotateCSRF(w http.ResponseWriter, subject string) (string, error) {
+	token, err := s.CSRF.NewToken(subject)
+	if err != nil {
+		return "", err
+	}
+	s.Cookies.SetCSRFCookie(w, token)
+	return token, nil
 }
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"mychat-auth/types"
+)
+
+func TestRegisterLoginMe(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.signUp("alice@example.com", "member")
+
+	me := decode[types.SafeUser](t, alice.expect(http.StatusOK, "GET", "/me", nil))
+	if me.ID != alice.userID || me.Email != "alice@example.com" || me.Role != "member" {
+		t.Fatalf("GET /me = %+v, want alice as member", me)
+	}
+
+	anon := env.client()
+	anon.expect(http.StatusUnauthorized, "GET", "/me", nil)
+	anon.expect(http.StatusConflict, "POST", "/register", map[string]string{"email": "alice@example.com", "password": "password123"})
+	anon.expect(http.StatusUnprocessableEntity, "POST", "/register", map[string]string{"email": "not-an-email", "password": "password123"})
+	anon.expect(http.StatusUnauthorized, "POST", "/login", map[string]string{"email": "alice@example.com", "password": "wrong-password"})
+	anon.expect(http.StatusUnauthorized, "POST", "/login", map[string]string{"email": "nobody@example.com", "password": "password123"})
+}
+
+func TestCSRFTokenBoundToSession(t *testing.T) {
+	env := newTestEnv(t)
+	env.signUp("alice@example.com", "member")
+
+	c := env.client()
+	anonToken := c.csrf
+	c.do("POST", "/register", map[string]string{"email": "bob@example.com", "password": "password123"})
+	c.login("bob@example.com", "password123")
+	if c.csrf == anonToken {
+		t.Fatal("login did not rotate the CSRF token")
+	}
+
+	// token ที่ได้ก่อน login ใช้กับ session ของ bob ไม่ได้
+	loggedIn := c.csrf
+	c.csrf = anonToken
+	c.expect(http.StatusForbidden, "POST", "/auth/refresh", nil)
+
+	// token ไม่มีก็ไม่ได้
+	c.csrf = ""
+	c.expect(http.StatusForbidden, "POST", "/auth/refresh", nil)
+
+	c.csrf = loggedIn
+	refreshed := decode[map[string]string](t, c.expect(http.StatusOK, "POST", "/auth/refresh", nil))["csrf_token"]
+	if refreshed == "" || refreshed == loggedIn {
+		t.Fatalf("refresh returned csrf_token %q, want a new token", refreshed)
+	}
+	c.csrf = refreshed
+
+	// ขอ token ซ้ำได้ token เดิมตราบที่ยังเป็น session เดียวกัน
+	if got := decode[map[string]string](t, c.expect(http.StatusOK, "GET", "/auth/csrf", nil))["csrf_token"]; got != refreshed {
+		t.Fatalf("GET /auth/csrf = %q, want the current token %q", got, refreshed)
+	}
+
+	// token ของ alice ใช้กับ cookie ของ bob ไม่ได้
+	alice := env.client()
+	alice.login("alice@example.com", "password123")
+	c.csrf = alice.csrf
+	c.expect(http.StatusForbidden, "POST", "/logout", nil)
+
+	c.csrf = refreshed
+	out := decode[map[string]string](t, c.expect(http.StatusOK, "POST", "/logout", nil))
+	if out["csrf_token"] == "" || out["csrf_token"] == refreshed {
+		t.Fatalf("logout returned csrf_token %q, want a new anonymous token", out["csrf_token"])
+	}
+	c.expect(http.StatusUnauthorized, "GET", "/me", nil)
+}
+
+func TestLoginRequiresCSRFToken(t *testing.T) {
+	env := newTestEnv(t)
+	env.signUp("alice@example.com", "member")
+
+	// client ที่ยังไม่เคยเรียก GET /auth/csrf ส่ง login/register ไม่ได้
+	c := &testClient{env: env, cookies: map[string]*http.Cookie{}}
+	c.expect(http.StatusForbidden, "POST", "/login", map[string]string{"email": "alice@example.com", "password": "password123"})
+	c.expect(http.StatusForbidden, "POST", "/register", map[string]string{"email": "bob@example.com", "password": "password123"})
+
+	c.csrf = decode[map[string]string](t, c.expect(http.StatusOK, "GET", "/auth/csrf", nil))["csrf_token"]
+	c.login("alice@example.com", "password123")
+}
+
+func TestRefreshRequiresRefreshCookie(t *testing.T) {
+	env := newTestEnv(t)
+	env.client().expect(http.StatusUnauthorized, "POST", "/auth/refresh", nil)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mychat-auth/models"
+	"mychat-auth/shared/logger"
+	"mychat-auth/shared/response"
+	"mychat-auth/store"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// POST /dms — เริ่ม DM กับคนหนึ่งคนหรือกลุ่มเล็ก ถ้าคนกลุ่มนี้มี DM อยู่แล้วคืนห้องเดิม
+// ห้องที่ได้ใช้ผ่าน WebSocket และ GET /rooms/{id}/messages ได้เหมือนห้องปกติ
+func (s *Server) CreateDMHandler(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		UserIDs []string `json:"user_ids" validate:"required,min=1,max=9"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		response.Validation(w, r, err)
+		return
+	}
+
+	participants := []primitive.ObjectID{callerID}
+	seen := map[primitive.ObjectID]bool{callerID: true}
+	for _, raw := range req.UserIDs {
+		id, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			response.Error(w, r, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			participants = append(participants, id)
+		}
+	}
+	if len(participants) < 2 {
+		response.Error(w, r, "A direct message needs at least one other user", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	key := models.DMKey(participants)
+	existing, found, ok := s.existingDM(ctx, w, r, key, callerID)
+	if !ok {
+		return
+	}
+	if found {
+		response.JSON(w, http.StatusOK, existing)
+		return
+	}
+
+	users, err := s.Store.Users.ByIDs(ctx, participants)
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+	members := make([]models.RoomMember, 0, len(users))
+	for _, u := range users {
+		if u.Disabled {
+			continue
+		}
+		members = append(members, models.RoomMember{SafeUser: u.ToSafeUser(), Role: models.RoomRoleMember})
+	}
+	if len(members) != len(participants) {
+		response.Error(w, r, "User not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	room := models.Room{
+		Name:           models.DMName(key),
+		Type:           models.RoomTypeDM,
+		DMKey:          key,
+		Members:        members,
+		CreatedAt:      now,
+		LastActivityAt: &now,
+	}
+	err = s.Store.Rooms.Create(ctx, &room)
+	if errors.Is(err, store.ErrConflict) {
+		// อีกคนเพิ่งสร้าง DM ของกลุ่มเดียวกันไปพร้อมกัน ใช้ห้องนั้นแทน
+		existing, found, ok = s.existingDM(ctx, w, r, key, callerID)
+		if !ok {
+			return
+		}
+		if !found {
+			// ชนกับชื่อห้องเก่าที่ตั้งไว้ก่อนมีการสงวนชื่อ dm:
+			response.Error(w, r, "Direct message name is taken by another room", http.StatusConflict)
+			return
+		}
+		response.JSON(w, http.StatusOK, existing)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "Failed to create direct message", http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("💬 Direct message started", "room_id", room.ID.Hex(), "participants", len(participants))
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditDMCreate, Outcome: models.AuditSuccess, ActorID: callerID.Hex(), TargetType: "room", TargetID: room.ID.Hex()})
+	response.JSON(w, http.StatusCreated, room)
+}
+
+// existingDM หา DM เดิมของกลุ่มตาม key found false คือยังไม่มี ok false คือตอบ error ให้แล้ว
+// ตรวจซ้ำว่าเป็นห้องแบบ dm ที่ผู้เรียกเป็นสมาชิกจริง ไม่ส่งห้องของคนอื่นออกไปแม้ข้อมูลจะผิดปกติ
+func (s *Server) existingDM(ctx context.Context, w http.ResponseWriter, r *http.Request, key string, callerID primitive.ObjectID) (models.Room, bool, bool) {
+	room, err := s.Store.Rooms.DMByKey(ctx, key)
+	if errors.Is(err, store.ErrNotFound) {
+		return room, false, true
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return room, false, false
+	}
+	if room.Type != models.RoomTypeDM || !room.IsMember(callerID) {
+		logger.FromContext(r.Context()).Warn("⚠️ DM key matched a room the caller cannot use", "room_id", room.ID.Hex(), "user_id", callerID.Hex())
+		response.Error(w, r, "Direct message name is taken by another room", http.StatusConflict)
+		return room, false, false
+	}
+	return room, true, true
+}
+
+// GET /dms — inbox ของผู้เรียก เรียงจาก DM ที่มีข้อความล่าสุด
+func (s *Server) GetDMsHandler(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rooms, err := s.Store.Rooms.ListDMs(ctx, callerID)
+	if err != nil {
+		response.Error(w, r, "Failed to fetch direct messages", http.StatusInternalServerError)
+		return
+	}
+	response.JSON(w, http.StatusOK, rooms)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"mychat-auth/shared/response"
+)
+
+type dependencyStatus struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// GET /healthz — liveness: process ยังตอบได้ ไม่ตรวจ dependency
+func (s *Server) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	response.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// GET /readyz — readiness: Mongo, Redis ต้อง ping ได้ และต้องมี key สำหรับเซ็น token
+// ระหว่าง shutdown จะตอบ 503 เพื่อให้ load balancer เลิกส่ง traffic มา
+func (s *Server) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	checks := map[string]dependencyStatus{}
+	for name, ping := range s.ReadyChecks {
+		checks[name] = checkDependency(ctx, ping)
+	}
+	if s.JWT.Ready() {
+		checks["keys"] = dependencyStatus{Status: "ok"}
+	} else {
+		checks["keys"] = dependencyStatus{Status: "fail", Error: "signing key not loaded"}
+	}
+	if s.draining.Load() || s.hub.isClosing() {
+		checks["server"] = dependencyStatus{Status: "fail", Error: "shutting down"}
+	}
+
+	status, code := "ok", http.StatusOK
+	for _, c := range checks {
+		if c.Status != "ok" {
+			status, code = "fail", http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	response.JSON(w, code, map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+func checkDependency(ctx context.Context, ping func(context.Context) error) dependencyStatus {
+	start := time.Now()
+	err := ping(ctx)
+	latency := time.Since(start).Milliseconds()
+	if err != nil {
+		return dependencyStatus{Status: "fail", LatencyMS: latency, Error: err.Error()}
+	}
+	return dependencyStatus{Status: "ok", LatencyMS: latency}
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"mychat-auth/metrics"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = 54 * time.Second
+	wsSendBuffer = 64
+	// wsReadLimit คือขนาดสูงสุดของ event หนึ่งตัวจาก client (ทั้ง frame) ต้องพอสำหรับข้อความยาว maxMessageLength
+	// ที่เป็นอักษร 3 byte (เช่นภาษาไทย) หรือถูก escape เป็น \uXXXX รวมกับ field อื่นของ event
+	wsReadLimit = 16 << 10
+)
+
+// wsClient คือ WebSocket หนึ่ง connection มี goroutine เขียนของตัวเอง (writePump)
+// เพื่อไม่ให้หลาย goroutine เขียน conn พร้อมกัน และให้ flush คิวได้ก่อนปิด
+type wsClient struct {
+	conn   *websocket.Conn
+	connID string // ใช้โยง log ของ connection นี้กับที่ client รายงานมา
+	userID string
+	send   chan []byte
+
+	quit      chan struct{}
+	quitOnce  sync.Once
+	closeCode int
+	closeText string
+	done      chan struct{}
+}
+
+func newWSClient(conn *websocket.Conn, connID, userID string) *wsClient {
+	return &wsClient{
+		conn:   conn,
+		connID: connID,
+		userID: userID,
+		send:   make(chan []byte, wsSendBuffer),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// enqueue ใส่ข้อความเข้าคิวแบบไม่ block คืน false ถ้าคิวเต็ม (client ช้าเกินไป) หรือกำลังปิด
+func (c *wsClient) enqueue(data []byte) bool {
+	select {
+	case <-c.quit:
+		return false
+	default:
+	}
+	select {
+	case c.send <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendJSON แปลง v เป็น JSON แล้วเข้าคิว ใช้กับ event ที่ส่งถึง client คนเดียว
+func (c *wsClient) sendJSON(v interface{}) bool {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	return c.enqueue(data)
+}
+
+// close สั่งให้ writePump flush คิวที่ค้าง ส่ง close frame ตาม code แล้วปิด conn
+func (c *wsClient) close(code int, text string) {
+	c.quitOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+		close(c.quit)
+	})
+}
+
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+		close(c.done)
+	}()
+
+	for {
+		select {
+		case data := <-c.send:
+			if err := c.write(data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-c.quit:
+			c.flush()
+			msg := websocket.FormatCloseMessage(c.closeCode, c.closeText)
+			c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+			return
+		}
+	}
+}
+
+// flush เขียนทุกข้อความที่ยังค้างในคิวก่อนปิด
+func (c *wsClient) flush() {
+	for {
+		select {
+		case data := <-c.send:
+			if err := c.write(data); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (c *wsClient) write(data []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// hub เก็บ connection ทั้งหมดและห้องที่แต่ละ connection subscribe อยู่
+type hub struct {
+	mu sync.Mutex
+	// roomID -> client -> userID
+	roomConnections map[string]map[*wsClient]string
+	clients         map[*wsClient]struct{}
+	closing         bool
+	// นับข้อความที่กำลังบันทึก/กระจายอยู่ ตอน shutdown ต้องรอให้หมดก่อนปิด socket
+	inflight sync.WaitGroup
+}
+
+func newHub() *hub {
+	return &hub{
+		roomConnections: make(map[string]map[*wsClient]string),
+		clients:         make(map[*wsClient]struct{}),
+	}
+}
+
+func (h *hub) isClosing() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.closing
+}
+
+// register คืน false ถ้า server กำลังปิด
+func (h *hub) register(c *wsClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return false
+	}
+	h.clients[c] = struct{}{}
+	metrics.WSActiveConnections.Inc()
+	return true
+}
+
+func (h *hub) unregister(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		metrics.WSActiveConnections.Dec()
+	}
+	for roomID := range h.roomConnections {
+		h.removeLocked(roomID, c)
+	}
+}
+
+// removeLocked ถอด c ออกจากห้อง ผู้เรียกต้องถือ h.mu
+func (h *hub) removeLocked(roomID string, c *wsClient) {
+	conns := h.roomConnections[roomID]
+	if _, ok := conns[c]; ok {
+		delete(conns, c)
+		metrics.WSRoomSubscriptions.Dec()
+		slog.Debug("❌ Disconnected from room", "room_id", roomID, "conn_id", c.connID)
+	}
+	if conns != nil && len(conns) == 0 {
+		delete(h.roomConnections, roomID)
+		metrics.WSActiveRooms.Dec()
+	}
+}
+
+// leave ยกเลิกการ subscribe ห้องของ connection เดียว
+func (h *hub) leave(roomID string, c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(roomID, c)
+}
+
+// leaveUser ถอดทุก connection ของ user ออกจากห้อง ใช้ตอนเขาไม่ได้เป็นสมาชิกแล้ว (เช่น ถูกเตะ)
+// คืน connection ที่ถูกถอดเพื่อให้ผู้เรียกแจ้ง client ได้
+func (h *hub) leaveUser(roomID, userID string) []*wsClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var removed []*wsClient
+	for c, uid := range h.roomConnections[roomID] {
+		if uid == userID {
+			removed = append(removed, c)
+		}
+	}
+	for _, c := range removed {
+		h.removeLocked(roomID, c)
+	}
+	return removed
+}
+
+// closeRoom ถอดทุก connection ออกจากห้อง ใช้ตอนห้องถูกลบ
+func (h *hub) closeRoom(roomID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.roomConnections[roomID] {
+		h.removeLocked(roomID, c)
+	}
+}
+
+func (h *hub) join(roomID string, c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.roomConnections[roomID]; !ok {
+		h.roomConnections[roomID] = make(map[*wsClient]string)
+		metrics.WSActiveRooms.Inc()
+	}
+	if _, ok := h.roomConnections[roomID][c]; !ok {
+		metrics.WSRoomSubscriptions.Inc()
+	}
+	h.roomConnections[roomID][c] = c.userID
+}
+
+// roomCounts คืนจำนวน connection ที่ subscribe แต่ละห้องอยู่ ณ ตอนนี้
+func (h *hub) roomCounts() map[string]int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	counts := make(map[string]int, len(h.roomConnections))
+	for roomID, conns := range h.roomConnections {
+		counts[roomID] = len(conns)
+	}
+	return counts
+}
+
+// beginWork นับงานที่กำลังทำ คืน false ถ้ากำลังปิดแล้ว (ไม่รับข้อความใหม่)
+func (h *hub) beginWork() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return false
+	}
+	h.inflight.Add(1)
+	return true
+}
+
+func (h *hub) endWork() {
+	h.inflight.Done()
+}
+
+// broadcast ส่ง data ให้ทุก connection ในห้อง client ที่คิวเต็มจะถูกตัดออก
+func (h *hub) broadcast(roomID string, data []byte) (delivered, dropped int) {
+	h.mu.Lock()
+	targets := make([]*wsClient, 0, len(h.roomConnections[roomID]))
+	for c := range h.roomConnections[roomID] {
+		targets = append(targets, c)
+	}
+	h.mu.Unlock()
+
+	slog.Debug("📢 Broadcasting", "room_id", roomID, "connections", len(targets))
+	for _, c := range targets {
+		if c.enqueue(data) {
+			delivered++
+			metrics.WSMessages.WithLabelValues("broadcast").Inc()
+		} else {
+			dropped++
+			metrics.WSMessages.WithLabelValues("dropped").Inc()
+			slog.Warn("WebSocket send queue full, dropping client", "room_id", roomID, "user_id", c.userID, "conn_id", c.connID)
+			c.close(websocket.ClosePolicyViolation, "too slow")
+		}
+	}
+	return delivered, dropped
+}
+
+// shutdown หยุดรับข้อความใหม่ รอข้อความที่กำลังบันทึกให้เสร็จ
+// แล้วส่ง close frame "going away" ให้ทุก client หลัง flush คิวของแต่ละคน
+func (h *hub) shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.closing = true
+	clients := make([]*wsClient, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.Unlock()
+
+	// ให้ ReadJSON ที่ค้างอยู่หลุดทันที read loop จะจบเองหลังทำข้อความปัจจุบันเสร็จ
+	for _, c := range clients {
+		c.conn.SetReadDeadline(time.Now())
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		h.inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for _, c := range clients {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+	for _, c := range clients {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	slog.Info("🔌 All WebSocket connections closed", "count", len(clients))
+	return nil
+}
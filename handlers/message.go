@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mychat-auth/models"
+	"mychat-auth/shared/logger"
+	"mychat-auth/shared/response"
+	"mychat-auth/store"
+	"mychat-auth/tracing"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxMessageLength คือความยาวสูงสุดของเนื้อหาข้อความ (นับเป็นตัวอักษร) ใช้ทั้งตอนส่งและตอนแก้
+// แยกจาก wsReadLimit ซึ่งเป็นขนาดของทั้ง frame รวม JSON ที่ห่อข้อความอยู่
+const maxMessageLength = 2000
+
+// checkMessageLength ตรวจความยาวเนื้อหาข้อความตาม maxMessageLength
+func checkMessageLength(content string) *response.APIError {
+	if utf8.RuneCountInString(content) > maxMessageLength {
+		return response.NewError(http.StatusBadRequest, response.CodeBadRequest, "Message is too long")
+	}
+	return nil
+}
+
+// PATCH /rooms/{id}/messages/{messageID} — เจ้าของข้อความแก้เนื้อหาได้จนกว่าข้อความจะถูกลบ
+func (s *Server) EditMessageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, callerID, _, ok := s.loadRoomAsMember(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	msg, apiErr := s.editMessage(ctx, r, room, callerID, r.PathValue("messageID"), req.Content)
+	if apiErr != nil {
+		response.Fail(w, r, apiErr)
+		return
+	}
+	response.JSON(w, http.StatusOK, msg)
+}
+
+// DELETE /rooms/{id}/messages/{messageID} — เจ้าของข้อความหรือ moderator/owner ของห้อง
+// ข้อความเหลือเป็น tombstone ไม่ได้หายไปจากประวัติ
+func (s *Server) DeleteMessageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, callerID, role, ok := s.loadRoomAsMember(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	if _, apiErr := s.deleteMessage(ctx, r, room, callerID, role, r.PathValue("messageID")); apiErr != nil {
+		response.Fail(w, r, apiErr)
+		return
+	}
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Message deleted"})
+}
+
+// GET /rooms/{id}/messages/{messageID}/edits — ประวัติการแก้ ดูได้เฉพาะเจ้าของข้อความและ moderator/owner
+func (s *Server) MessageEditsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, callerID, role, ok := s.loadRoomAsMember(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	msg, apiErr := s.loadMessage(ctx, room.ID, r.PathValue("messageID"))
+	if apiErr != nil {
+		response.Fail(w, r, apiErr)
+		return
+	}
+	if msg.SenderID != callerID && !models.CanModerate(role) {
+		response.Error(w, r, "Forbidden: cannot view this message's history", http.StatusForbidden)
+		return
+	}
+
+	edits := msg.Edits
+	if edits == nil {
+		edits = []models.MessageEdit{}
+	}
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": msg,
+		"edits":   edits,
+	})
+}
+
+// GET /rooms/{id}/messages/{messageID}/thread — ข้อความต้นของ thread พร้อม reply
+// แบ่งหน้าด้วย ?limit= ?before= ?after= ?around= แบบเดียวกับประวัติห้อง ถ้า messageID เป็น reply จะได้ thread ที่มันอยู่
+func (s *Server) MessageThreadHandler(w http.ResponseWriter, r *http.Request) {
+	page, ok := parseMessagePage(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, _, _, ok := s.loadRoomAsMember(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	root, apiErr := s.threadRoot(ctx, room.ID, r.PathValue("messageID"))
+	if apiErr != nil {
+		response.Fail(w, r, apiErr)
+		return
+	}
+
+	replies, hasOlder, hasNewer, apiErr := s.listMessagePage(ctx, room.ID, &root.ID, page)
+	if apiErr != nil {
+		response.Fail(w, r, apiErr)
+		return
+	}
+
+	logger.FromContext(r.Context()).Debug("✅ Thread fetched", "room_id", room.ID.Hex(), "parent_id", root.ID.Hex(), "count", len(replies))
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"parent":    root,
+		"messages":  replies,
+		"has_older": hasOlder,
+		"has_newer": hasNewer,
+		"limit":     page.limit,
+	})
+}
+
+// loadMessage แปลง ID และโหลดข้อความในห้อง คืน error ที่พร้อมส่งให้ client
+func (s *Server) loadMessage(ctx context.Context, roomID primitive.ObjectID, messageIDHex string) (models.Message, *response.APIError) {
+	messageID, err := primitive.ObjectIDFromHex(messageIDHex)
+	if err != nil {
+		return models.Message{}, response.NewError(http.StatusBadRequest, response.CodeBadRequest, "Invalid message ID")
+	}
+	msg, err := s.Store.Messages.ByID(ctx, roomID, messageID)
+	if errors.Is(err, store.ErrNotFound) {
+		return msg, response.NewError(http.StatusNotFound, response.CodeNotFound, "Message not found")
+	}
+	if err != nil {
+		return msg, response.NewError(http.StatusInternalServerError, response.CodeInternal, "DB error")
+	}
+	return msg, nil
+}
+
+// threadRoot คืนข้อความต้นของ thread ที่ messageIDHex อยู่ ถ้าเป็น reply จะขึ้นไปหาต้น thread ให้
+// ข้อความนอก thread ก็เป็นต้น thread ของตัวเองได้เสมอ
+func (s *Server) threadRoot(ctx context.Context, roomID primitive.ObjectID, messageIDHex string) (models.Message, *response.APIError) {
+	msg, apiErr := s.loadMessage(ctx, roomID, messageIDHex)
+	if apiErr != nil || msg.ParentID == nil {
+		return msg, apiErr
+	}
+	return s.loadMessage(ctx, roomID, msg.ParentID.Hex())
+}
+
+// addReply อัปเดตจำนวน reply ของต้น thread แล้วแจ้ง thread_updated ให้ client อัปเดตตัวอย่าง thread
+// ถ้าอัปเดตไม่ได้ reply ก็ถูกส่งไปแล้ว แค่ตัวนับคลาดไป จึงแค่ log ไว้
+func (s *Server) addReply(ctx context.Context, reply models.Message) {
+	parent, err := s.Store.Messages.AddReply(ctx, reply.RoomID, *reply.ParentID, reply.CreatedAt)
+	if err != nil {
+		logger.FromContext(ctx).Warn("⚠️ Failed to update thread summary", "room_id", reply.RoomID.Hex(), "parent_id", reply.ParentID.Hex(), "error", err)
+		return
+	}
+	s.broadcastMessageEvent(ctx, messageEventThreadUpdated, parent)
+}
+
+// removeReply อัปเดตตัวอย่าง thread หลัง reply ถูกลบ แล้วแจ้ง thread_updated
+// ถ้าอัปเดตไม่ได้ reply ก็ถูกลบไปแล้ว แค่ตัวนับคลาดไป จึงแค่ log ไว้
+func (s *Server) removeReply(ctx context.Context, reply models.Message) {
+	parent, err := s.Store.Messages.RemoveReply(ctx, reply.RoomID, *reply.ParentID)
+	if err != nil {
+		logger.FromContext(ctx).Warn("⚠️ Failed to update thread summary", "room_id", reply.RoomID.Hex(), "parent_id", reply.ParentID.Hex(), "error", err)
+		return
+	}
+	s.broadcastMessageEvent(ctx, messageEventThreadUpdated, parent)
+}
+
+// editMessage แก้ข้อความของผู้เรียกเองแล้วแจ้ง message_updated ใช้ร่วมกันทั้ง REST และ WebSocket
+// r คือ request ที่ใช้บันทึก audit (สำหรับ WebSocket คือ request ตอน upgrade)
+func (s *Server) editMessage(ctx context.Context, r *http.Request, room models.Room, callerID primitive.ObjectID, messageIDHex, content string) (models.Message, *response.APIError) {
+	if room.Archived {
+		return models.Message{}, response.NewError(http.StatusConflict, response.CodeConflict, "Room is archived")
+	}
+	if strings.TrimSpace(content) == "" {
+		return models.Message{}, response.NewError(http.StatusBadRequest, response.CodeBadRequest, "Message content is required")
+	}
+	if apiErr := checkMessageLength(content); apiErr != nil {
+		return models.Message{}, apiErr
+	}
+
+	msg, apiErr := s.loadMessage(ctx, room.ID, messageIDHex)
+	if apiErr != nil {
+		return msg, apiErr
+	}
+	if msg.IsDeleted() {
+		return msg, response.NewError(http.StatusConflict, response.CodeConflict, "Message has been deleted")
+	}
+	if msg.SenderID != callerID {
+		return msg, response.NewError(http.StatusForbidden, response.CodeForbidden, "Forbidden: cannot edit this message")
+	}
+	// เนื้อหาเดิมไม่ต้องเขียนซ้ำหรือแจ้งใคร
+	if msg.Content == content {
+		return msg, nil
+	}
+
+	updated, err := s.Store.Messages.Edit(ctx, room.ID, msg.ID, content, time.Now(), s.Config.Chat.KeepEditHistory)
+	if errors.Is(err, store.ErrNotFound) {
+		// ถูกลบไประหว่างที่กำลังแก้
+		return msg, response.NewError(http.StatusConflict, response.CodeConflict, "Message has been deleted")
+	}
+	if err != nil {
+		return msg, response.NewError(http.StatusInternalServerError, response.CodeInternal, "DB error")
+	}
+
+	s.broadcastMessageEvent(ctx, messageEventUpdated, updated)
+	logger.FromContext(ctx).Info("✏️ Message edited", "room_id", room.ID.Hex(), "message_id", msg.ID.Hex())
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditMessageEdit, Outcome: models.AuditSuccess, ActorID: callerID.Hex(), TargetType: "message", TargetID: msg.ID.Hex(), Metadata: map[string]string{"room_id": room.ID.Hex()}})
+	return updated, nil
+}
+
+// deleteMessage ลบข้อความเหลือ tombstone แล้วแจ้ง message_deleted ใช้ร่วมกันทั้ง REST และ WebSocket
+// เจ้าของข้อความลบของตัวเองได้ moderator/owner ลบของคนอื่นได้ ลบซ้ำถือว่าสำเร็จ
+func (s *Server) deleteMessage(ctx context.Context, r *http.Request, room models.Room, callerID primitive.ObjectID, role, messageIDHex string) (models.Message, *response.APIError) {
+	if room.Archived {
+		return models.Message{}, response.NewError(http.StatusConflict, response.CodeConflict, "Room is archived")
+	}
+
+	msg, apiErr := s.loadMessage(ctx, room.ID, messageIDHex)
+	if apiErr != nil {
+		return msg, apiErr
+	}
+	if msg.SenderID != callerID && !models.CanModerate(role) {
+		return msg, response.NewError(http.StatusForbidden, response.CodeForbidden, "Forbidden: cannot delete this message")
+	}
+	if msg.IsDeleted() {
+		return msg, nil
+	}
+
+	deleted, err := s.Store.Messages.SoftDelete(ctx, room.ID, msg.ID, callerID, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		// มีคนลบไปก่อนแล้ว ผลลัพธ์เหมือนกัน
+		return msg, nil
+	}
+	if err != nil {
+		return msg, response.NewError(http.StatusInternalServerError, response.CodeInternal, "DB error")
+	}
+
+	s.broadcastMessageEvent(ctx, messageEventDeleted, deleted)
+	if deleted.ParentID != nil {
+		s.removeReply(ctx, deleted)
+	}
+	logger.FromContext(ctx).Info("🗑️ Message deleted", "room_id", room.ID.Hex(), "message_id", msg.ID.Hex(), "by_sender", msg.SenderID == callerID)
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditMessageDelete, Outcome: models.AuditSuccess, ActorID: callerID.Hex(), TargetType: "message", TargetID: msg.ID.Hex(), Metadata: map[string]string{"room_id": room.ID.Hex(), "sender_id": msg.SenderID.Hex()}})
+	return deleted, nil
+}
+
+// ชนิดของ event เมื่อข้อความที่ส่งไปแล้วเปลี่ยน thread_updated ส่งต้น thread ที่จำนวน reply เปลี่ยน
+const (
+	messageEventUpdated       = "message_updated"
+	messageEventDeleted       = "message_deleted"
+	messageEventThreadUpdated = "thread_updated"
+)
+
+// messageEvent ส่งข้อความทั้งตัวหลังเปลี่ยน client แทนที่ของเดิมด้วย ID ได้เลย
+type messageEvent struct {
+	Type    string         `json:"type"`
+	RoomID  string         `json:"room_id"`
+	Message models.Message `json:"message"`
+}
+
+// broadcastMessageEvent ส่ง event ของข้อความให้ทุก connection ที่ subscribe ห้องนั้นบน instance นี้
+func (s *Server) broadcastMessageEvent(ctx context.Context, eventType string, message models.Message) {
+	_, span := tracing.Start(ctx, "ws.message_event", trace.WithAttributes(
+		attribute.String("chat.room_id", message.RoomID.Hex()),
+		attribute.String("chat.message_id", message.ID.Hex()),
+		attribute.String("chat.event", eventType),
+	))
+	defer span.End()
+
+	data, _ := json.Marshal(messageEvent{Type: eventType, RoomID: message.RoomID.Hex(), Message: message})
+	delivered, dropped := s.hub.broadcast(message.RoomID.Hex(), data)
+	span.SetAttributes(
+		attribute.Int("chat.recipients", delivered),
+		attribute.Int("chat.dropped", dropped),
+	)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"mychat-auth/models"
+)
+
+// messagePageResponse คือรูปแบบที่ GET /rooms/{id}/messages และ /thread ตอบ
+type messagePageResponse struct {
+	Parent   *models.Message  `json:"parent"`
+	Messages []models.Message `json:"messages"`
+	HasOlder bool             `json:"has_older"`
+	HasNewer bool             `json:"has_newer"`
+}
+
+// messageRoom สร้างห้อง public ที่ alice และ bob เป็นสมาชิก
+func messageRoom(t *testing.T) (env *testEnv, room models.Room, alice, bob *testClient) {
+	t.Helper()
+	env = newTestEnv(t)
+	admin := env.signUp("admin@example.com", "admin")
+	alice = env.signUp("alice@example.com", "member")
+	bob = env.signUp("bob@example.com", "member")
+	room = admin.createRoom("general", models.RoomTypePublic)
+	alice.expect(http.StatusOK, "POST", "/rooms/"+room.ID.Hex()+"/join", nil)
+	bob.expect(http.StatusOK, "POST", "/rooms/"+room.ID.Hex()+"/join", nil)
+	return env, room, alice, bob
+}
+
+func TestMessageHistoryPaging(t *testing.T) {
+	env, room, alice, _ := messageRoom(t)
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	var sent []models.Message
+	for i, content := range []string{"m0", "m1", "m2", "m3", "m4"} {
+		sent = append(sent, env.postMessage(room.ID, alice, content, base.Add(time.Duration(i)*time.Second), nil))
+	}
+	env.postMessage(room.ID, alice, "reply", base.Add(time.Minute), &sent[0].ID)
+
+	path := "/rooms/" + room.ID.Hex() + "/messages"
+	page := func(query string) messagePageResponse {
+		t.Helper()
+		return decode[messagePageResponse](t, alice.expect(http.StatusOK, "GET", path+query, nil))
+	}
+	contents := func(p messagePageResponse) []string {
+		var out []string
+		for _, m := range p.Messages {
+			out = append(out, m.Content)
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		query              string
+		want               []string
+		hasOlder, hasNewer bool
+	}{
+		{"?limit=2", []string{"m3", "m4"}, true, false},
+		{"?limit=2&before=" + sent[3].ID.Hex(), []string{"m1", "m2"}, true, true},
+		{"?limit=2&before=" + sent[1].ID.Hex(), []string{"m0"}, false, true},
+		{"?limit=2&after=" + sent[2].ID.Hex(), []string{"m3", "m4"}, true, false},
+		{"?limit=3&around=" + sent[2].ID.Hex(), []string{"m1", "m2", "m3"}, true, true},
+	} {
+		p := page(tc.query)
+		got := contents(p)
+		if len(got) != len(tc.want) || p.HasOlder != tc.hasOlder || p.HasNewer != tc.hasNewer {
+			t.Errorf("%s: got %v older=%v newer=%v, want %v older=%v newer=%v", tc.query, got, p.HasOlder, p.HasNewer, tc.want, tc.hasOlder, tc.hasNewer)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: got %v, want %v", tc.query, got, tc.want)
+				break
+			}
+		}
+	}
+
+	alice.expect(http.StatusBadRequest, "GET", path+"?before="+sent[1].ID.Hex()+"&after="+sent[2].ID.Hex(), nil)
+	alice.expect(http.StatusBadRequest, "GET", path+"?before=nope", nil)
+	// reply ไม่อยู่ในประวัติห้อง จึงใช้เป็น cursor ไม่ได้
+	replies := decode[messagePageResponse](t, alice.expect(http.StatusOK, "GET", path+"/"+sent[0].ID.Hex()+"/thread", nil))
+	alice.expect(http.StatusNotFound, "GET", path+"?before="+replies.Messages[0].ID.Hex(), nil)
+}
+
+func TestEditMessage(t *testing.T) {
+	env, room, alice, bob := messageRoom(t)
+	msg := env.postMessage(room.ID, alice, "helo", time.Now(), nil)
+	path := "/rooms/" + room.ID.Hex() + "/messages/" + msg.ID.Hex()
+
+	bob.expect(http.StatusForbidden, "PATCH", path, map[string]string{"content": "hijacked"})
+	alice.expect(http.StatusBadRequest, "PATCH", path, map[string]string{"content": "   "})
+	alice.expect(http.StatusBadRequest, "PATCH", path, map[string]string{"content": strings.Repeat("ก", maxMessageLength+1)})
+
+	edited := decode[models.Message](t, alice.expect(http.StatusOK, "PATCH", path, map[string]string{"content": "hello"}))
+	if edited.Content != "hello" || edited.EditedAt == nil {
+		t.Fatalf("edited message = %+v, want content hello with edited_at", edited)
+	}
+
+	history := decode[struct {
+		Edits []models.MessageEdit `json:"edits"`
+	}](t, alice.expect(http.StatusOK, "GET", path+"/edits", nil))
+	if len(history.Edits) != 1 || history.Edits[0].Content != "helo" {
+		t.Fatalf("edit history = %+v, want the original content", history.Edits)
+	}
+	bob.expect(http.StatusForbidden, "GET", path+"/edits", nil)
+}
+
+func TestDeleteMessageLeavesTombstone(t *testing.T) {
+	env, room, alice, bob := messageRoom(t)
+	msg := env.postMessage(room.ID, alice, "oops", time.Now(), nil)
+	path := "/rooms/" + room.ID.Hex() + "/messages/" + msg.ID.Hex()
+
+	bob.expect(http.StatusForbidden, "DELETE", path, nil)
+	alice.expect(http.StatusOK, "DELETE", path, nil)
+	// ลบซ้ำถือว่าสำเร็จ แต่แก้ไม่ได้แล้ว
+	alice.expect(http.StatusOK, "DELETE", path, nil)
+	alice.expect(http.StatusConflict, "PATCH", path, map[string]string{"content": "back"})
+
+	p := decode[messagePageResponse](t, bob.expect(http.StatusOK, "GET", "/rooms/"+room.ID.Hex()+"/messages", nil))
+	if len(p.Messages) != 1 || !p.Messages[0].IsDeleted() || p.Messages[0].Content != "" {
+		t.Fatalf("history after delete = %+v, want one empty tombstone", p.Messages)
+	}
+	if by := p.Messages[0].DeletedBy; by == nil || *by != alice.userID {
+		t.Fatalf("deleted_by = %v, want alice", by)
+	}
+}
+
+func TestDeletingReplyUpdatesThread(t *testing.T) {
+	env, room, alice, bob := messageRoom(t)
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	parent := env.postMessage(room.ID, alice, "question", base, nil)
+	first := env.postMessage(room.ID, bob, "answer", base.Add(time.Minute), &parent.ID)
+	second := env.postMessage(room.ID, bob, "follow-up", base.Add(2*time.Minute), &parent.ID)
+
+	threadPath := "/rooms/" + room.ID.Hex() + "/messages/" + parent.ID.Hex() + "/thread"
+	thread := func() messagePageResponse {
+		t.Helper()
+		return decode[messagePageResponse](t, alice.expect(http.StatusOK, "GET", threadPath, nil))
+	}
+	if got := thread(); got.Parent.ReplyCount != 2 || len(got.Messages) != 2 {
+		t.Fatalf("thread = %d replies counted, %d listed; want 2 and 2", got.Parent.ReplyCount, len(got.Messages))
+	}
+
+	bob.expect(http.StatusOK, "DELETE", "/rooms/"+room.ID.Hex()+"/messages/"+second.ID.Hex(), nil)
+	got := thread()
+	if got.Parent.ReplyCount != 1 || got.Parent.LastReplyAt == nil || !got.Parent.LastReplyAt.Equal(first.CreatedAt) {
+		t.Fatalf("after deleting the newest reply: count=%d last=%v, want 1 at %v", got.Parent.ReplyCount, got.Parent.LastReplyAt, first.CreatedAt)
+	}
+
+	// ลบซ้ำต้องไม่ลดตัวนับอีก
+	bob.expect(http.StatusOK, "DELETE", "/rooms/"+room.ID.Hex()+"/messages/"+second.ID.Hex(), nil)
+	if got := thread(); got.Parent.ReplyCount != 1 {
+		t.Fatalf("deleting a reply twice: count=%d, want 1", got.Parent.ReplyCount)
+	}
+}
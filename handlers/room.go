@@ -3,86 +3,91 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
-	"mychat-auth/database"
+	"errors"
 	"mychat-auth/models"
 	"mychat-auth/shared/contextkey"
+	"mychat-auth/shared/logger"
+	"mychat-auth/shared/response"
+	"mychat-auth/store"
 	"mychat-auth/utils"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// GET /rooms
-func GetRoomsHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	cursor, err := database.RoomCollection.Find(ctx, bson.M{}) //  ใช้ collection จาก database package
+// GET /rooms — ห้อง public ทุกห้องและห้อง private ที่ผู้เรียกเป็นสมาชิก (ไม่รวมห้องที่ archive แล้ว)
+func (s *Server) GetRoomsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value(contextkey.UserID).(string)
+	callerID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		http.Error(w, "Failed to fetch rooms", http.StatusInternalServerError)
+		response.Error(w, r, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var rooms []models.Room
-	if err := cursor.All(ctx, &rooms); err != nil {
-		http.Error(w, "Failed to decode rooms", http.StatusInternalServerError)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rooms, err := s.Store.Rooms.ListVisible(ctx, callerID)
+	if err != nil {
+		response.Error(w, r, "Failed to fetch rooms", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(rooms)
+	response.JSON(w, http.StatusOK, rooms)
 }
 
-func CreateRoomHandler(w http.ResponseWriter, r *http.Request) {
-	tokenCookie, err := r.Cookie("token")
-	if err != nil || tokenCookie.Value == "" {
-		http.Error(w, "Missing token", http.StatusUnauthorized)
+func (s *Server) CreateRoomHandler(w http.ResponseWriter, r *http.Request) {
+	token := s.Cookies.AccessToken(r)
+	if token == "" {
+		utils.TokenMissing()
+		response.Error(w, r, "Missing token", http.StatusUnauthorized)
 		return
 	}
 
-	claims, err := utils.ValidateToken(tokenCookie.Value)
+	claims, err := s.JWT.ValidateToken(token)
 	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		response.Error(w, r, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+	if s.rejectRevoked(w, r, claims) {
 		return
 	}
 
 	if claims.Role != "admin" {
-		http.Error(w, "Forbidden: admin only", http.StatusForbidden)
+		s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomCreate, Outcome: models.AuditDenied, ActorID: claims.UserID, Reason: "admin only"})
+		response.Error(w, r, "Forbidden: admin only", http.StatusForbidden)
 		return
 	}
 
 	var req models.Room
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		response.Error(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.Name == "" || (req.Type != "public" && req.Type != "private") {
-		http.Error(w, "Invalid room data", http.StatusBadRequest)
+	if err := validate.Struct(req); err != nil {
+		response.Validation(w, r, err)
 		return
 	}
-
-	count, _ := database.RoomCollection.CountDocuments(context.TODO(), bson.M{"name": req.Name})
-	if count > 0 {
-		http.Error(w, "Room name already exists", http.StatusConflict)
+	if models.ReservedRoomName(req.Name) {
+		response.Error(w, r, "Room name is reserved", http.StatusBadRequest)
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
 	creatorID, err := primitive.ObjectIDFromHex(claims.UserID)
 	if err != nil {
-		http.Error(w, "Invalid user ID in token", http.StatusUnauthorized)
+		response.Error(w, r, "Invalid user ID in token", http.StatusUnauthorized)
 		return
 	}
 
-	var creator models.User
-	err = database.UserCollection.FindOne(context.TODO(), bson.M{"_id": creatorID}).Decode(&creator)
+	creator, err := s.Store.Users.ByID(ctx, creatorID)
 	if err != nil {
-		http.Error(w, "Failed to load creator user", http.StatusInternalServerError)
+		response.Error(w, r, "Failed to load creator user", http.StatusInternalServerError)
 		return
 	}
 
@@ -90,94 +95,229 @@ func CreateRoomHandler(w http.ResponseWriter, r *http.Request) {
 
 	req.ID = primitive.NewObjectID()
 	req.CreatedAt = time.Now()
-	req.Members = []models.SafeUser{safeCreator}
+	req.OwnerID = creatorID
+	req.Members = []models.RoomMember{{SafeUser: safeCreator, Role: models.RoomRoleOwner}}
 
-	_, err = database.RoomCollection.InsertOne(context.TODO(), req)
+	err = s.Store.Rooms.Create(ctx, &req)
+	if errors.Is(err, store.ErrConflict) {
+		response.Error(w, r, "Room name already exists", http.StatusConflict)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to create room", http.StatusInternalServerError)
+		response.Error(w, r, "Failed to create room", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(req)
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomCreate, Outcome: models.AuditSuccess, ActorID: claims.UserID, TargetType: "room", TargetID: req.ID.Hex(), Metadata: map[string]string{"name": req.Name, "type": req.Type}})
+	response.JSON(w, http.StatusCreated, req)
 }
 
-func JoinRoomHandler(w http.ResponseWriter, r *http.Request) {
-	roomID := strings.TrimPrefix(r.URL.Path, "/rooms/")
-	roomID = strings.TrimSuffix(roomID, "/join")
+func (s *Server) JoinRoomHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("id")
 
 	userID, ok := r.Context().Value(contextkey.UserID).(string)
 	if !ok || userID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		response.Error(w, r, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	roomObjID, err := primitive.ObjectIDFromHex(roomID)
 	if err != nil {
-		http.Error(w, "Invalid room ID", http.StatusBadRequest)
+		response.Error(w, r, "Invalid room ID", http.StatusBadRequest)
 		return
 	}
 
-	userObjID := models.StringToObjectID(userID)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
 
-	var user models.User
-	err = database.UserCollection.FindOne(context.TODO(), bson.M{"_id": userObjID}).Decode(&user)
+	user, err := s.Store.Users.ByID(ctx, models.StringToObjectID(userID))
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		response.Error(w, r, "User not found", http.StatusNotFound)
 		return
 	}
 
-	safeUser := user.ToSafeUser()
-
-	filter := bson.M{"_id": roomObjID}
-	update := bson.M{"$addToSet": bson.M{"members": safeUser}}
-
-	res, err := database.RoomCollection.UpdateOne(context.TODO(), filter, update)
+	room, err := s.Store.Rooms.ByID(ctx, roomObjID)
+	if errors.Is(err, store.ErrNotFound) {
+		response.Error(w, r, "Room not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		http.Error(w, "DB error", http.StatusInternalServerError)
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if room.Archived {
+		response.Error(w, r, "Room is archived", http.StatusConflict)
+		return
+	}
+	if room.IsPrivate() && !room.IsMember(user.ID) {
+		s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomJoin, Outcome: models.AuditDenied, ActorID: userID, TargetType: "room", TargetID: roomID, Reason: "private room"})
+		response.Fail(w, r, response.NewError(http.StatusForbidden, response.CodeForbidden, "Private rooms can only be joined by invitation"))
 		return
 	}
 
-	if res.MatchedCount == 0 {
-		http.Error(w, "Room not found", http.StatusNotFound)
+	member := models.RoomMember{SafeUser: user.ToSafeUser(), Role: models.RoomRoleMember}
+	err = s.Store.Rooms.AddMember(ctx, roomObjID, member)
+	if errors.Is(err, store.ErrNotFound) {
+		response.Error(w, r, "Room not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Joined room"})
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomJoin, Outcome: models.AuditSuccess, ActorID: userID, TargetType: "room", TargetID: roomID})
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Joined room"})
 }
 
-func GetRoomMessagesHandler(w http.ResponseWriter, r *http.Request) {
-	roomIDStr := strings.TrimPrefix(r.URL.Path, "/rooms/")
-	roomIDStr = strings.TrimSuffix(roomIDStr, "/messages")
-	roomID, err := primitive.ObjectIDFromHex(roomIDStr)
-	if err != nil {
-		http.Error(w, "Invalid room ID", http.StatusBadRequest)
+// GET /rooms/{id}/messages — เฉพาะสมาชิกของห้อง เฉพาะข้อความนอก thread
+// ?limit= จำนวนต่อหน้า, ?before= / ?after= / ?around= เป็น message ID ระบุได้อย่างเดียว
+// ไม่ระบุ cursor คือข้อความล่าสุด ผลลัพธ์เรียงจากเก่าไปใหม่เสมอ
+func (s *Server) GetRoomMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	roomIDStr := r.PathValue("id")
+	log := logger.FromContext(r.Context())
+
+	page, ok := parseMessagePage(w, r)
+	if !ok {
 		return
 	}
 
-	filter := bson.M{"room_id": roomID}
-	log.Println("🧾 MongoDB filter:", filter)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
 
-	cursor, err := database.MessageCollection.Find(context.TODO(), filter)
-	if err != nil {
-		log.Println("❌ Failed to fetch messages:", err)
-		http.Error(w, "Failed to fetch messages", http.StatusInternalServerError)
+	room, _, _, ok := s.loadRoomAsMember(ctx, w, r, roomIDStr)
+	if !ok {
 		return
 	}
 
-	var messages []models.Message
-	if err := cursor.All(context.TODO(), &messages); err != nil {
-		log.Println("❌ Failed to decode messages:", err)
-		http.Error(w, "Failed to decode messages", http.StatusInternalServerError)
+	messages, hasOlder, hasNewer, apiErr := s.listMessagePage(ctx, room.ID, nil, page)
+	if apiErr != nil {
+		response.Fail(w, r, apiErr)
 		return
 	}
 
-	log.Printf("✅ Messages fetched: %d\n", len(messages))
-	for _, msg := range messages {
-		log.Printf("📨 [%s] %s\n", msg.SenderID.Hex(), msg.Content)
+	log.Debug("✅ Messages fetched", "room_id", roomIDStr, "count", len(messages))
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"messages":  messages,
+		"has_older": hasOlder,
+		"has_newer": hasNewer,
+		"limit":     page.limit,
+	})
+}
+
+// messagePage คือพารามิเตอร์แบ่งหน้าของประวัติข้อความ mode ว่างคือหน้าล่าสุด
+type messagePage struct {
+	limit    int
+	mode     string // before, after หรือ around
+	cursorID primitive.ObjectID
+}
+
+// parseMessagePage อ่าน ?limit= และ cursor จาก query ถ้าไม่ถูกต้องจะตอบ 400 ให้เองแล้วคืน false
+func parseMessagePage(w http.ResponseWriter, r *http.Request) (messagePage, bool) {
+	q := r.URL.Query()
+
+	page := messagePage{}
+	page.limit, _ = strconv.Atoi(q.Get("limit"))
+	if page.limit < 1 || page.limit > store.MaxMessagePageSize {
+		page.limit = 50
+	}
+
+	// หา cursor ที่ระบุมา ต้องมีไม่เกินหนึ่งตัว
+	cursorStr := ""
+	for _, key := range []string{"before", "after", "around"} {
+		if v := q.Get(key); v != "" {
+			if page.mode != "" {
+				response.Error(w, r, "Use only one of before, after or around", http.StatusBadRequest)
+				return page, false
+			}
+			page.mode, cursorStr = key, v
+		}
+	}
+	if page.mode != "" {
+		id, err := primitive.ObjectIDFromHex(cursorStr)
+		if err != nil {
+			response.Error(w, r, "Invalid message ID", http.StatusBadRequest)
+			return page, false
+		}
+		page.cursorID = id
+	}
+	return page, true
+}
+
+// listMessagePage คืนข้อความหนึ่งหน้าของห้อง parentID nil คือข้อความนอก thread ไม่งั้นคือ reply ของ parentID
+// ข้อความที่ใช้เป็น cursor ต้องอยู่ในรายการเดียวกัน ไม่งั้นถือว่าไม่พบ
+func (s *Server) listMessagePage(ctx context.Context, roomID primitive.ObjectID, parentID *primitive.ObjectID, page messagePage) ([]models.Message, bool, bool, *response.APIError) {
+	var at models.Message
+	if page.mode != "" {
+		m, err := s.Store.Messages.ByID(ctx, roomID, page.cursorID)
+		if err == nil && !m.InThread(parentID) {
+			err = store.ErrNotFound
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, false, false, response.NewError(http.StatusNotFound, response.CodeNotFound, "Message not found")
+		}
+		if err != nil {
+			return nil, false, false, response.NewError(http.StatusInternalServerError, response.CodeInternal, "DB error")
+		}
+		at = m
+	}
+
+	var (
+		messages           []models.Message
+		hasOlder, hasNewer bool
+		err                error
+	)
+	q := store.MessageQuery{ParentID: parentID, Limit: page.limit}
+	switch page.mode {
+	case "before":
+		q.Before = store.CursorOf(at)
+		messages, hasOlder, err = s.Store.Messages.ListByRoom(ctx, roomID, q)
+		hasNewer = true
+	case "after":
+		q.After = store.CursorOf(at)
+		messages, hasNewer, err = s.Store.Messages.ListByRoom(ctx, roomID, q)
+		hasOlder = true
+	case "around":
+		// แบ่งครึ่งก่อนและหลังข้อความที่กระโดดไป ตัวข้อความเองนับรวมใน limit
+		messages, hasOlder, hasNewer, err = s.messagesAround(ctx, roomID, q, at)
+	default:
+		messages, hasOlder, err = s.Store.Messages.ListByRoom(ctx, roomID, q)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("❌ Failed to fetch messages", "room_id", roomID.Hex(), "error", err)
+		return nil, false, false, response.NewError(http.StatusInternalServerError, response.CodeInternal, "Failed to fetch messages")
+	}
+	return messages, hasOlder, hasNewer, nil
+}
+
+// messagesAround คืนข้อความรอบ ๆ at ทั้งก่อนและหลัง รวมแล้วไม่เกิน q.Limit
+// ถ้า limit เล็กจนไม่เหลือที่ให้ฝั่งใด ยังถามฝั่งนั้นหนึ่งตัวเพื่อให้รู้ว่ามีต่อหรือไม่
+func (s *Server) messagesAround(ctx context.Context, roomID primitive.ObjectID, q store.MessageQuery, at models.Message) ([]models.Message, bool, bool, error) {
+	olderLimit := (q.Limit - 1) / 2
+	newerLimit := q.Limit - 1 - olderLimit
+
+	olderQ, newerQ := q, q
+	olderQ.Before, olderQ.Limit = store.CursorOf(at), max(olderLimit, 1)
+	newerQ.After, newerQ.Limit = store.CursorOf(at), max(newerLimit, 1)
+
+	older, hasOlder, err := s.Store.Messages.ListByRoom(ctx, roomID, olderQ)
+	if err != nil {
+		return nil, false, false, err
+	}
+	if len(older) > olderLimit {
+		older, hasOlder = older[len(older)-olderLimit:], true
+	}
+	newer, hasNewer, err := s.Store.Messages.ListByRoom(ctx, roomID, newerQ)
+	if err != nil {
+		return nil, false, false, err
+	}
+	if len(newer) > newerLimit {
+		newer, hasNewer = newer[:newerLimit], true
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(messages)
+	messages := make([]models.Message, 0, len(older)+1+len(newer))
+	messages = append(messages, older...)
+	messages = append(messages, at)
+	return append(messages, newer...), hasOlder, hasNewer, nil
 }
@@ -0,0 +1,535 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mychat-auth/models"
+	"mychat-auth/shared/contextkey"
+	"mychat-auth/shared/logger"
+	"mychat-auth/shared/response"
+	"mychat-auth/store"
+	"mychat-auth/utils"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxInviteLinkTTL คืออายุสูงสุดของลิงก์เชิญ กันลิงก์ที่ใช้ได้ตลอดไปโดยไม่ตั้งใจ
+const maxInviteLinkTTL = 30 * 24 * time.Hour
+
+// requestUserID อ่าน user ID ที่ JWTAuthMiddleware ใส่ไว้ใน context เขียน 401 ให้เองถ้าไม่มี
+func requestUserID(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
+	userID, _ := r.Context().Value(contextkey.UserID).(string)
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		response.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return id, false
+	}
+	return id, true
+}
+
+// loadRoomAsModerator เหมือน loadRoomAsMember แต่ให้ผ่านเฉพาะ owner/moderator ของห้อง
+func (s *Server) loadRoomAsModerator(ctx context.Context, w http.ResponseWriter, r *http.Request, roomIDHex string) (models.Room, primitive.ObjectID, bool) {
+	room, userID, role, ok := s.loadRoomAsMember(ctx, w, r, roomIDHex)
+	if !ok {
+		return room, userID, false
+	}
+	if !models.CanModerate(role) {
+		response.Error(w, r, "Forbidden: moderators only", http.StatusForbidden)
+		return room, userID, false
+	}
+	return room, userID, true
+}
+
+// joinRoom เพิ่ม user เข้าห้องในฐานะ member ใช้ร่วมกันระหว่างรับคำเชิญและใช้ลิงก์เชิญ
+func (s *Server) joinRoom(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID primitive.ObjectID, user models.User) bool {
+	member := models.RoomMember{SafeUser: user.ToSafeUser(), Role: models.RoomRoleMember}
+	err := s.Store.Rooms.AddMember(ctx, roomID, member)
+	if errors.Is(err, store.ErrNotFound) {
+		response.Error(w, r, "Room not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// POST /rooms/{id}/invitations — owner/moderator เชิญ user เข้าห้อง
+func (s *Server) CreateInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, inviterID, ok := s.loadRoomAsModerator(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if room.Archived {
+		response.Error(w, r, "Room is archived", http.StatusConflict)
+		return
+	}
+
+	var req struct {
+		UserID string `json:"user_id" validate:"required"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		response.Validation(w, r, err)
+		return
+	}
+	inviteeID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		response.Error(w, r, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	invitee, err := s.Store.Users.ByID(ctx, inviteeID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && invitee.Disabled) {
+		response.Error(w, r, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if room.IsMember(inviteeID) {
+		response.Error(w, r, "User is already a room member", http.StatusConflict)
+		return
+	}
+
+	inv := models.Invitation{
+		RoomID:    room.ID,
+		RoomName:  room.Name,
+		InviteeID: inviteeID,
+		InviterID: inviterID,
+		Status:    models.InvitePending,
+		CreatedAt: time.Now(),
+	}
+	err = s.Store.Invitations.Create(ctx, &inv)
+	if errors.Is(err, store.ErrConflict) {
+		response.Error(w, r, "User already has a pending invitation", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("✉️ Room invitation sent", "room_id", room.ID.Hex(), "invitee_id", inviteeID.Hex())
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomInvite, Outcome: models.AuditSuccess, ActorID: inviterID.Hex(), TargetType: "user", TargetID: inviteeID.Hex(), Metadata: map[string]string{"room_id": room.ID.Hex(), "invitation_id": inv.ID.Hex()}})
+	response.JSON(w, http.StatusCreated, inv)
+}
+
+// GET /rooms/{id}/invitations?status= — owner/moderator ดูคำเชิญของห้อง ค่าเริ่มต้นเฉพาะ pending
+func (s *Server) GetRoomInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, _, ok := s.loadRoomAsModerator(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.InvitePending
+	case "all":
+		status = ""
+	case models.InvitePending, models.InviteAccepted, models.InviteDeclined, models.InviteRevoked:
+	default:
+		response.Error(w, r, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	invitations, err := s.Store.Invitations.ListByRoom(ctx, room.ID, status)
+	if err != nil {
+		response.Error(w, r, "Failed to fetch invitations", http.StatusInternalServerError)
+		return
+	}
+	response.JSON(w, http.StatusOK, invitations)
+}
+
+// DELETE /rooms/{id}/invitations/{invitationID} — owner/moderator ยกเลิกคำเชิญที่ยังไม่มีคนตอบ
+func (s *Server) RevokeInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, actorID, ok := s.loadRoomAsModerator(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	invID, err := primitive.ObjectIDFromHex(r.PathValue("invitationID"))
+	if err != nil {
+		response.Error(w, r, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+	inv, err := s.Store.Invitations.ByID(ctx, invID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && inv.RoomID != room.ID) {
+		response.Error(w, r, "Invitation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.Store.Invitations.Respond(ctx, inv.ID, models.InviteRevoked)
+	if errors.Is(err, store.ErrConflict) {
+		response.Error(w, r, "Invitation is no longer pending", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomInviteRevoke, Outcome: models.AuditSuccess, ActorID: actorID.Hex(), TargetType: "user", TargetID: inv.InviteeID.Hex(), Metadata: map[string]string{"room_id": room.ID.Hex(), "invitation_id": inv.ID.Hex()}})
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Invitation revoked"})
+}
+
+// GET /invitations — คำเชิญที่ยัง pending ของผู้เรียก
+func (s *Server) MyInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	invitations, err := s.Store.Invitations.ListByInvitee(ctx, userID, models.InvitePending)
+	if err != nil {
+		response.Error(w, r, "Failed to fetch invitations", http.StatusInternalServerError)
+		return
+	}
+	response.JSON(w, http.StatusOK, invitations)
+}
+
+// loadOwnInvitation โหลดคำเชิญที่ส่งถึงผู้เรียก คำเชิญของคนอื่นตอบเหมือนไม่มี
+func (s *Server) loadOwnInvitation(ctx context.Context, w http.ResponseWriter, r *http.Request) (models.Invitation, bool) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return models.Invitation{}, false
+	}
+	invID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		response.Error(w, r, "Invalid invitation ID", http.StatusBadRequest)
+		return models.Invitation{}, false
+	}
+
+	inv, err := s.Store.Invitations.ByID(ctx, invID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && inv.InviteeID != userID) {
+		response.Error(w, r, "Invitation not found", http.StatusNotFound)
+		return inv, false
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return inv, false
+	}
+	if inv.Status != models.InvitePending {
+		response.Error(w, r, "Invitation is no longer pending", http.StatusConflict)
+		return inv, false
+	}
+	return inv, true
+}
+
+// POST /invitations/{id}/accept — ผู้ถูกเชิญรับคำเชิญและเข้าห้อง
+func (s *Server) AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	inv, ok := s.loadOwnInvitation(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	user, err := s.Store.Users.ByID(ctx, inv.InviteeID)
+	if err != nil {
+		response.Error(w, r, "User not found", http.StatusNotFound)
+		return
+	}
+	room, err := s.Store.Rooms.ByID(ctx, inv.RoomID)
+	if errors.Is(err, store.ErrNotFound) {
+		response.Error(w, r, "Room not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if room.Archived {
+		response.Error(w, r, "Room is archived", http.StatusConflict)
+		return
+	}
+
+	// เปลี่ยนสถานะก่อน ถ้ามีคนยกเลิกหรือกดรับซ้ำพร้อมกันจะมีแค่ครั้งเดียวที่ผ่าน
+	// ถ้าเข้าห้องไม่สำเร็จจะคืนคำเชิญกลับเป็น pending ให้กดรับใหม่ได้
+	err = s.Store.Invitations.Respond(ctx, inv.ID, models.InviteAccepted)
+	if errors.Is(err, store.ErrConflict) {
+		response.Error(w, r, "Invitation is no longer pending", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if !s.joinRoom(ctx, w, r, room.ID, user) {
+		s.rollbackInvite(ctx, "invitation_id", inv.ID.Hex(), func(ctx context.Context) error {
+			return s.Store.Invitations.Reopen(ctx, inv.ID)
+		})
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("✅ Room invitation accepted", "room_id", room.ID.Hex(), "user_id", user.ID.Hex())
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomInviteAccept, Outcome: models.AuditSuccess, ActorID: user.ID.Hex(), TargetType: "room", TargetID: room.ID.Hex(), Metadata: map[string]string{"invitation_id": inv.ID.Hex()}})
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Joined room", "room_id": room.ID.Hex()})
+}
+
+// rollbackInvite ย้อนสถานะคำเชิญหรือการใช้ลิงก์หลัง joinRoom ล้มเหลว
+// ใช้ context แยกเพราะ ctx ของ request อาจหมดเวลาไปแล้วตอนที่ join ล้มเหลว
+func (s *Server) rollbackInvite(ctx context.Context, key, id string, undo func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := undo(ctx); err != nil {
+		logger.FromContext(ctx).Error("❌ Failed to roll back invite after join failed", key, id, "error", err)
+	}
+}
+
+// POST /invitations/{id}/decline — ผู้ถูกเชิญปฏิเสธคำเชิญ
+func (s *Server) DeclineInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	inv, ok := s.loadOwnInvitation(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	err := s.Store.Invitations.Respond(ctx, inv.ID, models.InviteDeclined)
+	if errors.Is(err, store.ErrConflict) {
+		response.Error(w, r, "Invitation is no longer pending", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomInviteDecline, Outcome: models.AuditSuccess, ActorID: inv.InviteeID.Hex(), TargetType: "room", TargetID: inv.RoomID.Hex(), Metadata: map[string]string{"invitation_id": inv.ID.Hex()}})
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Invitation declined"})
+}
+
+// inviteLinkView คือลิงก์เชิญพร้อมสถานะ ณ ตอนที่ตอบ
+type inviteLinkView struct {
+	models.InviteLink
+	State string `json:"state"`
+}
+
+// POST /rooms/{id}/invite-links — owner/moderator สร้างลิงก์เชิญ
+// expires_in เป็นวินาที ไม่ระบุหรือเกิน maxInviteLinkTTL จะใช้ maxInviteLinkTTL ส่วน max_uses 0 คือไม่จำกัด
+func (s *Server) CreateInviteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, creatorID, ok := s.loadRoomAsModerator(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if room.Archived {
+		response.Error(w, r, "Room is archived", http.StatusConflict)
+		return
+	}
+
+	var req struct {
+		ExpiresIn int `json:"expires_in" validate:"min=0"`
+		MaxUses   int `json:"max_uses" validate:"min=0,max=1000"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		response.Validation(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	ttl := time.Duration(req.ExpiresIn) * time.Second
+	if ttl == 0 || ttl > maxInviteLinkTTL {
+		ttl = maxInviteLinkTTL
+	}
+	expiresAt := now.Add(ttl)
+	link := models.InviteLink{
+		RoomID:    room.ID,
+		Code:      utils.RandomID(),
+		CreatedBy: creatorID,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: &expiresAt,
+		CreatedAt: now,
+	}
+	if err := s.Store.InviteLinks.Create(ctx, &link); err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("🔗 Invite link created", "room_id", room.ID.Hex(), "link_id", link.ID.Hex(), "max_uses", link.MaxUses, "expires_at", expiresAt)
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomInviteLinkCreate, Outcome: models.AuditSuccess, ActorID: creatorID.Hex(), TargetType: "room", TargetID: room.ID.Hex(), Metadata: map[string]string{"link_id": link.ID.Hex()}})
+	response.JSON(w, http.StatusCreated, inviteLinkView{InviteLink: link, State: link.State(now)})
+}
+
+// GET /rooms/{id}/invite-links — owner/moderator ดูลิงก์เชิญทั้งหมดของห้อง
+func (s *Server) GetInviteLinksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, _, ok := s.loadRoomAsModerator(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	links, err := s.Store.InviteLinks.ListByRoom(ctx, room.ID)
+	if err != nil {
+		response.Error(w, r, "Failed to fetch invite links", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	views := make([]inviteLinkView, 0, len(links))
+	for _, l := range links {
+		views = append(views, inviteLinkView{InviteLink: l, State: l.State(now)})
+	}
+	response.JSON(w, http.StatusOK, views)
+}
+
+// DELETE /rooms/{id}/invite-links/{linkID} — owner/moderator เพิกถอนลิงก์ คนที่เข้าห้องไปแล้วยังอยู่
+func (s *Server) RevokeInviteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, actorID, ok := s.loadRoomAsModerator(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	linkID, err := primitive.ObjectIDFromHex(r.PathValue("linkID"))
+	if err != nil {
+		response.Error(w, r, "Invalid link ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.Store.InviteLinks.Revoke(ctx, room.ID, linkID)
+	if errors.Is(err, store.ErrNotFound) {
+		response.Error(w, r, "Invite link not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomInviteLinkRevoke, Outcome: models.AuditSuccess, ActorID: actorID.Hex(), TargetType: "room", TargetID: room.ID.Hex(), Metadata: map[string]string{"link_id": linkID.Hex()}})
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Invite link revoked"})
+}
+
+// POST /invite-links/accept — ใครก็ได้ที่ login และมีลิงก์ใช้เข้าห้องได้
+// code ส่งมาใน body ไม่ใส่ใน path เพราะใครได้ code ไปก็เข้าห้องได้ และ path ถูกเก็บใน log กับ trace
+func (s *Server) AcceptInviteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" validate:"required"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		response.Validation(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	code := req.Code
+	link, err := s.Store.InviteLinks.ByCode(ctx, code)
+	if errors.Is(err, store.ErrNotFound) {
+		response.Error(w, r, "Invite link not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if state := link.State(time.Now()); state != models.InviteLinkActive {
+		s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomInviteLinkUse, Outcome: models.AuditDenied, ActorID: userID.Hex(), TargetType: "room", TargetID: link.RoomID.Hex(), Reason: state, Metadata: map[string]string{"link_id": link.ID.Hex()}})
+		response.Error(w, r, "Invite link is "+inviteLinkStateText(state), http.StatusGone)
+		return
+	}
+
+	user, err := s.Store.Users.ByID(ctx, userID)
+	if err != nil {
+		response.Error(w, r, "User not found", http.StatusNotFound)
+		return
+	}
+	room, err := s.Store.Rooms.ByID(ctx, link.RoomID)
+	if errors.Is(err, store.ErrNotFound) {
+		response.Error(w, r, "Room not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if room.Archived {
+		response.Error(w, r, "Room is archived", http.StatusConflict)
+		return
+	}
+	// คนที่อยู่ในห้องแล้วไม่นับเป็นการใช้ลิงก์
+	if room.IsMember(userID) {
+		response.JSON(w, http.StatusOK, map[string]string{"message": "Already a room member", "room_id": room.ID.Hex()})
+		return
+	}
+
+	// นับก่อนเพื่อไม่ให้ใช้เกิน max_uses ถ้าเข้าห้องไม่สำเร็จจะคืนการใช้ครั้งนี้
+	_, err = s.Store.InviteLinks.Use(ctx, code, time.Now())
+	if errors.Is(err, store.ErrConflict) {
+		response.Error(w, r, "Invite link is no longer valid", http.StatusGone)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if !s.joinRoom(ctx, w, r, room.ID, user) {
+		s.rollbackInvite(ctx, "link_id", link.ID.Hex(), func(ctx context.Context) error {
+			return s.Store.InviteLinks.Release(ctx, code)
+		})
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("🔗 Joined room via invite link", "room_id", room.ID.Hex(), "user_id", userID.Hex(), "link_id", link.ID.Hex())
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomInviteLinkUse, Outcome: models.AuditSuccess, ActorID: userID.Hex(), TargetType: "room", TargetID: room.ID.Hex(), Metadata: map[string]string{"link_id": link.ID.Hex()}})
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Joined room", "room_id": room.ID.Hex()})
+}
+
+func inviteLinkStateText(state string) string {
+	switch state {
+	case models.InviteLinkRevoked:
+		return "revoked"
+	case models.InviteLinkExpired:
+		return "expired"
+	case models.InviteLinkUsedUp:
+		return "used up"
+	}
+	return state
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"mychat-auth/models"
+)
+
+func TestAcceptInviteLink(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.signUp("admin@example.com", "admin")
+	bob := env.signUp("bob@example.com", "member")
+	carol := env.signUp("carol@example.com", "member")
+
+	staff := admin.createRoom("staff", models.RoomTypePrivate)
+	link := decode[inviteLinkView](t, admin.expect(http.StatusCreated, "POST", "/rooms/"+staff.ID.Hex()+"/invite-links", map[string]int{"max_uses": 1}))
+
+	// code อยู่ใน body เท่านั้น
+	bob.expect(http.StatusUnprocessableEntity, "POST", "/invite-links/accept", map[string]string{})
+	bob.expect(http.StatusNotFound, "POST", "/invite-links/accept", map[string]string{"code": "nope"})
+	bob.expect(http.StatusOK, "POST", "/invite-links/accept", map[string]string{"code": link.Code})
+	bob.expect(http.StatusOK, "GET", "/rooms/"+staff.ID.Hex()+"/messages", nil)
+
+	// ลิงก์ใช้ได้ครั้งเดียว
+	carol.expect(http.StatusGone, "POST", "/invite-links/accept", map[string]string{"code": link.Code})
+}
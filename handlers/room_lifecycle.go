@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"mychat-auth/models"
+	"mychat-auth/shared/logger"
+	"mychat-auth/shared/response"
+	"mychat-auth/store"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// POST /rooms/{id}/leave — สมาชิกออกจากห้องเอง owner ต้องโอนห้องหรือลบห้องก่อน
+func (s *Server) LeaveRoomHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, callerID, role, ok := s.loadRoomAsMember(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if room.Type == models.RoomTypeDM {
+		response.Error(w, r, "Direct messages cannot be left", http.StatusConflict)
+		return
+	}
+	if role == models.RoomRoleOwner {
+		response.Error(w, r, "Transfer ownership or delete the room before leaving", http.StatusConflict)
+		return
+	}
+
+	if err := s.Store.Rooms.RemoveMember(ctx, room.ID, callerID); err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	s.hub.leaveUser(room.ID.Hex(), callerID.Hex())
+	s.broadcastRoomEvent(r.Context(), roomEvent{Type: roomEventMemberLeft, RoomID: room.ID.Hex(), UserID: callerID.Hex()})
+
+	logger.FromContext(r.Context()).Info("🚪 Left room", "room_id", room.ID.Hex(), "user_id", callerID.Hex())
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomLeave, Outcome: models.AuditSuccess, ActorID: callerID.Hex(), TargetType: "room", TargetID: room.ID.Hex()})
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Left room"})
+}
+
+// POST /rooms/{id}/archive — owner เก็บห้อง ห้องจะอ่านได้อย่างเดียวและไม่แสดงใน GET /rooms
+func (s *Server) ArchiveRoomHandler(w http.ResponseWriter, r *http.Request) {
+	s.setArchived(w, r, true)
+}
+
+// POST /rooms/{id}/unarchive — owner เปิดห้องที่เก็บไว้ให้ใช้ได้อีกครั้ง
+func (s *Server) UnarchiveRoomHandler(w http.ResponseWriter, r *http.Request) {
+	s.setArchived(w, r, false)
+}
+
+func (s *Server) setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, callerID, role, ok := s.loadRoomAsMember(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if role != models.RoomRoleOwner {
+		response.Error(w, r, "Forbidden: owner only", http.StatusForbidden)
+		return
+	}
+	// ทำซ้ำได้ ห้องที่อยู่ในสถานะนั้นแล้วตอบกลับเหมือนสำเร็จโดยไม่แจ้ง event
+	if room.Archived == archived {
+		response.JSON(w, http.StatusOK, room)
+		return
+	}
+
+	if err := s.Store.Rooms.SetArchived(ctx, room.ID, archived); err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+	room.Archived, room.ArchivedAt = archived, nil
+	action, event := models.AuditRoomUnarchive, roomEventUnarchived
+	if archived {
+		now := time.Now().UTC()
+		room.ArchivedAt = &now
+		action, event = models.AuditRoomArchive, roomEventArchived
+	}
+
+	s.broadcastRoomEvent(r.Context(), roomEvent{Type: event, RoomID: room.ID.Hex(), Room: &room})
+	logger.FromContext(r.Context()).Info("🗄️ Room archive state changed", "room_id", room.ID.Hex(), "archived", archived)
+	s.Audit.Record(r, models.AuditEvent{Action: action, Outcome: models.AuditSuccess, ActorID: callerID.Hex(), TargetType: "room", TargetID: room.ID.Hex(), Metadata: map[string]string{"name": room.Name}})
+	response.JSON(w, http.StatusOK, room)
+}
+
+// DELETE /rooms/{id} — owner ลบห้องถาวรพร้อมข้อความ คำเชิญ และลิงก์เชิญทั้งหมด
+func (s *Server) DeleteRoomHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, callerID, role, ok := s.loadRoomAsMember(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if role != models.RoomRoleOwner {
+		response.Error(w, r, "Forbidden: owner only", http.StatusForbidden)
+		return
+	}
+	log := logger.FromContext(r.Context())
+
+	// ลบตัวห้องก่อน ข้อความหรือคำเชิญใหม่จะได้ 404 ตั้งแต่ตอนนี้ แล้วค่อยตามลบของที่อ้างถึงห้อง
+	err := s.Store.Rooms.Delete(ctx, room.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		response.Error(w, r, "Room not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	s.broadcastRoomEvent(r.Context(), roomEvent{Type: roomEventDeleted, RoomID: room.ID.Hex()})
+	s.hub.closeRoom(room.ID.Hex())
+
+	deleted, err := s.purgeRoomData(r.Context(), room.ID)
+	if err != nil {
+		// ห้องหายไปแล้ว ของที่เหลือไม่มีใครเข้าถึงได้ แค่ log ไว้ให้ตามลบ
+		log.Error("❌ Room deleted but cleanup failed", "room_id", room.ID.Hex(), "error", err)
+	}
+
+	log.Info("🗑️ Room deleted", "room_id", room.ID.Hex(), "messages_deleted", deleted)
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomDelete, Outcome: models.AuditSuccess, ActorID: callerID.Hex(), TargetType: "room", TargetID: room.ID.Hex(), Metadata: map[string]string{"name": room.Name, "messages_deleted": strconv.FormatInt(deleted, 10)}})
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Room deleted"})
+}
+
+// purgeRoomData ลบข้อความ คำเชิญ และลิงก์เชิญของห้องที่ลบไปแล้ว คืนจำนวนข้อความที่ลบ
+// ไม่ผูกกับ request ที่อาจถูกตัดกลางทาง และลบข้อความซ้ำตอนท้ายเพื่อเก็บข้อความ
+// ที่ส่งเข้ามาระหว่างนั้นจาก connection ที่โหลดห้องไว้ก่อนห้องถูกลบ
+func (s *Server) purgeRoomData(ctx context.Context, roomID primitive.ObjectID) (int64, error) {
+	// ห้องที่มีข้อความเยอะใช้เวลาลบนานกว่า request ทั่วไป
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	deleted, err := s.Store.Messages.DeleteByRoom(ctx, roomID)
+	if err != nil {
+		return deleted, err
+	}
+	if err := s.Store.Invitations.DeleteByRoom(ctx, roomID); err != nil {
+		return deleted, err
+	}
+	if err := s.Store.InviteLinks.DeleteByRoom(ctx, roomID); err != nil {
+		return deleted, err
+	}
+	late, err := s.Store.Messages.DeleteByRoom(ctx, roomID)
+	return deleted + late, err
+}
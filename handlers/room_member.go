@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mychat-auth/models"
+	"mychat-auth/shared/contextkey"
+	"mychat-auth/shared/logger"
+	"mychat-auth/shared/response"
+	"mychat-auth/store"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// loadRoomAsMember โหลดห้องพร้อมบทบาทของผู้เรียกในห้องนั้น
+// เขียน error response ให้เองถ้าโหลดไม่สำเร็จ และคืน ok=false
+func (s *Server) loadRoomAsMember(ctx context.Context, w http.ResponseWriter, r *http.Request, roomIDHex string) (room models.Room, callerID primitive.ObjectID, role string, ok bool) {
+	userID, _ := r.Context().Value(contextkey.UserID).(string)
+	callerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		response.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	roomID, err := primitive.ObjectIDFromHex(roomIDHex)
+	if err != nil {
+		response.Error(w, r, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+
+	room, err = s.Store.Rooms.ByID(ctx, roomID)
+	if errors.Is(err, store.ErrNotFound) {
+		response.Error(w, r, "Room not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	role = room.MemberRole(callerID)
+	if role == "" {
+		// ห้อง private ตอบเหมือนไม่มีห้อง ไม่ให้คนนอกรู้ว่ามีห้องนี้อยู่
+		if room.IsPrivate() {
+			response.Error(w, r, "Room not found", http.StatusNotFound)
+			return
+		}
+		response.Error(w, r, "Forbidden: not a room member", http.StatusForbidden)
+		return
+	}
+	return room, callerID, role, true
+}
+
+// PATCH /rooms/{id} — owner แก้ชื่อและประเภทห้อง, owner/moderator แก้ topic และ description
+func (s *Server) UpdateRoomHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, callerID, role, ok := s.loadRoomAsMember(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if !models.CanModerate(role) {
+		response.Error(w, r, "Forbidden: moderators only", http.StatusForbidden)
+		return
+	}
+	if room.Archived {
+		response.Error(w, r, "Room is archived", http.StatusConflict)
+		return
+	}
+
+	var req struct {
+		Name        *string `json:"name"`
+		Type        *string `json:"type"`
+		Topic       *string `json:"topic" validate:"omitempty,max=250"`
+		Description *string `json:"description" validate:"omitempty,max=2000"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		response.Validation(w, r, err)
+		return
+	}
+	if (req.Name != nil || req.Type != nil) && role != models.RoomRoleOwner {
+		response.Error(w, r, "Forbidden: only the owner can change the room name or type", http.StatusForbidden)
+		return
+	}
+
+	var update store.RoomUpdate
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			response.Error(w, r, "Invalid room data", http.StatusBadRequest)
+			return
+		}
+		if models.ReservedRoomName(name) {
+			response.Error(w, r, "Room name is reserved", http.StatusBadRequest)
+			return
+		}
+		update.Name = &name
+		room.Name = name
+	}
+	if req.Type != nil {
+		if *req.Type != models.RoomTypePublic && *req.Type != models.RoomTypePrivate {
+			response.Error(w, r, "Invalid room data", http.StatusBadRequest)
+			return
+		}
+		update.Type = req.Type
+		room.Type = *req.Type
+	}
+	if req.Topic != nil {
+		topic := strings.TrimSpace(*req.Topic)
+		update.Topic = &topic
+		room.Topic = topic
+	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		update.Description = &description
+		room.Description = description
+	}
+	if update.Empty() {
+		response.Error(w, r, "Nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	err := s.Store.Rooms.Update(ctx, room.ID, update)
+	if errors.Is(err, store.ErrConflict) {
+		response.Error(w, r, "Room name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomUpdate, Outcome: models.AuditSuccess, ActorID: callerID.Hex(), TargetType: "room", TargetID: room.ID.Hex(), Metadata: map[string]string{"name": room.Name, "type": room.Type}})
+	s.broadcastRoomEvent(r.Context(), roomEvent{Type: roomEventUpdated, RoomID: room.ID.Hex(), Room: &room})
+
+	response.JSON(w, http.StatusOK, room)
+}
+
+// PUT /rooms/{id}/members/{userID}/role — owner ตั้ง moderator หรือลดกลับเป็น member
+func (s *Server) UpdateMemberRoleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, callerID, role, ok := s.loadRoomAsMember(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if role != models.RoomRoleOwner {
+		response.Error(w, r, "Forbidden: owner only", http.StatusForbidden)
+		return
+	}
+
+	targetID, err := primitive.ObjectIDFromHex(r.PathValue("userID"))
+	if err != nil {
+		response.Error(w, r, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if targetID == callerID {
+		response.Error(w, r, "Use transfer ownership to change your own role", http.StatusBadRequest)
+		return
+	}
+	if room.MemberRole(targetID) == "" {
+		response.Error(w, r, "User is not a room member", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Role != models.RoomRoleModerator && req.Role != models.RoomRoleMember {
+		response.Error(w, r, "Role must be moderator or member", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Store.Rooms.SetMemberRole(ctx, room.ID, targetID, req.Role); err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("🛡️ Room member role changed", "room_id", room.ID.Hex(), "target_id", targetID.Hex(), "role", req.Role)
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomRoleChange, Outcome: models.AuditSuccess, ActorID: callerID.Hex(), TargetType: "user", TargetID: targetID.Hex(), Metadata: map[string]string{"room_id": room.ID.Hex(), "role": req.Role}})
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Role updated", "role": req.Role})
+}
+
+// POST /rooms/{id}/transfer — owner ยกห้องให้สมาชิกคนอื่น แล้วตัวเองกลายเป็น moderator
+func (s *Server) TransferOwnershipHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, callerID, role, ok := s.loadRoomAsMember(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if role != models.RoomRoleOwner {
+		response.Error(w, r, "Forbidden: owner only", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	newOwnerID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		response.Error(w, r, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if newOwnerID == callerID {
+		response.Error(w, r, "You already own this room", http.StatusBadRequest)
+		return
+	}
+	if room.MemberRole(newOwnerID) == "" {
+		response.Error(w, r, "User is not a room member", http.StatusNotFound)
+		return
+	}
+
+	err = s.Store.Rooms.TransferOwnership(ctx, room.ID, callerID, newOwnerID)
+	if errors.Is(err, store.ErrConflict) {
+		response.Error(w, r, "Room membership changed, try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("👑 Room ownership transferred", "room_id", room.ID.Hex(), "new_owner_id", newOwnerID.Hex())
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomTransfer, Outcome: models.AuditSuccess, ActorID: callerID.Hex(), TargetType: "user", TargetID: newOwnerID.Hex(), Metadata: map[string]string{"room_id": room.ID.Hex()}})
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Ownership transferred", "owner_id": newOwnerID.Hex()})
+}
+
+// DELETE /rooms/{id}/members/{userID} — owner เตะได้ทุกคน, moderator เตะได้เฉพาะ member
+func (s *Server) KickMemberHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	room, callerID, role, ok := s.loadRoomAsMember(ctx, w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if !models.CanModerate(role) {
+		response.Error(w, r, "Forbidden: moderators only", http.StatusForbidden)
+		return
+	}
+
+	targetID, err := primitive.ObjectIDFromHex(r.PathValue("userID"))
+	if err != nil {
+		response.Error(w, r, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if targetID == callerID {
+		response.Error(w, r, "You cannot kick yourself", http.StatusBadRequest)
+		return
+	}
+
+	targetRole := room.MemberRole(targetID)
+	if targetRole == "" {
+		response.Error(w, r, "User is not a room member", http.StatusNotFound)
+		return
+	}
+	if targetRole == models.RoomRoleOwner || (role == models.RoomRoleModerator && targetRole != models.RoomRoleMember) {
+		response.Error(w, r, "Forbidden: cannot kick this member", http.StatusForbidden)
+		return
+	}
+
+	if err := s.Store.Rooms.RemoveMember(ctx, room.ID, targetID); err != nil {
+		response.Error(w, r, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	// ตัด connection ของคนที่ถูกเตะออกจากห้องทันที ไม่ต้องรอให้เขา unsubscribe เอง
+	for _, c := range s.hub.leaveUser(room.ID.Hex(), targetID.Hex()) {
+		c.sendJSON(map[string]string{"type": "removed", "room_id": room.ID.Hex()})
+	}
+	s.broadcastRoomEvent(r.Context(), roomEvent{Type: roomEventMemberRemoved, RoomID: room.ID.Hex(), UserID: targetID.Hex()})
+
+	logger.FromContext(r.Context()).Info("👢 Room member kicked", "room_id", room.ID.Hex(), "target_id", targetID.Hex())
+	s.Audit.Record(r, models.AuditEvent{Action: models.AuditRoomKick, Outcome: models.AuditSuccess, ActorID: callerID.Hex(), TargetType: "user", TargetID: targetID.Hex(), Metadata: map[string]string{"room_id": room.ID.Hex()}})
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Member removed"})
+}
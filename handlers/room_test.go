@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"mychat-auth/models"
+)
+
+func TestRoomVisibility(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.signUp("admin@example.com", "admin")
+	bob := env.signUp("bob@example.com", "member")
+
+	general := admin.createRoom("general", models.RoomTypePublic)
+	staff := admin.createRoom("staff", models.RoomTypePrivate)
+
+	names := func(c *testClient) []string {
+		t.Helper()
+		var out []string
+		for _, r := range decode[[]models.Room](t, c.expect(http.StatusOK, "GET", "/rooms", nil)) {
+			out = append(out, r.Name)
+		}
+		return out
+	}
+	if got := names(admin); len(got) != 2 {
+		t.Fatalf("admin sees %v, want general and staff", got)
+	}
+	if got := names(bob); len(got) != 1 || got[0] != "general" {
+		t.Fatalf("bob sees %v, want only general", got)
+	}
+
+	// คนนอกห้อง private ได้ 404 เหมือนไม่มีห้อง ห้อง public ได้ 403 จนกว่าจะ join
+	bob.expect(http.StatusNotFound, "GET", "/rooms/"+staff.ID.Hex()+"/messages", nil)
+	bob.expect(http.StatusForbidden, "GET", "/rooms/"+general.ID.Hex()+"/messages", nil)
+	bob.expect(http.StatusForbidden, "POST", "/rooms/"+staff.ID.Hex()+"/join", nil)
+	bob.expect(http.StatusOK, "POST", "/rooms/"+general.ID.Hex()+"/join", nil)
+	bob.expect(http.StatusOK, "GET", "/rooms/"+general.ID.Hex()+"/messages", nil)
+}
+
+func TestCreateRoomRules(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.signUp("admin@example.com", "admin")
+	bob := env.signUp("bob@example.com", "member")
+
+	bob.expect(http.StatusForbidden, "POST", "/rooms", map[string]string{"name": "mine", "type": models.RoomTypePublic})
+	admin.expect(http.StatusUnprocessableEntity, "POST", "/rooms", map[string]string{"name": "general", "type": models.RoomTypeDM})
+	admin.expect(http.StatusBadRequest, "POST", "/rooms", map[string]string{"name": " DM:squat", "type": models.RoomTypePublic})
+
+	room := admin.createRoom("general", models.RoomTypePublic)
+	admin.expect(http.StatusConflict, "POST", "/rooms", map[string]string{"name": "general", "type": models.RoomTypePublic})
+	admin.expect(http.StatusBadRequest, "PATCH", "/rooms/"+room.ID.Hex(), map[string]string{"name": "dm:squat"})
+}
+
+func TestDirectMessages(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.signUp("alice@example.com", "member")
+	bob := env.signUp("bob@example.com", "member")
+	carol := env.signUp("carol@example.com", "member")
+
+	dm := decode[models.Room](t, alice.expect(http.StatusCreated, "POST", "/dms", map[string][]string{"user_ids": {bob.userID.Hex()}}))
+	if dm.Type != models.RoomTypeDM || !dm.IsMember(alice.userID) || !dm.IsMember(bob.userID) {
+		t.Fatalf("created DM = %+v, want a dm with alice and bob", dm)
+	}
+
+	// อีกฝ่ายเปิด DM เดิมได้ห้องเดิม
+	again := decode[models.Room](t, bob.expect(http.StatusOK, "POST", "/dms", map[string][]string{"user_ids": {alice.userID.Hex()}}))
+	if again.ID != dm.ID {
+		t.Fatalf("reopening the DM gave room %s, want %s", again.ID.Hex(), dm.ID.Hex())
+	}
+
+	if got := decode[[]models.Room](t, bob.expect(http.StatusOK, "GET", "/dms", nil)); len(got) != 1 || got[0].ID != dm.ID {
+		t.Fatalf("bob's DMs = %+v, want only the DM with alice", got)
+	}
+	if got := decode[[]models.Room](t, carol.expect(http.StatusOK, "GET", "/dms", nil)); len(got) != 0 {
+		t.Fatalf("carol's DMs = %+v, want none", got)
+	}
+	if got := decode[[]models.Room](t, alice.expect(http.StatusOK, "GET", "/rooms", nil)); len(got) != 0 {
+		t.Fatalf("GET /rooms = %+v, want DMs left out", got)
+	}
+	carol.expect(http.StatusNotFound, "GET", "/rooms/"+dm.ID.Hex()+"/messages", nil)
+	alice.expect(http.StatusBadRequest, "POST", "/dms", map[string][]string{"user_ids": {alice.userID.Hex()}})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"sync/atomic"
+
+	"mychat-auth/audit"
+	"mychat-auth/config"
+	"mychat-auth/store"
+	"mychat-auth/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// Server เก็บ dependency ที่ handler ต้องใช้ แทนการอ่าน env หรือค่า hardcode เอง
+// ข้อมูลทั้งหมดผ่าน Store จึงใช้ store.NewMemory() แทน Mongo/Redis ตอน test ได้
+type Server struct {
+	Config  *config.Config
+	Store   store.Stores
+	Audit   *audit.Recorder
+	JWT     *utils.JWTManager
+	Cookies *utils.CookiePolicy
+	CSRF    *utils.CSRFSigner
+	Origins *utils.OriginPolicy
+	// ReadyChecks คือ dependency ที่ /readyz ต้อง ping ผ่าน (เช่น mongo, redis) ว่างได้ถ้าใช้ store ใน memory
+	ReadyChecks map[string]func(context.Context) error
+
+	upgrader websocket.Upgrader
+	hub      *hub
+	draining atomic.Bool
+}
+
+func NewServer(cfg *config.Config, stores store.Stores, jwt *utils.JWTManager, cookies *utils.CookiePolicy, csrf *utils.CSRFSigner, origins *utils.OriginPolicy) *Server {
+	return &Server{
+		Config:  cfg,
+		Store:   stores,
+		Audit:   audit.NewRecorder(stores.Audit, cfg.HTTP.TrustedProxies),
+		JWT:     jwt,
+		Cookies: cookies,
+		CSRF:    csrf,
+		Origins: origins,
+		// WebSocket ใช้ allowlist เดียวกับ CORS ไม่งั้นเว็บอื่นเปิด socket ด้วย cookie ของ user ได้
+		upgrader: websocket.Upgrader{CheckOrigin: origins.AllowRequest},
+		hub:      newHub(),
+	}
+}
+
+// MarkDraining ทำให้ /readyz ตอบ 503 ทันทีที่เริ่ม shutdown
+func (s *Server) MarkDraining() {
+	s.draining.Store(true)
+}
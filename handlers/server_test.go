@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mychat-auth/config"
+	"mychat-auth/middleware"
+	"mychat-auth/models"
+	"mychat-auth/store"
+	"mychat-auth/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testEnv คือ Server บน store.NewMemory() ต่อ middleware แบบเดียวกับ cmd_serve.go
+// เพื่อให้ test ผ่านการตรวจ cookie, JWT และ CSRF เหมือน request จริง
+type testEnv struct {
+	t       *testing.T
+	srv     *Server
+	store   store.Stores
+	handler http.Handler
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	cfg := config.Default()
+	cfg.JWT.Secret = "test-secret"
+	cfg.Cookie.Domain = ""
+
+	stores := store.NewMemory()
+	jwt := utils.NewJWTManager(cfg.JWT.Secret, cfg.JWT.AccessTTL, cfg.JWT.RefreshTTL)
+	cookies := utils.NewCookiePolicy(cfg, cfg.JWT.AccessTTL, cfg.JWT.RefreshTTL)
+	csrfSigner, err := utils.NewCSRFSigner("test-csrf-secret")
+	if err != nil {
+		t.Fatalf("csrf signer: %v", err)
+	}
+	origins, err := utils.NewOriginPolicy(nil)
+	if err != nil {
+		t.Fatalf("origin policy: %v", err)
+	}
+	srv := NewServer(cfg, stores, jwt, cookies, csrfSigner, origins)
+	auth := middleware.NewAuth(jwt, cookies, stores.Sessions)
+	csrf := middleware.NewCSRF(csrfSigner, cookies, origins, jwt)
+
+	// route เท่าที่ test ใช้ ตรงกับ newRouter ใน router.go
+	mux := http.NewServeMux()
+	authed := func(h http.HandlerFunc) http.Handler { return auth.JWTAuthMiddleware(h) }
+	mux.HandleFunc("POST /register", srv.RegisterHandler)
+	mux.HandleFunc("POST /login", srv.LoginHandler)
+	mux.Handle("GET /me", authed(srv.MeHandler))
+	mux.Handle("POST /logout", authed(srv.LogoutHandler))
+	mux.HandleFunc("POST /auth/refresh", srv.RefreshHandler)
+	mux.HandleFunc("GET /auth/csrf", srv.CSRFTokenHandler)
+	mux.Handle("GET /rooms", authed(srv.GetRoomsHandler))
+	mux.Handle("POST /rooms", auth.RequireAdmin(http.HandlerFunc(srv.CreateRoomHandler)))
+	mux.Handle("GET /admin/ws/rooms", auth.RequireAdmin(http.HandlerFunc(srv.WSRoomsHandler)))
+	mux.Handle("PATCH /rooms/{id}", authed(srv.UpdateRoomHandler))
+	mux.Handle("POST /rooms/{id}/join", authed(srv.JoinRoomHandler))
+	mux.Handle("POST /rooms/{id}/invite-links", authed(srv.CreateInviteLinkHandler))
+	mux.Handle("POST /invite-links/accept", authed(srv.AcceptInviteLinkHandler))
+	mux.Handle("POST /dms", authed(srv.CreateDMHandler))
+	mux.Handle("GET /dms", authed(srv.GetDMsHandler))
+	mux.Handle("GET /rooms/{id}/messages", authed(srv.GetRoomMessagesHandler))
+	mux.Handle("PATCH /rooms/{id}/messages/{messageID}", authed(srv.EditMessageHandler))
+	mux.Handle("DELETE /rooms/{id}/messages/{messageID}", authed(srv.DeleteMessageHandler))
+	mux.Handle("GET /rooms/{id}/messages/{messageID}/edits", authed(srv.MessageEditsHandler))
+	mux.Handle("GET /rooms/{id}/messages/{messageID}/thread", authed(srv.MessageThreadHandler))
+
+	return &testEnv{t: t, srv: srv, store: stores, handler: csrf.Protect(mux)}
+}
+
+// testClient จำ cookie และ CSRF token ไว้ข้าม request เหมือน browser หนึ่งตัว
+type testClient struct {
+	env     *testEnv
+	cookies map[string]*http.Cookie
+	csrf    string
+	userID  primitive.ObjectID
+}
+
+// client คืน client ใหม่ที่ขอ CSRF token ของผู้ที่ยังไม่ login มาแล้ว
+func (e *testEnv) client() *testClient {
+	c := &testClient{env: e, cookies: map[string]*http.Cookie{}}
+	c.csrf = decode[map[string]string](e.t, c.expect(http.StatusOK, "GET", "/auth/csrf", nil))["csrf_token"]
+	return c
+}
+
+// signUp สมัครและ login ด้วยอีเมลนี้ role ที่ไม่ใช่ "member" ตั้งผ่าน store แบบเดียวกับ CLI
+func (e *testEnv) signUp(email, role string) *testClient {
+	e.t.Helper()
+	c := e.client()
+	body := map[string]string{"email": email, "password": "password123"}
+	c.userID = models.StringToObjectID(decode[map[string]string](e.t, c.expect(http.StatusCreated, "POST", "/register", body))["userID"])
+	if role != "member" {
+		if err := e.store.Users.SetRole(context.Background(), c.userID, role); err != nil {
+			e.t.Fatalf("set role: %v", err)
+		}
+	}
+	c.login(email, "password123")
+	return c
+}
+
+func (c *testClient) login(email, password string) {
+	c.env.t.Helper()
+	rec := c.expect(http.StatusOK, "POST", "/login", map[string]string{"email": email, "password": password})
+	c.csrf = decode[map[string]any](c.env.t, rec)["csrf_token"].(string)
+}
+
+// do ส่ง request พร้อม cookie ที่มี ถ้าเป็น method ที่เปลี่ยน state จะแนบ CSRF token ไปด้วย
+func (c *testClient) do(method, path string, body any) *httptest.ResponseRecorder {
+	c.env.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			c.env.t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	for _, ck := range c.cookies {
+		req.AddCookie(ck)
+	}
+	if method != http.MethodGet {
+		req.Header.Set(middleware.CSRFHeader, c.csrf)
+	}
+
+	rec := httptest.NewRecorder()
+	c.env.handler.ServeHTTP(rec, req)
+	for _, ck := range rec.Result().Cookies() {
+		if ck.MaxAge < 0 {
+			delete(c.cookies, ck.Name)
+			continue
+		}
+		c.cookies[ck.Name] = ck
+	}
+	return rec
+}
+
+// expect เหมือน do แต่ให้ test ล้มทันทีถ้า status ไม่ตรง
+func (c *testClient) expect(status int, method, path string, body any) *httptest.ResponseRecorder {
+	c.env.t.Helper()
+	rec := c.do(method, path, body)
+	if rec.Code != status {
+		c.env.t.Fatalf("%s %s: status %d, want %d: %s", method, path, rec.Code, status, rec.Body.String())
+	}
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+// createRoom ให้ admin สร้างห้องผ่าน API
+func (c *testClient) createRoom(name, roomType string) models.Room {
+	c.env.t.Helper()
+	return decode[models.Room](c.env.t, c.expect(http.StatusCreated, "POST", "/rooms", map[string]string{"name": name, "type": roomType}))
+}
+
+// postMessage บันทึกข้อความตรงลง store ข้อความใหม่ส่งผ่าน WebSocket เท่านั้น
+// reply จะนับเข้า thread แบบเดียวกับที่ hub ทำ
+func (e *testEnv) postMessage(roomID primitive.ObjectID, sender *testClient, content string, at time.Time, parentID *primitive.ObjectID) models.Message {
+	e.t.Helper()
+	ctx := context.Background()
+	m := models.Message{RoomID: roomID, SenderID: sender.userID, Content: content, CreatedAt: at, ParentID: parentID}
+	if err := e.store.Messages.Create(ctx, &m); err != nil {
+		e.t.Fatalf("create message: %v", err)
+	}
+	if parentID != nil {
+		if _, err := e.store.Messages.AddReply(ctx, roomID, *parentID, at); err != nil {
+			e.t.Fatalf("add reply: %v", err)
+		}
+	}
+	return m
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var validate = newValidator()
+
+// newValidator ให้ชื่อ field ใน error ตรงกับชื่อใน JSON ที่ client ส่งมา (email แทน Email)
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		switch name {
+		case "-":
+			return ""
+		case "":
+			return strings.ToLower(f.Name)
+		}
+		return name
+	})
+	return v
+}
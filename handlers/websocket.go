@@ -3,161 +3,297 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
-	"mychat-auth/database"
+	"errors"
+	"log/slog"
+	"mychat-auth/metrics"
 	"mychat-auth/models"
+	"mychat-auth/shared/logger"
+	"mychat-auth/shared/response"
+	"mychat-auth/store"
+	"mychat-auth/tracing"
 	"mychat-auth/utils"
 	"net/http"
-	"strings"
-	"sync"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
-
-// roomID -> map[connection]userID
-var roomConnections = make(map[string]map[*websocket.Conn]string)
-var mu sync.Mutex
+// ชนิดของ event ที่ client ส่งมา ถ้าไม่ระบุ type ถือเป็นการส่งข้อความ (client รุ่นเก่า)
+const (
+	wsEventMessage     = "message"
+	wsEventSubscribe   = "subscribe"
+	wsEventUnsubscribe = "unsubscribe"
+	wsEventEdit        = "edit"
+	wsEventDelete      = "delete"
+)
 
 // MessageEvent represents incoming WebSocket messages from the client
+// MessageID ใช้กับ edit/delete ส่วน edit ส่งเนื้อหาใหม่มาใน Text
+// ParentID ทำให้ข้อความที่ส่งเป็น reply ใน thread ของข้อความนั้น
+// TraceParent/TraceState เป็น W3C trace-context ที่ client แนบมาได้ เพื่อต่อ trace จากฝั่ง browser
 type MessageEvent struct {
-	Type   string `json:"type"`
-	RoomID string `json:"room_id"`
-	Text   string `json:"text,omitempty"`
+	Type        string `json:"type"`
+	RoomID      string `json:"room_id"`
+	MessageID   string `json:"message_id,omitempty"`
+	ParentID    string `json:"parent_id,omitempty"`
+	Text        string `json:"text,omitempty"`
+	TraceParent string `json:"traceparent,omitempty"`
+	TraceState  string `json:"tracestate,omitempty"`
 }
 
-func parseTokenFromCookie(cookieHeader string) string {
-	cookies := strings.Split(cookieHeader, ";")
-	for _, c := range cookies {
-		c = strings.TrimSpace(c)
-		if strings.HasPrefix(c, "token=") {
-			return strings.TrimPrefix(c, "token=")
-		}
+func (s *Server) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	if s.hub.isClosing() {
+		response.Error(w, r, "Server is shutting down", http.StatusServiceUnavailable)
+		return
 	}
-	return ""
-}
 
-func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
-	cookieHeader := r.Header.Get("Cookie")
-	token := parseTokenFromCookie(cookieHeader)
+	token := s.Cookies.AccessToken(r)
 	if token == "" {
-		http.Error(w, "Missing or invalid token", http.StatusUnauthorized)
+		utils.TokenMissing()
+		response.Error(w, r, "Missing or invalid token", http.StatusUnauthorized)
 		return
 	}
 
-	claims, err := utils.ValidateToken(token)
+	claims, err := s.JWT.ValidateToken(token)
 	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		response.Error(w, r, "Invalid token", http.StatusUnauthorized)
 		return
 	}
+	if s.rejectRevoked(w, r, claims) {
+		return
+	}
+
+	// conn_id ติดทุกบรรทัด log ของ session นี้ และส่งให้ client ใน event "connected"
+	connID := utils.RandomID()
+	log := logger.FromContext(r.Context()).With("user_id", claims.UserID, "conn_id", connID)
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("chat.conn_id", connID))
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// Upgrade เขียน response เองผ่าน hijacked conn จึงต้องส่ง header ที่อยากให้ client เห็นเข้าไปตรงนี้
+	conn, err := s.upgrader.Upgrade(w, r, http.Header{
+		"X-Request-ID":    {response.RequestID(r)},
+		"X-Connection-ID": {connID},
+	})
 	if err != nil {
-		log.Println("WebSocket upgrade error:", err)
+		log.Warn("WebSocket upgrade error", "error", err)
 		return
 	}
 
 	userID := claims.UserID
 	userName := claims.Email
-	log.Printf("✅ WebSocket connected: user %s (%s)", userID, userName)
 
-	defer func() {
+	client := newWSClient(conn, connID, userID)
+	if !s.hub.register(client) {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+			time.Now().Add(wsWriteWait))
 		conn.Close()
-		removeConnectionFromAllRooms(conn)
-	}()
+		return
+	}
+	go client.writePump()
+	log.Info("✅ WebSocket connected", "email", userName)
 
-	conn.SetReadLimit(512)
-	conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	conn.SetPongHandler(func(string) error {
-		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		return nil
+	hello, _ := json.Marshal(map[string]string{
+		"type":       "connected",
+		"conn_id":    connID,
+		"request_id": response.RequestID(r),
 	})
+	client.enqueue(hello)
 
-	go func() {
-		ticker := time.NewTicker(54 * time.Second)
-		defer ticker.Stop()
-		for {
-			<-ticker.C
-			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				return
-			}
+	defer func() {
+		s.hub.unregister(client)
+		code := websocket.CloseNormalClosure
+		if s.hub.isClosing() {
+			code = websocket.CloseGoingAway
 		}
+		client.close(code, "")
 	}()
 
+	conn.SetReadLimit(wsReadLimit)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		return nil
+	})
+
 	for {
 		var msg MessageEvent
 		err := conn.ReadJSON(&msg)
 		if err != nil {
-			log.Printf("🔌 WebSocket closed: %v", err)
+			log.Info("🔌 WebSocket closed", "error", err)
 			break
 		}
 
-		mu.Lock()
-		if _, ok := roomConnections[msg.RoomID]; !ok {
-			roomConnections[msg.RoomID] = make(map[*websocket.Conn]string)
+		if !s.hub.beginWork() {
+			break
 		}
-		roomConnections[msg.RoomID][conn] = userID
-		mu.Unlock()
 
-		log.Printf("📩 Message from user %s in room %s: %s", userID, msg.RoomID, msg.Text)
+		ctx, span := startMessageSpan(r.Context(), msg)
+		span.SetAttributes(attribute.String("chat.conn_id", connID))
+		log.Debug("📩 Event received", "type", msg.Type, "room_id", msg.RoomID, "length", len(msg.Text), "trace_id", tracing.TraceID(ctx))
 
-		err = SaveMessageToMongo(msg.RoomID, userID, userName, msg.Text)
-		if err != nil {
-			log.Println("❌ Failed to save message to MongoDB:", err)
-		} else {
-			log.Println("💾 Message saved to MongoDB")
+		if apiErr := s.handleEvent(ctx, r, client, msg, userName); apiErr != nil {
+			tracing.RecordError(span, apiErr)
+			log.Warn("🚫 WebSocket event rejected", "type", msg.Type, "room_id", msg.RoomID, "code", apiErr.Code, "error", apiErr.Message)
+			client.sendJSON(map[string]string{
+				"type":    "error",
+				"room_id": msg.RoomID,
+				"code":    apiErr.Code,
+				"message": apiErr.Message,
+			})
 		}
 
-		broadcastToRoom(msg.RoomID, userID, userName, msg.Text)
+		span.End()
+		s.hub.endWork()
 	}
 }
 
-func removeConnectionFromAllRooms(conn *websocket.Conn) {
-	mu.Lock()
-	defer mu.Unlock()
-	for roomID, conns := range roomConnections {
-		if _, ok := conns[conn]; ok {
-			delete(conns, conn)
-			log.Printf("❌ Disconnected from room %s", roomID)
+// handleEvent ทำตาม event หนึ่งตัวจาก client ทั้ง subscribe และส่งข้อความต้องเป็นสมาชิกของห้อง
+// คืน error ที่จะส่งกลับให้ client เป็น event "error" ส่วน r คือ request ตอน upgrade ใช้บันทึก audit
+func (s *Server) handleEvent(ctx context.Context, r *http.Request, c *wsClient, msg MessageEvent, sender string) *response.APIError {
+	// hub ใช้ room.ID.Hex() เป็น key เสมอ id ที่ client ส่งมาต้องแปลงก่อน ไม่งั้นตัวพิมพ์ใหญ่จะได้คนละ key
+	if msg.Type == wsEventUnsubscribe {
+		roomID, err := primitive.ObjectIDFromHex(msg.RoomID)
+		if err != nil {
+			return response.NewError(http.StatusBadRequest, response.CodeBadRequest, "Invalid room ID")
 		}
+		s.hub.leave(roomID.Hex(), c)
+		return nil
 	}
-}
 
-func broadcastToRoom(roomID, senderID, senderName, text string) {
-	mu.Lock()
-	conns := roomConnections[roomID]
-	mu.Unlock()
+	room, apiErr := s.memberRoom(ctx, msg.RoomID, c.userID)
+	if apiErr != nil {
+		return apiErr
+	}
 
-	roomObjID, err := primitive.ObjectIDFromHex(roomID)
+	switch msg.Type {
+	case wsEventSubscribe:
+		s.hub.join(room.ID.Hex(), c)
+		c.sendJSON(map[string]string{"type": "subscribed", "room_id": room.ID.Hex()})
+		return nil
+	case wsEventMessage, "":
+		if room.Archived {
+			return response.NewError(http.StatusConflict, response.CodeConflict, "Room is archived")
+		}
+		if apiErr := checkMessageLength(msg.Text); apiErr != nil {
+			return apiErr
+		}
+		var parentID *primitive.ObjectID
+		if msg.ParentID != "" {
+			root, apiErr := s.threadRoot(ctx, room.ID, msg.ParentID)
+			if apiErr != nil {
+				return apiErr
+			}
+			if root.IsDeleted() {
+				return response.NewError(http.StatusConflict, response.CodeConflict, "Message has been deleted")
+			}
+			parentID = &root.ID
+		}
+		// ส่งข้อความถือว่า subscribe ห้องนั้นไปด้วย เหมือนพฤติกรรมเดิมของ client
+		s.hub.join(room.ID.Hex(), c)
+		message, err := s.saveMessage(ctx, room.ID, parentID, c.userID, sender, msg.Text)
+		if err != nil {
+			return response.NewError(http.StatusInternalServerError, response.CodeInternal, "Failed to save message")
+		}
+		metrics.WSMessages.WithLabelValues("sent").Inc()
+		s.broadcastMessage(ctx, message)
+		if parentID != nil {
+			s.addReply(ctx, message)
+		}
+		if room.Type == models.RoomTypeDM {
+			// inbox เรียงตามเวลานี้ ถ้าบันทึกไม่ได้ข้อความก็ยังส่งไปแล้ว แค่ลำดับใน inbox ไม่ขยับ
+			if err := s.Store.Rooms.Touch(ctx, room.ID, message.CreatedAt); err != nil {
+				logger.FromContext(ctx).Warn("⚠️ Failed to update DM activity", "room_id", room.ID.Hex(), "error", err)
+			}
+		}
+		return nil
+	case wsEventEdit, wsEventDelete:
+		// ผลลัพธ์ส่งถึงทุกคนรวมถึงผู้แก้ผ่าน message_updated/message_deleted ถ้า subscribe ห้องอยู่
+		callerID, _ := primitive.ObjectIDFromHex(c.userID)
+		var apiErr *response.APIError
+		if msg.Type == wsEventEdit {
+			_, apiErr = s.editMessage(ctx, r, room, callerID, msg.MessageID, msg.Text)
+		} else {
+			_, apiErr = s.deleteMessage(ctx, r, room, callerID, room.MemberRole(callerID), msg.MessageID)
+		}
+		return apiErr
+	default:
+		return response.NewError(http.StatusBadRequest, response.CodeBadRequest, "Unknown event type")
+	}
+}
+
+// memberRoom โหลดห้องและตรวจว่า user เป็นสมาชิก ห้อง private ที่ไม่ได้เป็นสมาชิกตอบเหมือนไม่มีห้อง
+func (s *Server) memberRoom(ctx context.Context, roomIDHex, userIDHex string) (models.Room, *response.APIError) {
+	roomID, err := primitive.ObjectIDFromHex(roomIDHex)
 	if err != nil {
-		log.Println("❌ Invalid roomID for broadcast:", err)
-		return
+		return models.Room{}, response.NewError(http.StatusBadRequest, response.CodeBadRequest, "Invalid room ID")
+	}
+	userID, err := primitive.ObjectIDFromHex(userIDHex)
+	if err != nil {
+		return models.Room{}, response.NewError(http.StatusUnauthorized, response.CodeUnauthorized, "Invalid user")
 	}
 
-	senderObjID, err := primitive.ObjectIDFromHex(senderID)
+	room, err := s.Store.Rooms.ByID(ctx, roomID)
+	if errors.Is(err, store.ErrNotFound) {
+		return room, response.NewError(http.StatusNotFound, response.CodeNotFound, "Room not found")
+	}
 	if err != nil {
-		log.Println("❌ Invalid senderID for broadcast:", err)
-		return
+		return room, response.NewError(http.StatusInternalServerError, response.CodeInternal, "DB error")
+	}
+	if !room.IsMember(userID) {
+		if room.IsPrivate() {
+			return room, response.NewError(http.StatusNotFound, response.CodeNotFound, "Room not found")
+		}
+		return room, response.NewError(http.StatusForbidden, response.CodeForbidden, "Not a member of this room")
 	}
+	return room, nil
+}
 
-	message := models.Message{
-		ID:        primitive.NewObjectID(),
-		RoomID:    roomObjID,
-		SenderID:  senderObjID,
-		Sender:    senderName,
-		Content:   text,
-		CreatedAt: time.Now(),
+// startMessageSpan เปิด span "ws.receive" ของข้อความหนึ่งข้อความ
+// ถ้า client แนบ traceparent มาจะต่อ trace นั้น ไม่งั้นเริ่ม trace ใหม่
+// ทั้งสองแบบ link กลับไปที่ span ของ connection (/ws) ซึ่งเปิดค้างตลอดอายุ connection
+func startMessageSpan(connCtx context.Context, msg MessageEvent) (context.Context, trace.Span) {
+	parent := context.Background()
+	if msg.TraceParent != "" {
+		parent = otel.GetTextMapPropagator().Extract(parent, propagation.MapCarrier{
+			"traceparent": msg.TraceParent,
+			"tracestate":  msg.TraceState,
+		})
 	}
+	return tracing.Start(parent, "ws.receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.LinkFromContext(connCtx)),
+		trace.WithAttributes(
+			attribute.String("chat.room_id", msg.RoomID),
+			attribute.String("chat.event_type", msg.Type),
+			attribute.Int("chat.message_length", len(msg.Text)),
+		),
+	)
+}
+
+// broadcastMessage กระจายข้อความที่บันทึกแล้วให้ทุกคนในห้อง (ใช้ ID เดียวกับใน Mongo)
+func (s *Server) broadcastMessage(ctx context.Context, message models.Message) {
+	_, span := tracing.Start(ctx, "ws.fanout", trace.WithAttributes(
+		attribute.String("chat.room_id", message.RoomID.Hex()),
+		attribute.String("chat.message_id", message.ID.Hex()),
+	))
+	defer span.End()
 
+	parentID := ""
+	if message.ParentID != nil {
+		parentID = message.ParentID.Hex()
+	}
 	data, _ := json.Marshal(struct {
 		Type      string    `json:"type"`
 		ID        string    `json:"id"`
 		RoomID    string    `json:"room_id"`
+		ParentID  string    `json:"parent_id,omitempty"`
 		SenderID  string    `json:"sender_id"`
 		Sender    string    `json:"sender"`
 		Content   string    `json:"content"`
@@ -166,46 +302,123 @@ func broadcastToRoom(roomID, senderID, senderName, text string) {
 		Type:      "message",
 		ID:        message.ID.Hex(),
 		RoomID:    message.RoomID.Hex(),
+		ParentID:  parentID,
 		SenderID:  message.SenderID.Hex(),
 		Sender:    message.Sender,
 		Content:   message.Content,
 		CreatedAt: message.CreatedAt,
 	})
 
-	log.Printf("📢 Broadcasting to %d connections in room %s", len(conns), roomID)
-	for conn := range conns {
-		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
-			log.Println("Write error:", err)
-			conn.Close()
-			removeConnectionFromAllRooms(conn)
-		}
-	}
+	delivered, dropped := s.hub.broadcast(message.RoomID.Hex(), data)
+	span.SetAttributes(
+		attribute.Int("chat.recipients", delivered),
+		attribute.Int("chat.dropped", dropped),
+	)
 }
 
-func SaveMessageToMongo(roomIDStr, userIDStr, senderName, content string) error {
-	roomID, err := primitive.ObjectIDFromHex(roomIDStr)
-	if err != nil {
-		log.Println("❌ Invalid roomID:", err)
-		return err
-	}
+// ชนิดของ room event ที่ส่งให้ทุก connection ที่ subscribe ห้องอยู่
+const (
+	roomEventUpdated       = "room_updated"
+	roomEventArchived      = "room_archived"
+	roomEventUnarchived    = "room_unarchived"
+	roomEventDeleted       = "room_deleted"
+	roomEventMemberLeft    = "member_left"
+	roomEventMemberRemoved = "member_removed"
+)
+
+// roomEvent คือ event ที่แจ้งการเปลี่ยนแปลงของห้อง Room มีเฉพาะตอนข้อมูลห้องเปลี่ยน
+// UserID มีเฉพาะ event ของสมาชิก
+type roomEvent struct {
+	Type   string       `json:"type"`
+	RoomID string       `json:"room_id"`
+	Room   *models.Room `json:"room,omitempty"`
+	UserID string       `json:"user_id,omitempty"`
+}
+
+// broadcastRoomEvent ส่ง room event ให้ทุก connection ที่ subscribe ห้องนั้นบน instance นี้
+func (s *Server) broadcastRoomEvent(ctx context.Context, ev roomEvent) {
+	_, span := tracing.Start(ctx, "ws.room_event", trace.WithAttributes(
+		attribute.String("chat.room_id", ev.RoomID),
+		attribute.String("chat.event", ev.Type),
+	))
+	defer span.End()
+
+	data, _ := json.Marshal(ev)
+	delivered, dropped := s.hub.broadcast(ev.RoomID, data)
+	span.SetAttributes(
+		attribute.Int("chat.recipients", delivered),
+		attribute.Int("chat.dropped", dropped),
+	)
+}
+
+// Shutdown ปิด WebSocket ทุกตัวอย่างสุภาพ ใช้ตอน service กำลังจะหยุด
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.hub.shutdown(ctx)
+}
+
+// saveMessage บันทึกข้อความที่มาจาก WebSocket ลง MessageStore ผู้เรียกตรวจสิทธิ์ในห้องและ parent มาแล้ว
+func (s *Server) saveMessage(ctx context.Context, roomID primitive.ObjectID, parentID *primitive.ObjectID, userIDStr, senderName, content string) (models.Message, error) {
+	ctx, span := tracing.Start(ctx, "ws.persist")
+	defer span.End()
 
 	senderID, err := primitive.ObjectIDFromHex(userIDStr)
 	if err != nil {
-		log.Println("❌ Invalid senderID:", err)
-		return err
+		slog.Warn("❌ Invalid senderID", "error", err)
+		return models.Message{}, err
 	}
 
 	message := models.Message{
+		ID:        primitive.NewObjectID(),
 		RoomID:    roomID,
+		ParentID:  parentID,
 		SenderID:  senderID,
 		Sender:    senderName,
 		Content:   content,
 		CreatedAt: time.Now(),
 	}
 
-	_, err = database.MessageCollection.InsertOne(context.TODO(), message)
+	err = s.Store.Messages.Create(ctx, &message)
 	if err != nil {
-		log.Println("❌ MongoDB insert error:", err)
+		tracing.RecordError(span, err)
+		slog.Error("❌ MongoDB insert error", "error", err)
 	}
-	return err
+	return message, err
+}
+
+// roomConnectionCount คือจำนวน connection ที่ subscribe ห้องหนึ่งอยู่
+type roomConnectionCount struct {
+	RoomID      string `json:"room_id"`
+	Connections int    `json:"connections"`
+}
+
+// GET /admin/ws/rooms — ห้องที่มีคน subscribe มากที่สุดก่อน (admin เท่านั้น) ?limit= ไม่เกิน 1000 ค่าเริ่มต้น 100
+// ใช้แทน metric รายห้องซึ่งจะมี label ไม่จำกัดตามจำนวนห้อง
+func (s *Server) WSRoomsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	counts := s.hub.roomCounts()
+	rooms := make([]roomConnectionCount, 0, len(counts))
+	total := 0
+	for roomID, n := range counts {
+		rooms = append(rooms, roomConnectionCount{RoomID: roomID, Connections: n})
+		total += n
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		if rooms[i].Connections != rooms[j].Connections {
+			return rooms[i].Connections > rooms[j].Connections
+		}
+		return rooms[i].RoomID < rooms[j].RoomID
+	})
+	if len(rooms) > limit {
+		rooms = rooms[:limit]
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"rooms":         rooms,
+		"active_rooms":  len(counts),
+		"subscriptions": total,
+	})
 }
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"mychat-auth/models"
+)
+
+func TestSubscribeNormalisesRoomID(t *testing.T) {
+	env, room, alice, _ := messageRoom(t)
+	c := newWSClient(nil, "conn-1", alice.userID.Hex())
+	upper := strings.ToUpper(room.ID.Hex())
+
+	subscribed := func() bool {
+		env.srv.hub.mu.Lock()
+		defer env.srv.hub.mu.Unlock()
+		_, ok := env.srv.hub.roomConnections[room.ID.Hex()][c]
+		return ok
+	}
+
+	// id ตัวพิมพ์ใหญ่ต้องได้ key เดียวกับที่ broadcast ใช้
+	if apiErr := env.srv.handleEvent(context.Background(), nil, c, MessageEvent{Type: wsEventSubscribe, RoomID: upper}, "alice"); apiErr != nil {
+		t.Fatalf("subscribe: %v", apiErr.Message)
+	}
+	if !subscribed() {
+		t.Fatal("subscribe with an uppercase room ID did not join the room's hub key")
+	}
+
+	if apiErr := env.srv.handleEvent(context.Background(), nil, c, MessageEvent{Type: wsEventUnsubscribe, RoomID: upper}, "alice"); apiErr != nil {
+		t.Fatalf("unsubscribe: %v", apiErr.Message)
+	}
+	if subscribed() {
+		t.Fatal("unsubscribe with an uppercase room ID left the client in the room")
+	}
+
+	if apiErr := env.srv.handleEvent(context.Background(), nil, c, MessageEvent{Type: wsEventUnsubscribe, RoomID: "nope"}, "alice"); apiErr == nil {
+		t.Fatal("unsubscribe with an invalid room ID was accepted")
+	}
+}
+
+func TestSendMessageLengthLimit(t *testing.T) {
+	env, room, alice, _ := messageRoom(t)
+	c := newWSClient(nil, "conn-1", alice.userID.Hex())
+	send := func(text string) error {
+		if apiErr := env.srv.handleEvent(context.Background(), nil, c, MessageEvent{Type: wsEventMessage, RoomID: room.ID.Hex(), Text: text}, "alice"); apiErr != nil {
+			return errors.New(apiErr.Message)
+		}
+		return nil
+	}
+
+	// นับเป็นตัวอักษร ภาษาไทยยาวเท่าขีดจำกัดต้องส่งได้
+	if err := send(strings.Repeat("ก", maxMessageLength)); err != nil {
+		t.Fatalf("message of maxMessageLength runes rejected: %v", err)
+	}
+	if err := send(strings.Repeat("a", maxMessageLength+1)); err == nil {
+		t.Fatal("message over maxMessageLength accepted")
+	}
+}
+
+func TestWSRoomsCounts(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.signUp("admin@example.com", "admin")
+	bob := env.signUp("bob@example.com", "member")
+	general := admin.createRoom("general", models.RoomTypePublic)
+	staff := admin.createRoom("staff", models.RoomTypePrivate)
+
+	for _, id := range []string{general.ID.Hex(), general.ID.Hex(), staff.ID.Hex()} {
+		c := newWSClient(nil, "conn", admin.userID.Hex())
+		if apiErr := env.srv.handleEvent(context.Background(), nil, c, MessageEvent{Type: wsEventSubscribe, RoomID: id}, "admin"); apiErr != nil {
+			t.Fatalf("subscribe: %v", apiErr.Message)
+		}
+	}
+
+	bob.expect(http.StatusForbidden, "GET", "/admin/ws/rooms", nil)
+	got := decode[struct {
+		Rooms         []roomConnectionCount `json:"rooms"`
+		ActiveRooms   int                   `json:"active_rooms"`
+		Subscriptions int                   `json:"subscriptions"`
+	}](t, admin.expect(http.StatusOK, "GET", "/admin/ws/rooms?limit=1", nil))
+	if got.ActiveRooms != 2 || got.Subscriptions != 3 {
+		t.Fatalf("totals = %d rooms, %d subscriptions; want 2 and 3", got.ActiveRooms, got.Subscriptions)
+	}
+	if len(got.Rooms) != 1 || got.Rooms[0].RoomID != general.ID.Hex() || got.Rooms[0].Connections != 2 {
+		t.Fatalf("rooms = %+v, want only general with 2 connections", got.Rooms)
+	}
+}
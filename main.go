@@ -2,36 +2,40 @@ package main
 
 import (
 	"fmt"
-	"log"
-	"mychat-auth/database"
-	"mychat-auth/handlers"
-	"mychat-auth/middleware"
-	"mychat-auth/utils"
-	"net/http"
+	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		log.Println("🔥 CORS Middleware:", r.URL.Path)
-		if origin != "" {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-		}
+// commands คือคำสั่งย่อยของ mychat-auth ทุกตัวคืน exit code
+var commands = map[string]func(args []string) int{
+	"serve":    runServe,
+	"migrate":  runMigrate,
+	"user":     runUser,
+	"room":     runRoom,
+	"keys":     runKeys,
+	"sessions": runSessions,
+	"seed":     runSeed,
+	"backup":   runBackup,
+}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+const usage = `Usage: mychat-auth <command> [arguments] [flags]
 
-		next.ServeHTTP(w, r)
-	})
-}
+Commands:
+  serve                               run the HTTP/WebSocket server (default)
+  migrate [up|status]                 apply or list Mongo schema migrations
+  user create|promote|reset-password|disable
+  room create|archive
+  keys rotate|list                    manage the JWT signing keyring
+  sessions revoke                     sign a user out everywhere
+  seed                                create the first admin and a default room
+  backup export|restore               snapshot or load users, rooms and messages
+
+Passwords are read from stdin when the -password flag is omitted.
+Every command accepts -config (or CONFIG_FILE); run "mychat-auth <command> -h" for its flags.
+`
 
 func main() {
 	// โหลดค่าจาก .env
@@ -39,24 +43,27 @@ func main() {
 		err := godotenv.Load()
 
 		if err != nil {
-			log.Fatal("ไม่พบไฟล์ .env หรือโหลดไม่สำเร็จ")
+			slog.Error("ไม่พบไฟล์ .env หรือโหลดไม่สำเร็จ", "error", err)
+			os.Exit(1)
 		}
 	}
-	log.Println("🔐 JWT_SECRET =", os.Getenv("JWT_SECRET"))
-	log.Println("🧠 MONGO_URI  =", os.Getenv("MONGO_URI"))
-	log.Println("🔁 REDIS_URL =", os.Getenv("REDIS_URL"))
-	// เชื่อม MongoDB
-	database.InitMongo()
-	utils.InitRedis()
-	// สร้าง route เฉพาะที่เกี่ยวกับ Auth และ User Management
-	http.Handle("/register", corsMiddleware(http.HandlerFunc(handlers.RegisterHandler)))
-	http.Handle("/login", corsMiddleware(http.HandlerFunc(handlers.LoginHandler)))
-	http.Handle("/me", corsMiddleware(middleware.JWTAuthMiddleware(http.HandlerFunc(handlers.MeHandler))))
-	http.Handle("/logout", corsMiddleware(middleware.JWTAuthMiddleware(http.HandlerFunc(handlers.LogoutHandler))))
-	http.Handle("/auth/refresh", corsMiddleware(http.HandlerFunc(handlers.RefreshHandler)))
-	http.Handle("/api/users", corsMiddleware(middleware.JWTAuthMiddleware(http.HandlerFunc(handlers.UsersHandler))))
-
-	port := ":4001"
-	fmt.Println("Auth service running at http://localhost" + port)
-	log.Fatal(http.ListenAndServe(port, nil))
+
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	// ไม่ระบุคำสั่ง หรือเริ่มด้วย flag ถือเป็น serve เพื่อให้ "./main -addr :4001" แบบเดิมยังใช้ได้
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runServe(args)
+	}
+	if args[0] == "help" {
+		fmt.Fprint(os.Stdout, usage)
+		return 0
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+	return cmd(args[1:])
 }
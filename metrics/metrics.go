@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "mychat"
+
+var (
+	// Auth
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "logins_total",
+		Help:      "Login attempts by outcome (success, failure).",
+	}, []string{"outcome"})
+
+	Refreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "refreshes_total",
+		Help:      "Access token refreshes by outcome (success, failure).",
+	}, []string{"outcome"})
+
+	TokenValidationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "token_validation_failures_total",
+		Help:      "Rejected access or refresh tokens by reason (missing, expired, malformed, bad_signature, unknown_key, revoked, invalid).",
+	}, []string{"reason"})
+
+	RateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by a rate limiter, by route.",
+	}, []string{"route"})
+
+	// HTTP
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route pattern, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// WebSocket
+	WSActiveConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "ws",
+		Name:      "active_connections",
+		Help:      "Open WebSocket connections.",
+	})
+
+	// ไม่ติด label room_id เพราะจำนวนห้องโตได้ไม่จำกัด ดูรายห้องได้ที่ GET /admin/ws/rooms
+	WSRoomSubscriptions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "ws",
+		Name:      "room_subscriptions",
+		Help:      "Room subscriptions across all WebSocket connections.",
+	})
+
+	WSActiveRooms = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "ws",
+		Name:      "active_rooms",
+		Help:      "Rooms with at least one subscribed WebSocket connection.",
+	})
+
+	WSMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ws",
+		Name:      "messages_total",
+		Help:      "Chat messages by event: sent (accepted from a client), broadcast (queued to a subscriber), dropped (subscriber queue full or closed).",
+	}, []string{"event"})
+
+	// Datastores
+	MongoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "mongo",
+		Name:      "command_duration_seconds",
+		Help:      "MongoDB command latency by command name and outcome.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command", "outcome"})
+
+	RedisDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "redis",
+		Name:      "command_duration_seconds",
+		Help:      "Redis command latency by command name and outcome.",
+		Buckets:   []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5},
+	}, []string{"command", "outcome"})
+)
+
+// Outcome แปลง error เป็น label "success" หรือ "failure"
+func Outcome(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
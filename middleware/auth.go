@@ -2,50 +2,83 @@ package middleware
 
 import (
 	"context"
-	"log"
 	"mychat-auth/shared/contextkey"
+	"mychat-auth/shared/logger"
+	"mychat-auth/shared/response"
+	"mychat-auth/store"
 	"mychat-auth/utils"
 	"net/http"
 )
 
 type contextKey string
 
-func JWTAuthMiddleware(next http.Handler) http.Handler {
+// Auth รวม middleware ที่ต้องตรวจ token โดยใช้ JWTManager ตัวเดียวกับ handlers
+type Auth struct {
+	JWT      *utils.JWTManager
+	Cookies  *utils.CookiePolicy
+	Sessions store.SessionStore
+}
+
+func NewAuth(jwt *utils.JWTManager, cookies *utils.CookiePolicy, sessions store.SessionStore) *Auth {
+	return &Auth{JWT: jwt, Cookies: cookies, Sessions: sessions}
+}
+
+func (a *Auth) JWTAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Println("🔐 JWTAuthMiddleware called")
+		log := logger.FromContext(r.Context())
 
-		cookie, err := r.Cookie("token")
-		if err != nil || cookie.Value == "" {
-			log.Println("❌ Token not found in cookie:", err)
-			http.Error(w, "Missing or invalid token", http.StatusUnauthorized)
+		tokenString := a.Cookies.AccessToken(r)
+		if tokenString == "" {
+			log.Warn("❌ Token not found in cookie")
+			utils.TokenMissing()
+			response.Error(w, r, "Missing or invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		tokenString := cookie.Value
-		log.Println("🧪 Token received:", tokenString[:10], "...")
-
-		// isBlacklisted, err := utils.IsTokenBlacklisted(tokenString)
+		// isBlacklisted, err := a.Sessions.IsRevoked(r.Context(), tokenString)
 		// if err != nil {
-		// 	log.Println("❌ Redis check failed:", err)
-		// 	http.Error(w, "Server error", http.StatusInternalServerError)
+		// 	log.Error("❌ Redis check failed", "error", err)
+		// 	response.Error(w, r, "Server error", http.StatusInternalServerError)
 		// 	return
 		// }
 		// if isBlacklisted {
-		// 	log.Println("🚫 Token is blacklisted")
-		// 	http.Error(w, "Token revoked", http.StatusUnauthorized)
+		// 	log.Warn("🚫 Token is blacklisted")
+		// 	response.Error(w, r, "Token revoked", http.StatusUnauthorized)
 		// 	return
 		// }
 
-		claims, err := utils.ValidateToken(tokenString)
+		claims, err := a.JWT.ValidateToken(tokenString)
 		if err != nil {
-			log.Println("❌ Token validation failed:", err)
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			log.Warn("❌ Token validation failed", "error", err)
+			response.Error(w, r, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		if a.rejectRevoked(w, r, claims) {
 			return
 		}
-
-		log.Println("✅ Token valid. User ID:", claims.UserID)
 
 		ctx := context.WithValue(r.Context(), contextkey.UserID, claims.UserID)
+		ctx = logger.With(ctx, "user_id", claims.UserID)
+		if info := RequestInfoFrom(ctx); info != nil {
+			info.UserID = claims.UserID
+		}
+		logger.FromContext(ctx).Debug("✅ Token valid")
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// rejectRevoked ตอบ 401 ถ้า session ของ user ถูกเพิกถอนหลังจากออก token นี้ คืน true ถ้าตอบไปแล้ว
+func (a *Auth) rejectRevoked(w http.ResponseWriter, r *http.Request, claims *utils.Claims) bool {
+	revoked, err := utils.SessionRevoked(r.Context(), a.Sessions, claims)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("❌ Session revocation check failed", "error", err)
+		response.Error(w, r, "Server error", http.StatusInternalServerError)
+		return true
+	}
+	if revoked {
+		logger.FromContext(r.Context()).Warn("🚫 Session revoked", "user_id", claims.UserID)
+		response.Error(w, r, "Token revoked", http.StatusUnauthorized)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mychat-auth/shared/logger"
+	"mychat-auth/utils"
+)
+
+var (
+	corsAllowedMethods = strings.Join([]string{
+		http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions,
+	}, ", ")
+	corsAllowedHeaders = strings.Join([]string{"Content-Type", "Authorization", CSRFHeader, RequestIDHeader, "traceparent", "tracestate"}, ", ")
+	// ให้ JS ฝั่ง browser อ่าน request ID จาก response ได้ (ปกติ browser ซ่อน header ที่ไม่ใช่ safelist)
+	corsExposedHeaders = RequestIDHeader
+)
+
+// CORS ตอบ header ให้เฉพาะ origin ที่อยู่ใน allowlist เท่านั้น (ไม่ echo ทุก origin อีกต่อไป)
+// preflight ที่ผ่านจะถูก cache ที่ browser ตาม maxAge
+func CORS(origins *utils.OriginPolicy, maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// response ต่างกันตาม Origin เสมอ ต้องบอก cache กลางทาง
+			w.Header().Add("Vary", "Origin")
+
+			origin := r.Header.Get("Origin")
+			allowed := origin != "" && origins.Allowed(origin)
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				if !allowed {
+					logger.FromContext(r.Context()).Warn("🚫 CORS preflight rejected", "origin", origin)
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+
+	"mychat-auth/shared/logger"
+	"mychat-auth/shared/response"
+	"mychat-auth/utils"
+)
+
+// CSRFHeader คือ header ที่ client ต้องส่ง token มาคู่กับ cookie
+const CSRFHeader = "X-CSRF-Token"
+
+// CSRF ป้องกัน request ที่เปลี่ยน state (POST, PUT, PATCH, DELETE) ซึ่งยืนยันตัวด้วย cookie
+// ตรวจสองชั้น: Origin/Referer ต้องเป็น origin ที่อนุญาต และ header X-CSRF-Token ต้องตรงกับ cookie
+// token ผูกกับ user ของ session จึงต้องใช้ JWT อ่าน user จาก cookie
+type CSRF struct {
+	Signer  *utils.CSRFSigner
+	Cookies *utils.CookiePolicy
+	Origins *utils.OriginPolicy
+	JWT     *utils.JWTManager
+}
+
+func NewCSRF(signer *utils.CSRFSigner, cookies *utils.CookiePolicy, origins *utils.OriginPolicy, jwt *utils.JWTManager) *CSRF {
+	return &CSRF{Signer: signer, Cookies: cookies, Origins: origins, JWT: jwt}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// Protect ครอบทั้ง mux ได้เลย request ที่เป็น safe method จะผ่านไปโดยไม่ตรวจ
+// ไม่มี route ที่ยกเว้น /login และ /register ก็ต้องมี token (กัน login CSRF)
+// client ใหม่จึงต้องเรียก GET /auth/csrf ก่อน ดู README.md
+func (c *CSRF) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		log := logger.FromContext(r.Context())
+
+		if !c.originAllowed(r) {
+			log.Warn("🚫 CSRF origin rejected", "origin", r.Header.Get("Origin"), "referer", r.Referer())
+			response.Fail(w, r, response.NewError(http.StatusForbidden, response.CodeCSRF, "Forbidden: cross-site request"))
+			return
+		}
+
+		subject := utils.CSRFSubject(r, c.Cookies, c.JWT)
+		if !c.Signer.Matches(r.Header.Get(CSRFHeader), c.Cookies.CSRFToken(r), subject) {
+			log.Warn("🚫 CSRF token missing or invalid")
+			response.Fail(w, r, response.NewError(http.StatusForbidden, response.CodeCSRF, "Forbidden: invalid CSRF token"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// originAllowed ใช้ Origin ก่อน ถ้าไม่มีใช้ Referer ถ้าไม่มีทั้งคู่ (client ที่ไม่ใช่ browser)
+// ปล่อยผ่านเพราะยังต้องผ่านการตรวจ token อยู่ดี
+func (c *CSRF) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Referer()
+		if origin == "" {
+			return true
+		}
+	}
+	return c.Origins.SameOriginOrAllowed(r, origin)
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"mychat-auth/shared/contextkey"
+	"mychat-auth/shared/logger"
+	"mychat-auth/tracing"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestInfo เก็บข้อมูลที่ middleware ชั้นในรู้ทีหลัง (route pattern, user) ให้ชั้นนอกอ่านได้ตอนจบ request
+type RequestInfo struct {
+	Route  string
+	UserID string
+}
+
+// RequestInfoFrom คืน RequestInfo ของ request ปัจจุบัน หรือ nil ถ้าไม่ได้ผ่าน RequestLogger
+func RequestInfoFrom(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(contextkey.RequestInfo).(*RequestInfo)
+	return info
+}
+
+// Route บันทึก pattern ของ route ที่ match (เช่น GET /rooms/{id}/messages) แทน path จริง
+// ทำให้ log และ metric ไม่แตกตาม ID ใน path
+func Route(pattern string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if info := RequestInfoFrom(r.Context()); info != nil {
+				info.Route = pattern
+			}
+			// span จาก otelhttp ถูกสร้างก่อนรู้ route จึงตั้งชื่อตาม pattern ตรงนี้
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(pattern)
+			span.SetAttributes(semconv.HTTPRoute(pattern))
+			ctx := logger.With(r.Context(), "route", pattern)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// statusRecorder จำ status code ที่ handler ส่งออกไป เพื่อใช้ตอน log จบ request
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Hijack ต้องส่งต่อให้ ResponseWriter จริง ไม่งั้น WebSocket upgrade จะพัง
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijack not supported")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// RequestLogger ผูก logger ที่มี request_id, method, route เข้ากับ context ของ request
+// แล้ว log สรุปผลเมื่อ request จบ
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		info := &RequestInfo{Route: "unmatched"}
+		ctx := context.WithValue(r.Context(), contextkey.RequestInfo, info)
+		ctx = logger.With(ctx,
+			"request_id", RequestIDFrom(ctx),
+			"method", r.Method,
+			"path", r.URL.Path,
+		)
+		if traceID := tracing.TraceID(ctx); traceID != "" {
+			ctx = logger.With(ctx, "trace_id", traceID)
+		}
+		r = r.WithContext(ctx)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		logger.FromContext(r.Context()).Info("request completed",
+			"route", info.Route,
+			"user_id", info.UserID,
+			"status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	})
+}
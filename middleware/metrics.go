@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"mychat-auth/metrics"
+)
+
+// Metrics เก็บ latency ของทุก request แยกตาม route pattern, method และ status
+// ต้องอยู่ใต้ RequestLogger เพราะอ่าน route จาก RequestInfo
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		route := "unmatched"
+		if info := RequestInfoFrom(r.Context()); info != nil {
+			route = info.Route
+		}
+		metrics.HTTPDuration.
+			WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"mychat-auth/shared/contextkey"
+	"mychat-auth/utils"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader คือ header ที่รับ request ID จาก client/proxy และส่งกลับใน response
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// RequestID รับ X-Request-ID จาก client หรือ proxy ถ้ามีและหน้าตาปลอดภัย ไม่งั้นสร้างใหม่
+// แล้วเก็บไว้ใน context (contextkey.RequestID) และตอบกลับใน header เดียวกัน
+// ต้องอยู่นอก RequestLogger เพื่อให้ทุกบรรทัด log มี request_id
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = utils.RandomID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("request.id", id))
+
+		ctx := context.WithValue(r.Context(), contextkey.RequestID, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFrom คืน request ID ของ request ปัจจุบัน หรือ "" ถ้าไม่ได้ผ่าน RequestID
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(contextkey.RequestID).(string)
+	return id
+}
+
+// validRequestID กันค่าที่ยาวเกินหรือมีตัวอักษรแปลก ๆ ไม่ให้หลุดเข้า log และ header
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
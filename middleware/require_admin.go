@@ -3,30 +3,40 @@ package middleware
 import (
 	"context"
 	"mychat-auth/shared/contextkey"
+	"mychat-auth/shared/logger"
+	"mychat-auth/shared/response"
 	"mychat-auth/utils"
 	"net/http"
 )
 
 // RequireAdmin เป็น middleware ที่ตรวจว่า token มี role เป็น admin หรือไม่
-func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		tokenCookie, err := r.Cookie("token")
-		if err != nil || tokenCookie.Value == "" {
-			http.Error(w, "Missing token", http.StatusUnauthorized)
+func (a *Auth) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := a.Cookies.AccessToken(r)
+		if token == "" {
+			utils.TokenMissing()
+			response.Error(w, r, "Missing token", http.StatusUnauthorized)
 			return
 		}
-		claims, err := utils.ValidateToken(tokenCookie.Value)
+		claims, err := a.JWT.ValidateToken(token)
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			response.Error(w, r, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		if a.rejectRevoked(w, r, claims) {
 			return
 		}
 		if claims.Role != "admin" {
-			http.Error(w, "Forbidden: admin only", http.StatusForbidden)
+			response.Error(w, r, "Forbidden: admin only", http.StatusForbidden)
 			return
 		}
 		// ส่ง user_id และ role เข้า context
 		ctx := context.WithValue(r.Context(), contextkey.UserID, claims.UserID)
 		ctx = context.WithValue(ctx, contextkey.Role, claims.Role) // 🔧 แก้ให้ถูก key ด้วย
-		next(w, r.WithContext(ctx))
-	}
+		ctx = logger.With(ctx, "user_id", claims.UserID)
+		if info := RequestInfoFrom(ctx); info != nil {
+			info.UserID = claims.UserID
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
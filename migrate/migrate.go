@@ -0,0 +1,189 @@
+// Package migrate ดูแล schema ของ Mongo แบบมีเวอร์ชัน: index, JSON schema validator และการแปลงข้อมูล
+// เวอร์ชันที่รันแล้วถูกบันทึกใน collection schema_migrations เพื่อให้แต่ละ migration รันครั้งเดียว
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collection คือชื่อ collection ที่เก็บประวัติ migration
+const Collection = "schema_migrations"
+
+const (
+	lockID  = "lock"
+	lockTTL = 5 * time.Minute
+)
+
+// Migration คือการเปลี่ยน schema หนึ่งขั้น Up ต้องรันซ้ำได้โดยไม่พัง (idempotent)
+// เผื่อ process ตายกลางทางก่อนบันทึกเวอร์ชัน
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+}
+
+// Record คือแถวใน schema_migrations
+type Record struct {
+	Version    int       `bson:"_id" json:"version"`
+	Name       string    `bson:"name" json:"name"`
+	AppliedAt  time.Time `bson:"applied_at" json:"applied_at"`
+	DurationMS int64     `bson:"duration_ms" json:"duration_ms"`
+}
+
+// Status คือสถานะของ migration หนึ่งตัว AppliedAt เป็น nil ถ้ายังไม่ได้รัน
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// ErrLocked คือมี process อื่นกำลังรัน migration อยู่
+var ErrLocked = errors.New("migrate: another process holds the migration lock")
+
+// Up รัน migration ที่ยังไม่เคยรันตามลำดับเวอร์ชัน คืนเวอร์ชันที่รันในครั้งนี้
+// ระหว่างรันจะถือ lock ใน schema_migrations กันหลาย replica รันพร้อมกันตอน deploy
+func Up(ctx context.Context, db *mongo.Database) ([]int, error) {
+	return up(ctx, db, registry())
+}
+
+func up(ctx context.Context, db *mongo.Database, migrations []Migration) ([]int, error) {
+	coll := db.Collection(Collection)
+
+	if err := acquireLock(ctx, coll); err != nil {
+		return nil, err
+	}
+	defer releaseLock(coll)
+
+	applied, err := appliedVersions(ctx, coll)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []int
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		slog.Info("🧱 Applying migration", "version", m.Version, "name", m.Name)
+		start := time.Now()
+		if err := m.Up(ctx, db); err != nil {
+			return ran, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		rec := Record{
+			Version:    m.Version,
+			Name:       m.Name,
+			AppliedAt:  time.Now().UTC(),
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if _, err := coll.InsertOne(ctx, rec); err != nil {
+			return ran, fmt.Errorf("record migration %d: %w", m.Version, err)
+		}
+		ran = append(ran, m.Version)
+	}
+	return ran, nil
+}
+
+// List คืนสถานะของทุก migration ที่รู้จัก เรียงตามเวอร์ชัน
+func List(ctx context.Context, db *mongo.Database) ([]Status, error) {
+	applied, err := appliedVersions(ctx, db.Collection(Collection))
+	if err != nil {
+		return nil, err
+	}
+	var out []Status
+	for _, m := range registry() {
+		st := Status{Version: m.Version, Name: m.Name}
+		if rec, ok := applied[m.Version]; ok {
+			at := rec.AppliedAt
+			st.AppliedAt = &at
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// Pending คืนจำนวน migration ที่ยังไม่ได้รัน
+func Pending(ctx context.Context, db *mongo.Database) (int, error) {
+	list, err := List(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, st := range list {
+		if st.AppliedAt == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// registry คืน migration ทั้งหมดเรียงตามเวอร์ชัน และตรวจว่าเวอร์ชันไม่ซ้ำ
+func registry() []Migration {
+	list := append([]Migration(nil), migrations...)
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i := 1; i < len(list); i++ {
+		if list[i].Version == list[i-1].Version {
+			panic(fmt.Sprintf("migrate: duplicate version %d", list[i].Version))
+		}
+	}
+	return list
+}
+
+func appliedVersions(ctx context.Context, coll *mongo.Collection) (map[int]Record, error) {
+	// _id ของ lock เป็น string จึงกรองเอาเฉพาะเวอร์ชันที่เป็นตัวเลข
+	cursor, err := coll.Find(ctx, bson.M{"_id": bson.M{"$type": "number"}})
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	out := make(map[int]Record, len(records))
+	for _, rec := range records {
+		out[rec.Version] = rec
+	}
+	return out, nil
+}
+
+// acquireLock รอจนได้ lock หรือ context หมดเวลา lock ที่ค้างเกิน lockTTL (process ตาย) ถือว่าหมดอายุ
+func acquireLock(ctx context.Context, coll *mongo.Collection) error {
+	for {
+		now := time.Now().UTC()
+		filter := bson.M{"_id": lockID, "$or": bson.A{
+			bson.M{"locked": false},
+			bson.M{"expires_at": bson.M{"$lt": now}},
+		}}
+		update := bson.M{"$set": bson.M{"locked": true, "expires_at": now.Add(lockTTL)}}
+		_, err := coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err == nil {
+			return nil
+		}
+		// upsert ชน _id เดิมแปลว่ามีคนถือ lock อยู่
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		slog.Info("⏳ Waiting for migration lock")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ErrLocked, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func releaseLock(coll *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := coll.UpdateOne(ctx, bson.M{"_id": lockID}, bson.M{"$set": bson.M{"locked": false}}); err != nil {
+		slog.Error("❌ Failed to release migration lock", "error", err)
+	}
+}
@@ -0,0 +1,141 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestRegistryOrder(t *testing.T) {
+	list := registry()
+	for i, m := range list {
+		if m.Version != i+1 {
+			t.Fatalf("registry()[%d] is version %d, want %d: versions must be contiguous and sorted", i, m.Version, i+1)
+		}
+		if m.Name == "" || m.Up == nil {
+			t.Fatalf("migration %d has no name or Up", m.Version)
+		}
+	}
+}
+
+func TestRegistrySortsAndRejectsDuplicates(t *testing.T) {
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	noop := func(context.Context, *mongo.Database) error { return nil }
+
+	migrations = []Migration{{Version: 3, Name: "c", Up: noop}, {Version: 1, Name: "a", Up: noop}, {Version: 2, Name: "b", Up: noop}}
+	list := registry()
+	for i, want := range []int{1, 2, 3} {
+		if list[i].Version != want {
+			t.Fatalf("registry() = %+v, want versions sorted ascending", list)
+		}
+	}
+
+	migrations = append(migrations, Migration{Version: 2, Name: "b-again", Up: noop})
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registry() did not panic on a duplicate version")
+		}
+	}()
+	registry()
+}
+
+// testDB คืน database ใหม่บน Mongo จริงเมื่อตั้ง MONGO_TEST_URI ไว้ ลบทิ้งเมื่อ test จบ
+func testDB(t *testing.T) *mongo.Database {
+	t.Helper()
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	db := client.Database("mychat_migrate_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		_ = db.Drop(context.Background())
+		_ = client.Disconnect(context.Background())
+	})
+	return db
+}
+
+func TestUpRunsPendingInOrderOnce(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	var order []int
+	step := func(v int) Migration {
+		return Migration{Version: v, Name: "step", Up: func(context.Context, *mongo.Database) error {
+			order = append(order, v)
+			return nil
+		}}
+	}
+
+	ran, err := up(ctx, db, []Migration{step(1), step(2)})
+	if err != nil || len(ran) != 2 || ran[0] != 1 || ran[1] != 2 {
+		t.Fatalf("first up = %v, %v; want [1 2]", ran, err)
+	}
+	ran, err = up(ctx, db, []Migration{step(1), step(2), step(3)})
+	if err != nil || len(ran) != 1 || ran[0] != 3 {
+		t.Fatalf("second up = %v, %v; want only [3]", ran, err)
+	}
+	if len(order) != 3 || order[0] != 1 || order[1] != 2 || order[2] != 3 {
+		t.Fatalf("migrations ran in order %v, want [1 2 3] each once", order)
+	}
+
+	// ตัวที่ล้มไม่ถูกบันทึก รันใหม่ครั้งหน้า
+	failing := Migration{Version: 4, Name: "fails", Up: func(context.Context, *mongo.Database) error { return errors.New("boom") }}
+	if _, err := up(ctx, db, []Migration{step(1), step(2), step(3), failing}); err == nil {
+		t.Fatal("up ignored a failing migration")
+	}
+	applied, err := appliedVersions(ctx, db.Collection(Collection))
+	if err != nil {
+		t.Fatalf("appliedVersions: %v", err)
+	}
+	if _, ok := applied[4]; ok || len(applied) != 3 {
+		t.Fatalf("applied = %v, want 1-3 without the failed 4", applied)
+	}
+}
+
+func TestLockContention(t *testing.T) {
+	db := testDB(t)
+	coll := db.Collection(Collection)
+	ctx := context.Background()
+
+	if err := acquireLock(ctx, coll); err != nil {
+		t.Fatalf("first acquireLock: %v", err)
+	}
+
+	// อีก process รอจนหมดเวลาแล้วได้ ErrLocked
+	waitCtx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	if err := acquireLock(waitCtx, coll); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second acquireLock = %v, want ErrLocked", err)
+	}
+	if _, err := up(waitCtx, db, nil); !errors.Is(err, ErrLocked) {
+		t.Fatalf("up while locked = %v, want ErrLocked", err)
+	}
+
+	releaseLock(coll)
+	if err := acquireLock(ctx, coll); err != nil {
+		t.Fatalf("acquireLock after release: %v", err)
+	}
+
+	// lock ที่ค้างเกิน lockTTL (process ตาย) ถูกยึดได้
+	if _, err := coll.UpdateOne(ctx, bson.M{"_id": lockID}, bson.M{"$set": bson.M{"expires_at": time.Now().Add(-time.Minute)}}); err != nil {
+		t.Fatalf("expire lock: %v", err)
+	}
+	if err := acquireLock(ctx, coll); err != nil {
+		t.Fatalf("acquireLock over an expired lock: %v", err)
+	}
+	releaseLock(coll)
+}
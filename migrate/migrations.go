@@ -0,0 +1,353 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"mychat-auth/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrations คือรายการทั้งหมด เพิ่มตัวใหม่ต่อท้ายเสมอ ห้ามแก้ตัวที่ deploy ไปแล้ว
+var migrations = []Migration{
+	{Version: 1, Name: "users_email_unique", Up: usersEmailUnique},
+	{Version: 2, Name: "rooms_name_unique", Up: roomsNameUnique},
+	{Version: 3, Name: "messages_room_index", Up: messagesRoomIndex},
+	{Version: 4, Name: "audit_events_indexes", Up: auditEventsIndexes},
+	{Version: 5, Name: "backfill_room_member_roles", Up: backfillRoomMemberRoles},
+	{Version: 6, Name: "collection_validators", Up: collectionValidators},
+	{Version: 7, Name: "rooms_members_index", Up: roomsMembersIndex},
+	{Version: 8, Name: "invitations_indexes", Up: invitationsIndexes},
+	{Version: 9, Name: "direct_messages", Up: directMessages},
+	{Version: 10, Name: "messages_room_created_id", Up: messagesRoomCreatedID},
+	{Version: 11, Name: "messages_threads", Up: messagesThreads},
+	{Version: 12, Name: "rooms_dm_key", Up: roomsDMKey},
+}
+
+// users.email ต้องไม่ซ้ำ กัน RegisterHandler สองตัวพร้อมกันสร้าง user ซ้ำ
+func usersEmailUnique(ctx context.Context, db *mongo.Database) error {
+	users := db.Collection("users")
+	if err := checkDuplicates(ctx, users, "email"); err != nil {
+		return err
+	}
+	return createIndexes(ctx, users, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetName("users_email_unique").SetUnique(true),
+	})
+}
+
+func roomsNameUnique(ctx context.Context, db *mongo.Database) error {
+	rooms := db.Collection("rooms")
+	if err := checkDuplicates(ctx, rooms, "name"); err != nil {
+		return err
+	}
+	return createIndexes(ctx, rooms, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetName("rooms_name_unique").SetUnique(true),
+	})
+}
+
+// ประวัติข้อความอ่านตามห้องเรียงตามเวลาเสมอ
+func messagesRoomIndex(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db.Collection("messages"), mongo.IndexModel{
+		Keys:    bson.D{{Key: "room_id", Value: 1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("messages_room_created"),
+	})
+}
+
+// ให้ตรงกับ filter ของ GET /admin/audit
+func auditEventsIndexes(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db.Collection("audit_events"),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("audit_created"),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("audit_actor_created"),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "target_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("audit_target_created"),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "request_id", Value: 1}},
+			Options: options.Index().SetName("audit_request_id").SetSparse(true),
+		},
+	)
+}
+
+// ห้องเก่าก่อนมีระบบ role เก็บสมาชิกโดยไม่มี role เติมให้ครบ (owner_id เป็น owner นอกนั้น member)
+func backfillRoomMemberRoles(ctx context.Context, db *mongo.Database) error {
+	rooms := db.Collection("rooms")
+	cursor, err := rooms.Find(ctx, bson.M{"members": bson.M{"$elemMatch": bson.M{"role": bson.M{"$in": bson.A{nil, ""}}}}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var room models.Room
+		if err := cursor.Decode(&room); err != nil {
+			return err
+		}
+		for i := range room.Members {
+			room.Members[i].Role = room.MemberRole(room.Members[i].ID)
+		}
+		if _, err := rooms.UpdateOne(ctx, bson.M{"_id": room.ID}, bson.M{"$set": bson.M{"members": room.Members}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// validator ใช้ระดับ moderate: เอกสารเก่าที่ไม่ผ่านยังอยู่ได้ แต่ insert/update ใหม่ต้องผ่าน
+func collectionValidators(ctx context.Context, db *mongo.Database) error {
+	schemas := map[string]bson.M{
+		"users": {
+			"bsonType": "object",
+			"required": bson.A{"email", "password"},
+			"properties": bson.M{
+				"email":    bson.M{"bsonType": "string", "minLength": 3},
+				"password": bson.M{"bsonType": "string", "minLength": 1},
+				"role":     bson.M{"enum": bson.A{"admin", "member"}},
+			},
+		},
+		"rooms": {
+			"bsonType": "object",
+			"required": bson.A{"name", "type"},
+			"properties": bson.M{
+				"name": bson.M{"bsonType": "string", "minLength": 1},
+				"type": bson.M{"enum": bson.A{"public", "private"}},
+				"members": bson.M{
+					"bsonType": "array",
+					"items": bson.M{
+						"bsonType": "object",
+						"required": bson.A{"_id"},
+						"properties": bson.M{
+							"_id":  bson.M{"bsonType": "objectId"},
+							"role": bson.M{"enum": bson.A{models.RoomRoleOwner, models.RoomRoleModerator, models.RoomRoleMember}},
+						},
+					},
+				},
+			},
+		},
+		"messages": {
+			"bsonType": "object",
+			"required": bson.A{"room_id", "sender_id", "content", "created_at"},
+			"properties": bson.M{
+				"room_id":    bson.M{"bsonType": "objectId"},
+				"sender_id":  bson.M{"bsonType": "objectId"},
+				"content":    bson.M{"bsonType": "string"},
+				"created_at": bson.M{"bsonType": "date"},
+			},
+		},
+	}
+	for name, schema := range schemas {
+		if err := setValidator(ctx, db, name, schema); err != nil {
+			return fmt.Errorf("%s validator: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// GET /rooms หาห้อง private ที่ user เป็นสมาชิก
+func roomsMembersIndex(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db.Collection("rooms"), mongo.IndexModel{
+		Keys:    bson.D{{Key: "members._id", Value: 1}},
+		Options: options.Index().SetName("rooms_members"),
+	})
+}
+
+// คำเชิญที่ pending ต่อห้องต่อคนมีได้ตัวเดียว ส่วนโค้ดของลิงก์เชิญต้องไม่ซ้ำเพราะใช้หาลิงก์
+func invitationsIndexes(ctx context.Context, db *mongo.Database) error {
+	err := createIndexes(ctx, db.Collection("invitations"),
+		mongo.IndexModel{
+			Keys: bson.D{{Key: "room_id", Value: 1}, {Key: "invitee_id", Value: 1}},
+			Options: options.Index().SetName("invitations_pending_unique").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": models.InvitePending}),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "invitee_id", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("invitations_invitee"),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "room_id", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("invitations_room"),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	return createIndexes(ctx, db.Collection("invite_links"),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetName("invite_links_code_unique").SetUnique(true),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "room_id", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("invite_links_room"),
+		},
+	)
+}
+
+// ห้องแบบ dm: เพิ่ม type ใน validator ของ rooms และ index สำหรับ inbox ของแต่ละคน
+func directMessages(ctx context.Context, db *mongo.Database) error {
+	err := setValidator(ctx, db, "rooms", bson.M{
+		"bsonType": "object",
+		"required": bson.A{"name", "type"},
+		"properties": bson.M{
+			"name": bson.M{"bsonType": "string", "minLength": 1},
+			"type": bson.M{"enum": bson.A{models.RoomTypePublic, models.RoomTypePrivate, models.RoomTypeDM}},
+			"members": bson.M{
+				"bsonType": "array",
+				"items": bson.M{
+					"bsonType": "object",
+					"required": bson.A{"_id"},
+					"properties": bson.M{
+						"_id":  bson.M{"bsonType": "objectId"},
+						"role": bson.M{"enum": bson.A{models.RoomRoleOwner, models.RoomRoleModerator, models.RoomRoleMember}},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("rooms validator: %w", err)
+	}
+	return createIndexes(ctx, db.Collection("rooms"), mongo.IndexModel{
+		Keys: bson.D{{Key: "members._id", Value: 1}, {Key: "last_activity_at", Value: -1}},
+		Options: options.Index().SetName("rooms_dm_inbox").
+			SetPartialFilterExpression(bson.M{"type": models.RoomTypeDM}),
+	})
+}
+
+// cursor ของประวัติข้อความเรียงด้วย (created_at, _id) index เดิมที่มีแค่ created_at จึงไม่จำเป็นแล้ว
+func messagesRoomCreatedID(ctx context.Context, db *mongo.Database) error {
+	messages := db.Collection("messages")
+	if err := createIndexes(ctx, messages, mongo.IndexModel{
+		Keys:    bson.D{{Key: "room_id", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}},
+		Options: options.Index().SetName("messages_room_created_id"),
+	}); err != nil {
+		return err
+	}
+	return dropIndex(ctx, messages, "messages_room_created")
+}
+
+// ประวัติห้องกรอง parent_id เป็น null ส่วน thread กรองด้วย parent_id ของต้น thread
+// index เดียวรองรับทั้งสองแบบ จึงแทน index ของ version 10 ได้
+func messagesThreads(ctx context.Context, db *mongo.Database) error {
+	messages := db.Collection("messages")
+	if err := createIndexes(ctx, messages, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "room_id", Value: 1}, {Key: "parent_id", Value: 1},
+			{Key: "created_at", Value: 1}, {Key: "_id", Value: 1},
+		},
+		Options: options.Index().SetName("messages_room_parent_created_id"),
+	}); err != nil {
+		return err
+	}
+	return dropIndex(ctx, messages, "messages_room_created_id")
+}
+
+// DM หาด้วย (type, dm_key) แทนชื่อห้อง เติม dm_key ให้ DM เดิมจากรายชื่อสมาชิก
+func roomsDMKey(ctx context.Context, db *mongo.Database) error {
+	rooms := db.Collection("rooms")
+	cursor, err := rooms.Find(ctx, bson.M{"type": models.RoomTypeDM, "dm_key": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var room models.Room
+		if err := cursor.Decode(&room); err != nil {
+			return err
+		}
+		ids := make([]primitive.ObjectID, len(room.Members))
+		for i, m := range room.Members {
+			ids[i] = m.ID
+		}
+		if _, err := rooms.UpdateOne(ctx, bson.M{"_id": room.ID}, bson.M{"$set": bson.M{"dm_key": models.DMKey(ids)}}); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return createIndexes(ctx, rooms, mongo.IndexModel{
+		Keys: bson.D{{Key: "dm_key", Value: 1}},
+		Options: options.Index().SetName("rooms_dm_key").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"type": models.RoomTypeDM}),
+	})
+}
+
+// dropIndex ลบ index ที่ไม่ใช้แล้ว ไม่มีอยู่ก่อนก็ถือว่าสำเร็จ
+func dropIndex(ctx context.Context, coll *mongo.Collection, name string) error {
+	_, err := coll.Indexes().DropOne(ctx, name)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Name == "IndexNotFound" {
+		return nil
+	}
+	return err
+}
+
+func createIndexes(ctx context.Context, coll *mongo.Collection, indexes ...mongo.IndexModel) error {
+	_, err := coll.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// setValidator ตั้ง $jsonSchema ให้ collection ถ้ายังไม่มี collection จะสร้างพร้อม validator
+func setValidator(ctx context.Context, db *mongo.Database, name string, schema bson.M) error {
+	validator := bson.M{"$jsonSchema": schema}
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: name},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "moderate"},
+		{Key: "validationAction", Value: "error"},
+	}).Err()
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceNotFound" {
+		opts := options.CreateCollection().
+			SetValidator(validator).
+			SetValidationLevel("moderate").
+			SetValidationAction("error")
+		return db.CreateCollection(ctx, name, opts)
+	}
+	return err
+}
+
+// checkDuplicates ตรวจก่อนสร้าง unique index เพื่อบอกค่าที่ซ้ำชัด ๆ แทน error E11000 ของ Mongo
+func checkDuplicates(ctx context.Context, coll *mongo.Collection, field string) error {
+	cursor, err := coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$limit", Value: 10}},
+	})
+	if err != nil {
+		return err
+	}
+	var dups []struct {
+		Value interface{} `bson:"_id"`
+		Count int         `bson:"count"`
+	}
+	if err := cursor.All(ctx, &dups); err != nil {
+		return err
+	}
+	if len(dups) == 0 {
+		return nil
+	}
+	values := make([]string, 0, len(dups))
+	for _, d := range dups {
+		values = append(values, fmt.Sprintf("%v (%d)", d.Value, d.Count))
+	}
+	return fmt.Errorf("%s.%s has duplicate values, resolve them before migrating: %s",
+		coll.Name(), field, strings.Join(values, ", "))
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Action ของ audit event ที่ระบบบันทึก
+const (
+	AuditRegister       = "auth.register"
+	AuditLogin          = "auth.login"
+	AuditLogout         = "auth.logout"
+	AuditRefresh        = "auth.refresh"
+	AuditRoomCreate     = "room.create"
+	AuditRoomUpdate     = "room.update"
+	AuditRoomJoin       = "room.join"
+	AuditRoomRoleChange = "room.role_change"
+	AuditRoomTransfer   = "room.transfer_ownership"
+	AuditRoomKick       = "room.kick"
+	AuditRoomLeave      = "room.leave"
+	AuditRoomUnarchive  = "room.unarchive"
+	AuditRoomDelete     = "room.delete"
+	AuditDMCreate       = "dm.create"
+	AuditMessageEdit    = "message.edit"
+	AuditMessageDelete  = "message.delete"
+
+	// คำเชิญและลิงก์เชิญเข้าห้อง
+	AuditRoomInvite           = "room.invite"
+	AuditRoomInviteAccept     = "room.invite_accept"
+	AuditRoomInviteDecline    = "room.invite_decline"
+	AuditRoomInviteRevoke     = "room.invite_revoke"
+	AuditRoomInviteLinkCreate = "room.invite_link_create"
+	AuditRoomInviteLinkRevoke = "room.invite_link_revoke"
+	AuditRoomInviteLinkUse    = "room.invite_link_use"
+
+	// action ที่มาจาก CLI (mychat-auth user/room/keys/sessions)
+	AuditUserCreate        = "user.create"
+	AuditUserRoleChange    = "user.role_change"
+	AuditUserPasswordReset = "user.password_reset"
+	AuditUserDisable       = "user.disable"
+	AuditRoomArchive       = "room.archive"
+	AuditKeyRotate         = "key.rotate"
+	AuditSessionRevoke     = "session.revoke"
+)
+
+// ผลลัพธ์ของ audit event
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	AuditDenied  = "denied"
+)
+
+// AuditEvent คือบันทึกเหตุการณ์ด้าน security หนึ่งรายการ เขียนแล้วไม่แก้ไขอีก
+type AuditEvent struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Action     string             `bson:"action" json:"action"`
+	Outcome    string             `bson:"outcome" json:"outcome"`
+	ActorID    string             `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	ActorEmail string             `bson:"actor_email,omitempty" json:"actor_email,omitempty"`
+	TargetType string             `bson:"target_type,omitempty" json:"target_type,omitempty"`
+	TargetID   string             `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	Reason     string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	Metadata   map[string]string  `bson:"metadata,omitempty" json:"metadata,omitempty"`
+	IP         string             `bson:"ip" json:"ip"`
+	UserAgent  string             `bson:"user_agent" json:"user_agent"`
+	RequestID  string             `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// สถานะของคำเชิญ เริ่มที่ pending แล้วเปลี่ยนได้ครั้งเดียว
+const (
+	InvitePending  = "pending"
+	InviteAccepted = "accepted"
+	InviteDeclined = "declined"
+	InviteRevoked  = "revoked" // owner/moderator ยกเลิกก่อนผู้ถูกเชิญตอบ
+)
+
+// Invitation คือคำเชิญ user คนหนึ่งเข้าห้อง
+type Invitation struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	RoomID primitive.ObjectID `bson:"room_id" json:"room_id"`
+	// RoomName เก็บชื่อห้องตอนเชิญไว้ให้ผู้ถูกเชิญเห็น เพราะเขายังเปิดดูห้อง private ไม่ได้
+	RoomName    string             `bson:"room_name" json:"room_name"`
+	InviteeID   primitive.ObjectID `bson:"invitee_id" json:"invitee_id"`
+	InviterID   primitive.ObjectID `bson:"inviter_id" json:"inviter_id"`
+	Status      string             `bson:"status" json:"status"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	RespondedAt *time.Time         `bson:"responded_at,omitempty" json:"responded_at,omitempty"`
+}
+
+// สถานะของลิงก์เชิญ คำนวณจากข้อมูลในลิงก์ ไม่ได้เก็บลง database
+const (
+	InviteLinkActive  = "active"
+	InviteLinkRevoked = "revoked"
+	InviteLinkExpired = "expired"
+	InviteLinkUsedUp  = "used_up"
+)
+
+// InviteLink คือลิงก์เชิญที่ส่งต่อให้ใครก็ได้ ใช้ได้จนหมดอายุ ครบจำนวนครั้ง หรือถูกเพิกถอน
+type InviteLink struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	RoomID    primitive.ObjectID `bson:"room_id" json:"room_id"`
+	Code      string             `bson:"code" json:"code"`
+	CreatedBy primitive.ObjectID `bson:"created_by" json:"created_by"`
+	// MaxUses 0 คือไม่จำกัดจำนวนครั้ง
+	MaxUses int `bson:"max_uses,omitempty" json:"max_uses,omitempty"`
+	Uses    int `bson:"uses" json:"uses"`
+	// ExpiresAt nil คือไม่มีวันหมดอายุ
+	ExpiresAt *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	RevokedAt *time.Time `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+}
+
+// State คืนสถานะของลิงก์ ณ เวลา now
+func (l InviteLink) State(now time.Time) string {
+	switch {
+	case l.RevokedAt != nil:
+		return InviteLinkRevoked
+	case l.ExpiresAt != nil && !now.Before(*l.ExpiresAt):
+		return InviteLinkExpired
+	case l.MaxUses > 0 && l.Uses >= l.MaxUses:
+		return InviteLinkUsedUp
+	}
+	return InviteLinkActive
+}
@@ -13,4 +13,34 @@ type Message struct {
 	Sender    string             `bson:"sender" json:"sender"`
 	Content   string             `bson:"content" json:"content"`
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	// ParentID ชี้ไปที่ข้อความต้นของ thread มีเฉพาะ reply และ thread มีชั้นเดียวเสมอ
+	ParentID *primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	// ReplyCount และ LastReplyAt มีเฉพาะข้อความต้นของ thread ใช้แสดงตัวอย่าง thread
+	ReplyCount  int        `bson:"reply_count,omitempty" json:"reply_count,omitempty"`
+	LastReplyAt *time.Time `bson:"last_reply_at,omitempty" json:"last_reply_at,omitempty"`
+	EditedAt    *time.Time `bson:"edited_at,omitempty" json:"edited_at,omitempty"`
+	// Edits เก็บเนื้อหาก่อนแก้แต่ละครั้ง เรียงจากเก่าไปใหม่ ดูได้จาก endpoint ประวัติการแก้เท่านั้น
+	Edits []MessageEdit `bson:"edits,omitempty" json:"-"`
+	// ข้อความที่ลบแล้วยังอยู่เป็น tombstone ให้ลำดับในห้องไม่ขาด แต่เนื้อหาและประวัติถูกล้าง
+	DeletedAt *time.Time          `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	DeletedBy *primitive.ObjectID `bson:"deleted_by,omitempty" json:"deleted_by,omitempty"`
+}
+
+// MessageEdit คือเนื้อหาเดิมของข้อความ ก่อนถูกแทนที่เมื่อ EditedAt
+type MessageEdit struct {
+	Content  string    `bson:"content" json:"content"`
+	EditedAt time.Time `bson:"edited_at" json:"edited_at"`
+}
+
+// InThread บอกว่าข้อความอยู่ในรายการของ parentID หรือไม่ (nil คือข้อความนอก thread)
+func (m Message) InThread(parentID *primitive.ObjectID) bool {
+	if m.ParentID == nil || parentID == nil {
+		return m.ParentID == nil && parentID == nil
+	}
+	return *m.ParentID == *parentID
+}
+
+// IsDeleted บอกว่าข้อความถูกลบเหลือแค่ tombstone แล้ว
+func (m Message) IsDeleted() bool {
+	return m.DeletedAt != nil
 }
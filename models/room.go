@@ -1,15 +1,107 @@
 package models
 
 import (
+	"sort"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ประเภทของห้อง: public ใครก็เข้าร่วมได้, private ต้องได้รับเชิญ
+// dm คือห้องคุยส่วนตัวระหว่างคนกลุ่มเล็ก ๆ สมาชิกตายตัวตั้งแต่สร้าง
+const (
+	RoomTypePublic  = "public"
+	RoomTypePrivate = "private"
+	RoomTypeDM      = "dm"
+)
+
+// MaxDMParticipants คือจำนวนคนสูงสุดใน DM รวมคนที่เริ่มคุย
+const MaxDMParticipants = 10
+
+// บทบาทของสมาชิกภายในห้อง
+const (
+	RoomRoleOwner     = "owner"
+	RoomRoleModerator = "moderator"
+	RoomRoleMember    = "member"
+)
+
 type Room struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name      string             `bson:"name" json:"name" validate:"required"`
-	Type      string             `bson:"type" json:"type" validate:"required,oneof=public private"`
-	Members   []SafeUser         `bson:"members" json:"members"`
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	ID   primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name string             `bson:"name" json:"name" validate:"required"`
+	Type string             `bson:"type" json:"type" validate:"required,oneof=public private"`
+	// Topic เป็นหัวข้อสั้น ๆ ที่แสดงบนหัวห้อง ส่วน Description เป็นคำอธิบายยาว
+	Topic       string             `bson:"topic,omitempty" json:"topic,omitempty" validate:"max=250"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty" validate:"max=2000"`
+	OwnerID     primitive.ObjectID `bson:"owner_id,omitempty" json:"owner_id"`
+	Members     []RoomMember       `bson:"members" json:"members"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	// Archived ห้องที่เก็บแล้วอ่านได้อย่างเดียว และไม่แสดงใน GET /rooms
+	Archived   bool       `bson:"archived,omitempty" json:"archived,omitempty"`
+	ArchivedAt *time.Time `bson:"archived_at,omitempty" json:"archived_at,omitempty"`
+	// LastActivityAt ใช้เรียง inbox ของ DM มีเฉพาะห้องแบบ dm
+	LastActivityAt *time.Time `bson:"last_activity_at,omitempty" json:"last_activity_at,omitempty"`
+	// DMKey ระบุกลุ่มคนใน DM ใช้หา DM เดิม มีเฉพาะห้องแบบ dm
+	DMKey string `bson:"dm_key,omitempty" json:"-"`
+}
+
+// DMKey คืนรหัสของคนกลุ่มนี้ ได้ค่าเดียวกันเสมอไม่ว่าจะเรียงลำดับมาแบบไหน
+// unique index ของ dm_key กันไม่ให้คนกลุ่มเดียวกันมี DM ซ้ำ
+func DMKey(participants []primitive.ObjectID) string {
+	ids := make([]string, len(participants))
+	for i, id := range participants {
+		ids[i] = id.Hex()
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// DMName คืนชื่อห้องของ DM ตาม key ห้องปกติใช้ชื่อที่ขึ้นต้นแบบนี้ไม่ได้ (ดู ReservedRoomName)
+func DMName(key string) string {
+	return RoomTypeDM + ":" + key
+}
+
+// ReservedRoomName บอกว่าชื่อนี้สงวนไว้ให้ DM ห้องที่สร้างหรือเปลี่ยนชื่อเองใช้ไม่ได้
+// ไม่งั้นคนที่มีสิทธิ์ตั้งชื่อห้องจะจองชื่อ DM ของคนอื่นไว้ก่อนได้
+func ReservedRoomName(name string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(name)), RoomTypeDM+":")
+}
+
+// RoomMember คือสมาชิกในห้องพร้อมบทบาทของเขาในห้องนั้น
+type RoomMember struct {
+	SafeUser `bson:",inline"`
+	Role     string `bson:"role" json:"role"`
+}
+
+// MemberRole คืนบทบาทของ user ในห้อง หรือ "" ถ้าไม่ได้เป็นสมาชิก
+// ห้องเก่าที่ยังไม่มี role จะถือว่าเป็น member ยกเว้นคนที่ตรงกับ OwnerID
+func (r Room) MemberRole(userID primitive.ObjectID) string {
+	for _, m := range r.Members {
+		if m.ID != userID {
+			continue
+		}
+		if m.Role != "" {
+			return m.Role
+		}
+		if !r.OwnerID.IsZero() && r.OwnerID == userID {
+			return RoomRoleOwner
+		}
+		return RoomRoleMember
+	}
+	return ""
+}
+
+// IsPrivate บอกว่าคนนอกไม่ควรรู้ว่ามีห้องนี้อยู่ (private และ dm)
+func (r Room) IsPrivate() bool {
+	return r.Type == RoomTypePrivate || r.Type == RoomTypeDM
+}
+
+// IsMember บอกว่า user เป็นสมาชิกของห้องหรือไม่
+func (r Room) IsMember(userID primitive.ObjectID) bool {
+	return r.MemberRole(userID) != ""
+}
+
+// CanModerate บอกว่าบทบาทนี้ลบข้อความคนอื่นหรือเตะสมาชิกได้หรือไม่
+func CanModerate(role string) bool {
+	return role == RoomRoleOwner || role == RoomRoleModerator
 }
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// SigningKey คือ key สำหรับเซ็น JWT หนึ่งตัวใน keyring ID ใส่ใน header "kid" ของ token
+// key ใหม่จะเริ่มใช้เซ็นเมื่อถึง ActiveAt ระหว่างนั้นทุก replica โหลด key ไปใช้ตรวจได้ก่อน
+type SigningKey struct {
+	ID string `bson:"_id" json:"kid"`
+	// Secret ใช้เซ็นและตรวจ token มีค่าเฉพาะใน memory หลังถอดรหัส ไม่ถูกบันทึกลง database
+	Secret []byte `bson:"-" json:"-"`
+	// SealedSecret คือ Secret ที่เข้ารหัสด้วย JWT_KEYRING_SECRET (ดู utils.KeyCipher)
+	SealedSecret []byte `bson:"sealed_secret,omitempty" json:"-"`
+	// PlainSecret คือ secret ของ key ที่สร้างก่อนมีการเข้ารหัส "keys rotate" จะเข้ารหัสให้ใหม่
+	PlainSecret []byte    `bson:"secret,omitempty" json:"-"`
+	ActiveAt    time.Time `bson:"active_at" json:"active_at"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Sealed บอกว่า secret ถูกเก็บแบบเข้ารหัสแล้ว
+func (k SigningKey) Sealed() bool {
+	return len(k.SealedSecret) > 0
+}
@@ -13,6 +13,9 @@ type User struct {
 	Role      string             `bson:"role" json:"-"`
 	ImageURL  string             `bson:"image_url" json:"image_url"`
 	CreatedAt time.Time          `bson:"created_at"`
+	// Disabled ห้าม login และ refresh (ตั้งผ่าน "mychat-auth user disable")
+	Disabled   bool       `bson:"disabled,omitempty" json:"-"`
+	DisabledAt *time.Time `bson:"disabled_at,omitempty" json:"-"`
 }
 
 type SafeUser struct {
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+
+	"mychat-auth/handlers"
+	"mychat-auth/middleware"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// chain ครอบ handler ด้วย middleware ตามลำดับที่เขียน (ตัวแรกอยู่นอกสุด)
+func chain(h http.Handler, mws ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// newRouter รวมทุก route ไว้ที่เดียวด้วย pattern ของ http.ServeMux (Go 1.22+)
+// method ที่ไม่ตรงจะได้ 405 พร้อม header Allow จาก ServeMux เอง
+func newRouter(srv *handlers.Server, auth *middleware.Auth) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	handle := func(pattern string, h http.HandlerFunc, mws ...func(http.Handler) http.Handler) {
+		mws = append([]func(http.Handler) http.Handler{middleware.Route(pattern)}, mws...)
+		mux.Handle(pattern, chain(h, mws...))
+	}
+	authed := auth.JWTAuthMiddleware
+	admin := auth.RequireAdmin
+
+	// Health probes สำหรับ orchestrator
+	handle("GET /healthz", srv.HealthzHandler)
+	handle("GET /readyz", srv.ReadyzHandler)
+	handle("GET /metrics", promhttp.Handler().ServeHTTP)
+
+	// Auth และ User Management
+	handle("POST /register", srv.RegisterHandler)
+	handle("POST /login", srv.LoginHandler)
+	handle("GET /me", srv.MeHandler, authed)
+	handle("POST /logout", srv.LogoutHandler, authed)
+	handle("POST /auth/refresh", srv.RefreshHandler)
+	handle("GET /auth/csrf", srv.CSRFTokenHandler)
+	handle("GET /api/users", srv.UsersHandler, authed)
+
+	// Admin
+	handle("GET /admin/audit", srv.AuditEventsHandler, admin)
+	handle("GET /admin/audit/export", srv.AuditExportHandler, admin)
+	handle("GET /admin/ws/rooms", srv.WSRoomsHandler, admin)
+
+	// Rooms
+	handle("GET /rooms", srv.GetRoomsHandler, authed)
+	handle("POST /rooms", srv.CreateRoomHandler, admin)
+	handle("PATCH /rooms/{id}", srv.UpdateRoomHandler, authed)
+	handle("DELETE /rooms/{id}", srv.DeleteRoomHandler, authed)
+	handle("POST /rooms/{id}/join", srv.JoinRoomHandler, authed)
+	handle("POST /rooms/{id}/leave", srv.LeaveRoomHandler, authed)
+	handle("POST /rooms/{id}/archive", srv.ArchiveRoomHandler, authed)
+	handle("POST /rooms/{id}/unarchive", srv.UnarchiveRoomHandler, authed)
+	handle("POST /rooms/{id}/transfer", srv.TransferOwnershipHandler, authed)
+	handle("PUT /rooms/{id}/members/{userID}/role", srv.UpdateMemberRoleHandler, authed)
+	handle("DELETE /rooms/{id}/members/{userID}", srv.KickMemberHandler, authed)
+
+	// Invitations
+	handle("POST /rooms/{id}/invitations", srv.CreateInvitationHandler, authed)
+	handle("GET /rooms/{id}/invitations", srv.GetRoomInvitationsHandler, authed)
+	handle("DELETE /rooms/{id}/invitations/{invitationID}", srv.RevokeInvitationHandler, authed)
+	handle("POST /rooms/{id}/invite-links", srv.CreateInviteLinkHandler, authed)
+	handle("GET /rooms/{id}/invite-links", srv.GetInviteLinksHandler, authed)
+	handle("DELETE /rooms/{id}/invite-links/{linkID}", srv.RevokeInviteLinkHandler, authed)
+	handle("GET /invitations", srv.MyInvitationsHandler, authed)
+	handle("POST /invitations/{id}/accept", srv.AcceptInvitationHandler, authed)
+	handle("POST /invitations/{id}/decline", srv.DeclineInvitationHandler, authed)
+	handle("POST /invite-links/accept", srv.AcceptInviteLinkHandler, authed)
+
+	// Direct messages ใช้ /rooms/{id}/messages และ WebSocket ร่วมกับห้องปกติ
+	handle("POST /dms", srv.CreateDMHandler, authed)
+	handle("GET /dms", srv.GetDMsHandler, authed)
+
+	// Messages
+	handle("GET /rooms/{id}/messages", srv.GetRoomMessagesHandler, authed)
+	handle("PATCH /rooms/{id}/messages/{messageID}", srv.EditMessageHandler, authed)
+	handle("DELETE /rooms/{id}/messages/{messageID}", srv.DeleteMessageHandler, authed)
+	handle("GET /rooms/{id}/messages/{messageID}/edits", srv.MessageEditsHandler, authed)
+	handle("GET /rooms/{id}/messages/{messageID}/thread", srv.MessageThreadHandler, authed)
+
+	// WebSocket ตรวจ token เองตอน upgrade
+	handle("GET /ws", srv.WebSocketHandler)
+
+	return mux
+}
@@ -3,6 +3,9 @@ package contextkey
 type ContextKey string
 
 const (
-	UserID ContextKey = "user_id"
-	Role   ContextKey = "role"
+	UserID      ContextKey = "user_id"
+	Role        ContextKey = "role"
+	Logger      ContextKey = "logger"
+	RequestInfo ContextKey = "request_info"
+	RequestID   ContextKey = "request_id"
 )
@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"mychat-auth/shared/contextkey"
+)
+
+// Options กำหนดรูปแบบของ logger หลักของ service
+type Options struct {
+	Level     string   // debug, info, warn, error (ค่าเริ่มต้น info)
+	Format    string   // json หรือ text (ค่าเริ่มต้น json)
+	PIIFields []string // ชื่อ field ที่ถือเป็นข้อมูลส่วนบุคคล เช่น email, ip
+	Output    io.Writer
+}
+
+// New สร้าง slog.Logger ที่ผ่าน redaction ทุกครั้งก่อนเขียนออก
+func New(opts Options) *slog.Logger {
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	redactor := NewRedactor(opts.PIIFields)
+	handlerOpts := &slog.HandlerOptions{
+		Level:       ParseLevel(opts.Level),
+		ReplaceAttr: redactor.ReplaceAttr,
+	}
+
+	var h slog.Handler
+	if strings.EqualFold(opts.Format, "text") {
+		h = slog.NewTextHandler(out, handlerOpts)
+	} else {
+		h = slog.NewJSONHandler(out, handlerOpts)
+	}
+	return slog.New(h)
+}
+
+// Init ตั้ง logger เป็น default ของทั้ง slog และ package log เดิม
+func Init(opts Options) *slog.Logger {
+	l := New(opts)
+	slog.SetDefault(l)
+	return l
+}
+
+// ParseLevel แปลงชื่อ level เป็น slog.Level ถ้าไม่รู้จักใช้ info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// FromContext คืน logger ของ request ปัจจุบัน (มี request_id, user_id, route) หรือ default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextkey.Logger).(*slog.Logger); ok {
+			return l
+		}
+	}
+	return slog.Default()
+}
+
+// WithLogger เก็บ logger ไว้ใน context
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextkey.Logger, l)
+}
+
+// With เพิ่ม field ให้ logger ใน context แล้วคืน context ใหม่
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
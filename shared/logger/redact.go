@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// key ที่มีคำเหล่านี้อยู่จะถูกปิดทั้งค่าเสมอ ไม่ว่าจะตั้งค่า PII ไว้อย่างไร
+var secretKeyParts = []string{"secret", "password", "passwd", "token", "authorization", "cookie", "api_key", "apikey"}
+
+var (
+	jwtPattern      = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	bearerPattern   = regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`)
+	uriCredsPattern = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]+):[^@\s]+@`)
+	emailPattern    = regexp.MustCompile(`([A-Za-z0-9._%+-])[A-Za-z0-9._%+-]*@([A-Za-z0-9.-]+\.[A-Za-z]{2,})`)
+)
+
+// Redactor ปิดบัง secret และ PII ใน log attribute ก่อนถูกเขียนออก
+type Redactor struct {
+	pii        map[string]bool
+	maskEmails bool
+}
+
+// NewRedactor สร้าง Redactor จากรายชื่อ field ที่เป็น PII (ไม่สนตัวพิมพ์เล็กใหญ่)
+func NewRedactor(piiFields []string) *Redactor {
+	r := &Redactor{pii: map[string]bool{}}
+	for _, f := range piiFields {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" {
+			continue
+		}
+		r.pii[f] = true
+		if f == "email" {
+			r.maskEmails = true
+		}
+	}
+	return r
+}
+
+// ReplaceAttr ใช้เป็น slog.HandlerOptions.ReplaceAttr
+func (r *Redactor) ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+
+	key := strings.ToLower(a.Key)
+	if isSecretKey(key) {
+		return slog.String(a.Key, redacted)
+	}
+	if r.pii[key] {
+		if key == "email" {
+			return slog.String(a.Key, MaskEmail(a.Value.String()))
+		}
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, r.Scrub(a.Value.String()))
+	case slog.KindAny:
+		// error และค่าอื่นที่แปลงเป็นข้อความได้ อาจมี token หรือ URI ที่มีรหัสผ่านติดมา
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, r.Scrub(err.Error()))
+		}
+	}
+	return a
+}
+
+// Scrub ลบ token, credential ใน URI และ (ถ้าเปิดไว้) email ที่ปนอยู่ในข้อความอิสระ
+func (r *Redactor) Scrub(s string) string {
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	s = bearerPattern.ReplaceAllString(s, "Bearer "+redacted)
+	s = uriCredsPattern.ReplaceAllString(s, "$1:"+redacted+"@")
+	if r.maskEmails {
+		s = emailPattern.ReplaceAllString(s, "$1***@$2")
+	}
+	return s
+}
+
+// MaskEmail เหลือไว้แค่ตัวอักษรแรกกับโดเมน เช่น j***@example.com
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return redacted
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+func isSecretKey(key string) bool {
+	for _, part := range secretKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+// Package response รวมวิธีเขียน response ที่ทุก handler ใช้ร่วมกัน
+// error ทุกตัวออกเป็น JSON รูปแบบเดียวกัน ส่วน client ที่ขอ application/problem+json
+// จะได้ RFC 7807 problem details แทน
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"mychat-auth/shared/contextkey"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ProblemContentType คือ media type ของ RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// error code ที่ client ใช้แยกกรณีได้โดยไม่ต้อง parse ข้อความ
+const (
+	CodeBadRequest         = "bad_request"
+	CodeValidation         = "validation_failed"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeForbidden          = "forbidden"
+	CodeCSRF               = "csrf_failed"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeUnavailable        = "unavailable"
+	CodeInternal           = "internal_error"
+)
+
+// FieldError คือปัญหาของ field เดียวใน request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// APIError คือ error ที่ส่งกลับ client ได้ตรง ๆ
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details []FieldError
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// NewError สร้าง APIError ถ้าไม่ระบุ code จะใช้ code ตาม status
+func NewError(status int, code, msg string) *APIError {
+	if code == "" {
+		code = codeForStatus(status)
+	}
+	return &APIError{Status: status, Code: code, Message: msg}
+}
+
+type errorBody struct {
+	Error errorPayload `json:"error"`
+}
+
+type errorPayload struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+type problemBody struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// Error เขียน error โดยเลือก code จาก status ใช้แทน http.Error ทุกที่
+func Error(w http.ResponseWriter, r *http.Request, msg string, status int) {
+	Fail(w, r, NewError(status, "", msg))
+}
+
+// Fail เขียน APIError ตาม Accept ของ client (problem+json หรือ envelope ปกติ)
+func Fail(w http.ResponseWriter, r *http.Request, e *APIError) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Del("Content-Length")
+
+	if wantsProblem(r) {
+		writeJSON(w, ProblemContentType, e.Status, problemBody{
+			Type:      "about:blank",
+			Title:     http.StatusText(e.Status),
+			Status:    e.Status,
+			Detail:    e.Message,
+			Instance:  r.URL.Path,
+			Code:      e.Code,
+			RequestID: RequestID(r),
+			Errors:    e.Details,
+		})
+		return
+	}
+	writeJSON(w, "application/json", e.Status, errorBody{Error: errorPayload{
+		Code:      e.Code,
+		Message:   e.Message,
+		Details:   e.Details,
+		RequestID: RequestID(r),
+	}})
+}
+
+// Validation แปลง error จาก validator เป็น 422 พร้อมข้อความราย field
+// error อื่นที่ไม่ใช่ ValidationErrors ถือเป็น 400
+func Validation(w http.ResponseWriter, r *http.Request, err error) {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		Error(w, r, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	e := NewError(http.StatusUnprocessableEntity, CodeValidation, "Some fields are invalid")
+	for _, fe := range verrs {
+		e.Details = append(e.Details, FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: fieldMessage(fe),
+		})
+	}
+	Fail(w, r, e)
+}
+
+// JSON เขียน body สำเร็จเป็น JSON โดยตั้ง Content-Type ก่อน WriteHeader เสมอ
+func JSON(w http.ResponseWriter, status int, v any) {
+	writeJSON(w, "application/json", status, v)
+}
+
+// RequestID คืน request ID ของ request ปัจจุบัน
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(contextkey.RequestID).(string)
+	return id
+}
+
+func writeJSON(w http.ResponseWriter, contentType string, status int, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func wantsProblem(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), ProblemContentType)
+}
+
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusUnprocessableEntity:
+		return CodeValidation
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// fieldMessage แปลง tag ของ validator ที่ใช้ใน models เป็นข้อความที่คนอ่านเข้าใจ
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fe.Field() + " is required"
+	case "email":
+		return fe.Field() + " must be a valid email address"
+	case "min":
+		if fe.Kind().String() == "string" {
+			return fmt.Sprintf("%s must be at least %s characters", fe.Field(), fe.Param())
+		}
+		return fmt.Sprintf("%s must be at least %s", fe.Field(), fe.Param())
+	case "max":
+		if fe.Kind().String() == "string" {
+			return fmt.Sprintf("%s must be at most %s characters", fe.Field(), fe.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s", fe.Field(), fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", fe.Field(), strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "url":
+		return fe.Field() + " must be a valid URL"
+	}
+	return fe.Field() + " is invalid"
+}
@@ -0,0 +1,834 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"mychat-auth/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewMemory คืน store ทุกตัวแบบเก็บใน memory ใช้รัน Server ใน test หรือ dev โดยไม่ต้องมี Mongo/Redis
+// ค่าที่คืนออกไปเป็นสำเนาเสมอ แก้ไขแล้วไม่กระทบข้อมูลใน store
+func NewMemory() Stores {
+	return Stores{
+		Users:       &memUsers{byID: map[primitive.ObjectID]models.User{}},
+		Rooms:       &memRooms{byID: map[primitive.ObjectID]models.Room{}},
+		Messages:    &memMessages{byID: map[primitive.ObjectID]models.Message{}},
+		Sessions:    &memSessions{revoked: map[string]time.Time{}, users: map[string]userRevocation{}},
+		Audit:       &memAudit{},
+		Keys:        &memKeys{},
+		Invitations: &memInvitations{byID: map[primitive.ObjectID]models.Invitation{}},
+		InviteLinks: &memInviteLinks{byID: map[primitive.ObjectID]models.InviteLink{}},
+	}
+}
+
+type memUsers struct {
+	mu   sync.RWMutex
+	byID map[primitive.ObjectID]models.User
+}
+
+func (s *memUsers) Create(_ context.Context, u *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.byID {
+		if existing.Email == u.Email {
+			return ErrConflict
+		}
+	}
+	if u.ID.IsZero() {
+		u.ID = primitive.NewObjectID()
+	}
+	s.byID[u.ID] = *u
+	return nil
+}
+
+func (s *memUsers) ByID(_ context.Context, id primitive.ObjectID) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.byID[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (s *memUsers) ByEmail(_ context.Context, email string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, u := range s.byID {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (s *memUsers) ByIDs(_ context.Context, ids []primitive.ObjectID) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := []models.User{}
+	for _, id := range ids {
+		if u, ok := s.byID[id]; ok {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+// update เรียก fn กับสำเนาของ user แล้วเก็บกลับ
+func (s *memUsers) update(id primitive.ObjectID, fn func(u *models.User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.byID[id]
+	if !ok {
+		return ErrNotFound
+	}
+	fn(&u)
+	s.byID[id] = u
+	return nil
+}
+
+func (s *memUsers) SetRole(_ context.Context, id primitive.ObjectID, role string) error {
+	return s.update(id, func(u *models.User) { u.Role = role })
+}
+
+func (s *memUsers) SetPassword(_ context.Context, id primitive.ObjectID, hash string) error {
+	return s.update(id, func(u *models.User) { u.Password = hash })
+}
+
+func (s *memUsers) SetDisabled(_ context.Context, id primitive.ObjectID, disabled bool) error {
+	return s.update(id, func(u *models.User) {
+		u.Disabled, u.DisabledAt = disabled, nil
+		if disabled {
+			now := time.Now().UTC()
+			u.DisabledAt = &now
+		}
+	})
+}
+
+type memRooms struct {
+	mu   sync.RWMutex
+	byID map[primitive.ObjectID]models.Room
+}
+
+func copyRoom(r models.Room) models.Room {
+	r.Members = append([]models.RoomMember(nil), r.Members...)
+	return r
+}
+
+func (s *memRooms) List(_ context.Context) ([]models.Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rooms := make([]models.Room, 0, len(s.byID))
+	for _, r := range s.byID {
+		rooms = append(rooms, copyRoom(r))
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID.Hex() < rooms[j].ID.Hex() })
+	return rooms, nil
+}
+
+func (s *memRooms) ListVisible(ctx context.Context, userID primitive.ObjectID) ([]models.Room, error) {
+	all, _ := s.List(ctx)
+	rooms := []models.Room{}
+	for _, r := range all {
+		if !r.Archived && r.Type != models.RoomTypeDM && (r.Type != models.RoomTypePrivate || r.IsMember(userID)) {
+			rooms = append(rooms, r)
+		}
+	}
+	return rooms, nil
+}
+
+func (s *memRooms) ListDMs(ctx context.Context, userID primitive.ObjectID) ([]models.Room, error) {
+	all, _ := s.List(ctx)
+	rooms := []models.Room{}
+	for _, r := range all {
+		if r.Type == models.RoomTypeDM && r.IsMember(userID) {
+			rooms = append(rooms, r)
+		}
+	}
+	activity := func(r models.Room) time.Time {
+		if r.LastActivityAt == nil {
+			return time.Time{}
+		}
+		return *r.LastActivityAt
+	}
+	sort.SliceStable(rooms, func(i, j int) bool {
+		ai, aj := activity(rooms[i]), activity(rooms[j])
+		if !ai.Equal(aj) {
+			return ai.After(aj)
+		}
+		return rooms[i].ID.Hex() > rooms[j].ID.Hex()
+	})
+	return rooms, nil
+}
+
+func (s *memRooms) DMByKey(_ context.Context, key string) (models.Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.byID {
+		if r.Type == models.RoomTypeDM && r.DMKey == key {
+			return copyRoom(r), nil
+		}
+	}
+	return models.Room{}, ErrNotFound
+}
+
+func (s *memRooms) ByID(_ context.Context, id primitive.ObjectID) (models.Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.byID[id]
+	if !ok {
+		return models.Room{}, ErrNotFound
+	}
+	return copyRoom(r), nil
+}
+
+func (s *memRooms) nameTaken(name string, except primitive.ObjectID) bool {
+	for id, r := range s.byID {
+		if id != except && r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memRooms) Create(_ context.Context, room *models.Room) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nameTaken(room.Name, primitive.NilObjectID) {
+		return ErrConflict
+	}
+	// เหมือน unique index rooms_dm_key ของ Mongo
+	if room.Type == models.RoomTypeDM {
+		for _, r := range s.byID {
+			if r.Type == models.RoomTypeDM && r.DMKey == room.DMKey {
+				return ErrConflict
+			}
+		}
+	}
+	if room.ID.IsZero() {
+		room.ID = primitive.NewObjectID()
+	}
+	s.byID[room.ID] = copyRoom(*room)
+	return nil
+}
+
+func (s *memRooms) Update(_ context.Context, id primitive.ObjectID, u RoomUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.byID[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if u.Name != nil {
+		if s.nameTaken(*u.Name, id) {
+			return ErrConflict
+		}
+		r.Name = *u.Name
+	}
+	if u.Type != nil {
+		r.Type = *u.Type
+	}
+	if u.Topic != nil {
+		r.Topic = *u.Topic
+	}
+	if u.Description != nil {
+		r.Description = *u.Description
+	}
+	s.byID[id] = r
+	return nil
+}
+
+// update เรียก fn กับสำเนาของห้องแล้วเก็บกลับถ้า fn ไม่คืน error
+func (s *memRooms) update(id primitive.ObjectID, fn func(r *models.Room) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.byID[id]
+	if !ok {
+		return ErrNotFound
+	}
+	r = copyRoom(r)
+	if err := fn(&r); err != nil {
+		return err
+	}
+	s.byID[id] = r
+	return nil
+}
+
+func memberIndex(r *models.Room, userID primitive.ObjectID) int {
+	for i, m := range r.Members {
+		if m.ID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *memRooms) AddMember(_ context.Context, roomID primitive.ObjectID, m models.RoomMember) error {
+	return s.update(roomID, func(r *models.Room) error {
+		if memberIndex(r, m.ID) < 0 {
+			r.Members = append(r.Members, m)
+		}
+		return nil
+	})
+}
+
+func (s *memRooms) SetMemberRole(_ context.Context, roomID, userID primitive.ObjectID, role string) error {
+	return s.update(roomID, func(r *models.Room) error {
+		i := memberIndex(r, userID)
+		if i < 0 {
+			return ErrNotFound
+		}
+		r.Members[i].Role = role
+		return nil
+	})
+}
+
+func (s *memRooms) TransferOwnership(_ context.Context, roomID, from, to primitive.ObjectID) error {
+	return s.update(roomID, func(r *models.Room) error {
+		fi, ti := memberIndex(r, from), memberIndex(r, to)
+		if fi < 0 || ti < 0 {
+			return ErrConflict
+		}
+		r.OwnerID = to
+		r.Members[ti].Role = models.RoomRoleOwner
+		r.Members[fi].Role = models.RoomRoleModerator
+		return nil
+	})
+}
+
+func (s *memRooms) RemoveMember(_ context.Context, roomID, userID primitive.ObjectID) error {
+	return s.update(roomID, func(r *models.Room) error {
+		if i := memberIndex(r, userID); i >= 0 {
+			r.Members = append(r.Members[:i], r.Members[i+1:]...)
+		}
+		return nil
+	})
+}
+
+func (s *memRooms) SetArchived(_ context.Context, id primitive.ObjectID, archived bool) error {
+	return s.update(id, func(r *models.Room) error {
+		r.Archived, r.ArchivedAt = archived, nil
+		if archived {
+			now := time.Now().UTC()
+			r.ArchivedAt = &now
+		}
+		return nil
+	})
+}
+
+func (s *memRooms) Touch(_ context.Context, id primitive.ObjectID, at time.Time) error {
+	return s.update(id, func(r *models.Room) error {
+		at = at.UTC()
+		if r.LastActivityAt == nil || at.After(*r.LastActivityAt) {
+			r.LastActivityAt = &at
+		}
+		return nil
+	})
+}
+
+func (s *memRooms) Delete(_ context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byID[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.byID, id)
+	return nil
+}
+
+type memMessages struct {
+	mu   sync.RWMutex
+	byID map[primitive.ObjectID]models.Message
+}
+
+func (s *memMessages) Create(_ context.Context, m *models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.ID.IsZero() {
+		m.ID = primitive.NewObjectID()
+	}
+	s.byID[m.ID] = *m
+	return nil
+}
+
+func (s *memMessages) ByID(_ context.Context, roomID, id primitive.ObjectID) (models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.byID[id]
+	if !ok || m.RoomID != roomID {
+		return models.Message{}, ErrNotFound
+	}
+	return m, nil
+}
+
+// less เรียงข้อความตาม (created_at, _id) เหมือน index ของ Mongo
+func (c MessageCursor) less(o MessageCursor) bool {
+	if !c.CreatedAt.Equal(o.CreatedAt) {
+		return c.CreatedAt.Before(o.CreatedAt)
+	}
+	return c.ID.Hex() < o.ID.Hex()
+}
+
+func (s *memMessages) ListByRoom(_ context.Context, roomID primitive.ObjectID, q MessageQuery) ([]models.Message, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	messages := []models.Message{}
+	for _, m := range s.byID {
+		pos := *CursorOf(m)
+		if m.RoomID != roomID || !m.InThread(q.ParentID) ||
+			(q.Before != nil && !pos.less(*q.Before)) ||
+			(q.After != nil && !q.After.less(pos)) {
+			continue
+		}
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool { return CursorOf(messages[i]).less(*CursorOf(messages[j])) })
+
+	limit := messagePageSize(q.Limit)
+	more := len(messages) > limit
+	if more {
+		if q.After != nil {
+			messages = messages[:limit]
+		} else {
+			messages = messages[len(messages)-limit:]
+		}
+	}
+	return messages, more, nil
+}
+
+func (s *memMessages) Edit(_ context.Context, roomID, id primitive.ObjectID, content string, at time.Time, keepHistory bool) (models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.byID[id]
+	if !ok || m.RoomID != roomID || m.IsDeleted() {
+		return models.Message{}, ErrNotFound
+	}
+	if keepHistory {
+		m.Edits = append(append([]models.MessageEdit(nil), m.Edits...), models.MessageEdit{Content: m.Content, EditedAt: at})
+	}
+	m.Content, m.EditedAt = content, &at
+	s.byID[id] = m
+	return m, nil
+}
+
+func (s *memMessages) AddReply(_ context.Context, roomID, parentID primitive.ObjectID, at time.Time) (models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.byID[parentID]
+	if !ok || m.RoomID != roomID {
+		return models.Message{}, ErrNotFound
+	}
+	m.ReplyCount++
+	if m.LastReplyAt == nil || at.After(*m.LastReplyAt) {
+		m.LastReplyAt = &at
+	}
+	s.byID[parentID] = m
+	return m, nil
+}
+
+func (s *memMessages) RemoveReply(_ context.Context, roomID, parentID primitive.ObjectID) (models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.byID[parentID]
+	if !ok || m.RoomID != roomID || m.ReplyCount == 0 {
+		return models.Message{}, ErrNotFound
+	}
+	var latest *time.Time
+	for _, r := range s.byID {
+		if r.RoomID == roomID && r.ParentID != nil && *r.ParentID == parentID && !r.IsDeleted() {
+			if latest == nil || r.CreatedAt.After(*latest) {
+				at := r.CreatedAt
+				latest = &at
+			}
+		}
+	}
+	m.ReplyCount--
+	m.LastReplyAt = latest
+	s.byID[parentID] = m
+	return m, nil
+}
+
+func (s *memMessages) SoftDelete(_ context.Context, roomID, id, by primitive.ObjectID, at time.Time) (models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.byID[id]
+	if !ok || m.RoomID != roomID || m.IsDeleted() {
+		return models.Message{}, ErrNotFound
+	}
+	m.Content, m.Edits = "", nil
+	m.DeletedAt, m.DeletedBy = &at, &by
+	s.byID[id] = m
+	return m, nil
+}
+
+func (s *memMessages) DeleteByRoom(_ context.Context, roomID primitive.ObjectID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, m := range s.byID {
+		if m.RoomID == roomID {
+			delete(s.byID, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+type memInvitations struct {
+	mu   sync.RWMutex
+	byID map[primitive.ObjectID]models.Invitation
+}
+
+func (s *memInvitations) Create(_ context.Context, inv *models.Invitation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.byID {
+		if existing.RoomID == inv.RoomID && existing.InviteeID == inv.InviteeID && existing.Status == models.InvitePending {
+			return ErrConflict
+		}
+	}
+	if inv.ID.IsZero() {
+		inv.ID = primitive.NewObjectID()
+	}
+	s.byID[inv.ID] = *inv
+	return nil
+}
+
+func (s *memInvitations) ByID(_ context.Context, id primitive.ObjectID) (models.Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	inv, ok := s.byID[id]
+	if !ok {
+		return models.Invitation{}, ErrNotFound
+	}
+	return inv, nil
+}
+
+func (s *memInvitations) list(match func(models.Invitation) bool, status string) []models.Invitation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	invitations := []models.Invitation{}
+	for _, inv := range s.byID {
+		if match(inv) && (status == "" || inv.Status == status) {
+			invitations = append(invitations, inv)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].ID.Hex() > invitations[j].ID.Hex() })
+	return invitations
+}
+
+func (s *memInvitations) ListByRoom(_ context.Context, roomID primitive.ObjectID, status string) ([]models.Invitation, error) {
+	return s.list(func(inv models.Invitation) bool { return inv.RoomID == roomID }, status), nil
+}
+
+func (s *memInvitations) ListByInvitee(_ context.Context, userID primitive.ObjectID, status string) ([]models.Invitation, error) {
+	return s.list(func(inv models.Invitation) bool { return inv.InviteeID == userID }, status), nil
+}
+
+func (s *memInvitations) Respond(_ context.Context, id primitive.ObjectID, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.byID[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if inv.Status != models.InvitePending {
+		return ErrConflict
+	}
+	now := time.Now().UTC()
+	inv.Status, inv.RespondedAt = status, &now
+	s.byID[id] = inv
+	return nil
+}
+
+func (s *memInvitations) Reopen(_ context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.byID[id]
+	if !ok || inv.Status != models.InviteAccepted {
+		return ErrConflict
+	}
+	inv.Status, inv.RespondedAt = models.InvitePending, nil
+	s.byID[id] = inv
+	return nil
+}
+
+func (s *memInvitations) DeleteByRoom(_ context.Context, roomID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, inv := range s.byID {
+		if inv.RoomID == roomID {
+			delete(s.byID, id)
+		}
+	}
+	return nil
+}
+
+type memInviteLinks struct {
+	mu   sync.RWMutex
+	byID map[primitive.ObjectID]models.InviteLink
+}
+
+func (s *memInviteLinks) Create(_ context.Context, l *models.InviteLink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.byID {
+		if existing.Code == l.Code {
+			return ErrConflict
+		}
+	}
+	if l.ID.IsZero() {
+		l.ID = primitive.NewObjectID()
+	}
+	s.byID[l.ID] = *l
+	return nil
+}
+
+// byCode ต้องถือ lock อยู่แล้ว
+func (s *memInviteLinks) byCode(code string) (models.InviteLink, bool) {
+	for _, l := range s.byID {
+		if l.Code == code {
+			return l, true
+		}
+	}
+	return models.InviteLink{}, false
+}
+
+func (s *memInviteLinks) ByCode(_ context.Context, code string) (models.InviteLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	l, ok := s.byCode(code)
+	if !ok {
+		return l, ErrNotFound
+	}
+	return l, nil
+}
+
+func (s *memInviteLinks) ListByRoom(_ context.Context, roomID primitive.ObjectID) ([]models.InviteLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	links := []models.InviteLink{}
+	for _, l := range s.byID {
+		if l.RoomID == roomID {
+			links = append(links, l)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ID.Hex() > links[j].ID.Hex() })
+	return links, nil
+}
+
+func (s *memInviteLinks) Revoke(_ context.Context, roomID, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.byID[id]
+	if !ok || l.RoomID != roomID {
+		return ErrNotFound
+	}
+	if l.RevokedAt == nil {
+		now := time.Now().UTC()
+		l.RevokedAt = &now
+		s.byID[id] = l
+	}
+	return nil
+}
+
+func (s *memInviteLinks) Use(_ context.Context, code string, now time.Time) (models.InviteLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.byCode(code)
+	if !ok {
+		return l, ErrNotFound
+	}
+	if l.State(now) != models.InviteLinkActive {
+		return l, ErrConflict
+	}
+	l.Uses++
+	s.byID[l.ID] = l
+	return l, nil
+}
+
+func (s *memInviteLinks) Release(_ context.Context, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.byCode(code)
+	if !ok || l.Uses == 0 {
+		return ErrNotFound
+	}
+	l.Uses--
+	s.byID[l.ID] = l
+	return nil
+}
+
+func (s *memInviteLinks) DeleteByRoom(_ context.Context, roomID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, l := range s.byID {
+		if l.RoomID == roomID {
+			delete(s.byID, id)
+		}
+	}
+	return nil
+}
+
+type memSessions struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	users   map[string]userRevocation
+}
+
+type userRevocation struct {
+	before, until time.Time
+}
+
+func (s *memSessions) Revoke(_ context.Context, token string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !until.After(time.Now()) {
+		until = time.Now().Add(time.Hour)
+	}
+	s.revoked[token] = until
+	return nil
+}
+
+func (s *memSessions) IsRevoked(_ context.Context, token string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, ok := s.revoked[token]
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(until) {
+		delete(s.revoked, token)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *memSessions) RevokeUser(_ context.Context, userID string, issuedBefore, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[userID] = userRevocation{before: issuedBefore, until: until}
+	return nil
+}
+
+func (s *memSessions) RevokedBefore(_ context.Context, userID string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rev, ok := s.users[userID]
+	if !ok {
+		return time.Time{}, nil
+	}
+	if time.Now().After(rev.until) {
+		delete(s.users, userID)
+		return time.Time{}, nil
+	}
+	return rev.before, nil
+}
+
+type memKeys struct {
+	mu   sync.RWMutex
+	keys []models.SigningKey
+}
+
+func (s *memKeys) List(_ context.Context) ([]models.SigningKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := append([]models.SigningKey{}, s.keys...)
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].ActiveAt.Before(keys[j].ActiveAt) })
+	return keys, nil
+}
+
+func (s *memKeys) Create(_ context.Context, k models.SigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.keys {
+		if existing.ID == k.ID {
+			return ErrConflict
+		}
+	}
+	s.keys = append(s.keys, k)
+	return nil
+}
+
+func (s *memKeys) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, k := range s.keys {
+		if k.ID == id {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+type memAudit struct {
+	mu     sync.RWMutex
+	events []models.AuditEvent
+}
+
+func (f AuditFilter) match(ev models.AuditEvent) bool {
+	switch {
+	case f.Action != "" && ev.Action != f.Action,
+		f.Outcome != "" && ev.Outcome != f.Outcome,
+		f.ActorID != "" && ev.ActorID != f.ActorID,
+		f.TargetID != "" && ev.TargetID != f.TargetID,
+		f.RequestID != "" && ev.RequestID != f.RequestID,
+		!f.From.IsZero() && ev.CreatedAt.Before(f.From),
+		!f.To.IsZero() && !ev.CreatedAt.Before(f.To):
+		return false
+	}
+	return true
+}
+
+func (s *memAudit) Insert(_ context.Context, ev models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ev.ID.IsZero() {
+		ev.ID = primitive.NewObjectID()
+	}
+	s.events = append(s.events, ev)
+	return nil
+}
+
+// matching คืน event ที่ตรง filter เรียงจากเก่าไปใหม่
+func (s *memAudit) matching(f AuditFilter) []models.AuditEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []models.AuditEvent
+	for _, ev := range s.events {
+		if f.match(ev) {
+			out = append(out, ev)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+func (s *memAudit) Query(_ context.Context, f AuditFilter, page, limit int) ([]models.AuditEvent, int64, error) {
+	page, limit = auditPage(page, limit)
+	all := s.matching(f)
+
+	events := []models.AuditEvent{}
+	for i := len(all) - 1 - (page-1)*limit; i >= 0 && len(events) < limit; i-- {
+		events = append(events, all[i])
+	}
+	return events, int64(len(all)), nil
+}
+
+func (s *memAudit) Stream(ctx context.Context, f AuditFilter, fn func(models.AuditEvent) error) error {
+	for _, ev := range s.matching(f) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,778 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"mychat-auth/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMongo สร้าง store บน collection ของ database เดียวกับที่ database.InitMongo ใช้
+// Sessions ไม่ได้อยู่ใน Mongo ผู้เรียกต้องใส่เอง (ดู NewRedisSessionStore)
+func NewMongo(db *mongo.Database) Stores {
+	return Stores{
+		Users:       &mongoUsers{c: db.Collection("users")},
+		Rooms:       &mongoRooms{c: db.Collection("rooms")},
+		Messages:    &mongoMessages{c: db.Collection("messages")},
+		Audit:       &mongoAudit{c: db.Collection("audit_events")},
+		Keys:        &mongoKeys{c: db.Collection("signing_keys")},
+		Invitations: &mongoInvitations{c: db.Collection("invitations")},
+		InviteLinks: &mongoInviteLinks{c: db.Collection("invite_links")},
+	}
+}
+
+// updateByID อัปเดตเอกสารเดียวตาม _id คืน ErrNotFound ถ้าไม่มีเอกสารนั้น
+func updateByID(ctx context.Context, c *mongo.Collection, id interface{}, update bson.M) error {
+	res, err := c.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return mongoErr(err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// mongoErr แปลง error ของ driver เป็น error ของ store
+func mongoErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return ErrConflict
+	}
+	return err
+}
+
+type mongoUsers struct {
+	c *mongo.Collection
+}
+
+func (s *mongoUsers) Create(ctx context.Context, u *models.User) error {
+	count, err := s.c.CountDocuments(ctx, bson.M{"email": u.Email})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrConflict
+	}
+	if u.ID.IsZero() {
+		u.ID = primitive.NewObjectID()
+	}
+	_, err = s.c.InsertOne(ctx, u)
+	return mongoErr(err)
+}
+
+func (s *mongoUsers) ByID(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	var u models.User
+	err := s.c.FindOne(ctx, bson.M{"_id": id}).Decode(&u)
+	return u, mongoErr(err)
+}
+
+func (s *mongoUsers) ByEmail(ctx context.Context, email string) (models.User, error) {
+	var u models.User
+	err := s.c.FindOne(ctx, bson.M{"email": email}).Decode(&u)
+	return u, mongoErr(err)
+}
+
+func (s *mongoUsers) ByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error) {
+	cursor, err := s.c.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *mongoUsers) SetRole(ctx context.Context, id primitive.ObjectID, role string) error {
+	return updateByID(ctx, s.c, id, bson.M{"$set": bson.M{"role": role}})
+}
+
+func (s *mongoUsers) SetPassword(ctx context.Context, id primitive.ObjectID, hash string) error {
+	return updateByID(ctx, s.c, id, bson.M{"$set": bson.M{"password": hash}})
+}
+
+func (s *mongoUsers) SetDisabled(ctx context.Context, id primitive.ObjectID, disabled bool) error {
+	if !disabled {
+		return updateByID(ctx, s.c, id, bson.M{"$unset": bson.M{"disabled": "", "disabled_at": ""}})
+	}
+	return updateByID(ctx, s.c, id, bson.M{"$set": bson.M{"disabled": true, "disabled_at": time.Now().UTC()}})
+}
+
+type mongoRooms struct {
+	c *mongo.Collection
+}
+
+func (s *mongoRooms) List(ctx context.Context) ([]models.Room, error) {
+	cursor, err := s.c.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	rooms := []models.Room{}
+	if err := cursor.All(ctx, &rooms); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
+
+func (s *mongoRooms) ListVisible(ctx context.Context, userID primitive.ObjectID) ([]models.Room, error) {
+	filter := bson.M{
+		"archived": bson.M{"$ne": true},
+		"type":     bson.M{"$ne": models.RoomTypeDM},
+		"$or": bson.A{
+			bson.M{"type": bson.M{"$ne": models.RoomTypePrivate}},
+			bson.M{"members._id": userID},
+		},
+	}
+	cursor, err := s.c.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	rooms := []models.Room{}
+	if err := cursor.All(ctx, &rooms); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
+
+func (s *mongoRooms) ListDMs(ctx context.Context, userID primitive.ObjectID) ([]models.Room, error) {
+	filter := bson.M{"type": models.RoomTypeDM, "members._id": userID}
+	opts := options.Find().SetSort(bson.D{{Key: "last_activity_at", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := s.c.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	rooms := []models.Room{}
+	if err := cursor.All(ctx, &rooms); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
+
+func (s *mongoRooms) DMByKey(ctx context.Context, key string) (models.Room, error) {
+	var room models.Room
+	err := s.c.FindOne(ctx, bson.M{"type": models.RoomTypeDM, "dm_key": key}).Decode(&room)
+	return room, mongoErr(err)
+}
+
+func (s *mongoRooms) ByID(ctx context.Context, id primitive.ObjectID) (models.Room, error) {
+	var room models.Room
+	err := s.c.FindOne(ctx, bson.M{"_id": id}).Decode(&room)
+	return room, mongoErr(err)
+}
+
+func (s *mongoRooms) nameTaken(ctx context.Context, name string, except primitive.ObjectID) (bool, error) {
+	count, err := s.c.CountDocuments(ctx, bson.M{"name": name, "_id": bson.M{"$ne": except}})
+	return count > 0, err
+}
+
+func (s *mongoRooms) Create(ctx context.Context, room *models.Room) error {
+	taken, err := s.nameTaken(ctx, room.Name, primitive.NilObjectID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrConflict
+	}
+	if room.ID.IsZero() {
+		room.ID = primitive.NewObjectID()
+	}
+	_, err = s.c.InsertOne(ctx, room)
+	return mongoErr(err)
+}
+
+func (s *mongoRooms) Update(ctx context.Context, id primitive.ObjectID, u RoomUpdate) error {
+	set := bson.M{}
+	if u.Name != nil {
+		taken, err := s.nameTaken(ctx, *u.Name, id)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrConflict
+		}
+		set["name"] = *u.Name
+	}
+	if u.Type != nil {
+		set["type"] = *u.Type
+	}
+	unset := bson.M{}
+	// ค่าว่างคือลบ topic/description ออก ไม่เก็บ string ว่างไว้
+	for field, v := range map[string]*string{"topic": u.Topic, "description": u.Description} {
+		switch {
+		case v == nil:
+		case *v == "":
+			unset[field] = ""
+		default:
+			set[field] = *v
+		}
+	}
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	if len(update) == 0 {
+		return nil
+	}
+	return updateByID(ctx, s.c, id, update)
+}
+
+func (s *mongoRooms) AddMember(ctx context.Context, roomID primitive.ObjectID, m models.RoomMember) error {
+	// push เฉพาะคนที่ยังไม่เป็นสมาชิก กันไม่ให้ role เดิมถูกทับหรือมีชื่อซ้ำ
+	filter := bson.M{"_id": roomID, "members._id": bson.M{"$ne": m.ID}}
+	res, err := s.c.UpdateOne(ctx, filter, bson.M{"$push": bson.M{"members": m}})
+	if err != nil {
+		return mongoErr(err)
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+	count, err := s.c.CountDocuments(ctx, bson.M{"_id": roomID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoRooms) SetMemberRole(ctx context.Context, roomID, userID primitive.ObjectID, role string) error {
+	filter := bson.M{"_id": roomID, "members._id": userID}
+	res, err := s.c.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"members.$.role": role}})
+	if err != nil {
+		return mongoErr(err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoRooms) TransferOwnership(ctx context.Context, roomID, from, to primitive.ObjectID) error {
+	// ทำใน update เดียวเพื่อไม่ให้มีจังหวะที่ห้องมี owner สองคนหรือไม่มีเลย
+	filter := bson.M{"_id": roomID, "members._id": bson.M{"$all": bson.A{from, to}}}
+	update := bson.M{"$set": bson.M{
+		"owner_id":                 to,
+		"members.$[newOwner].role": models.RoomRoleOwner,
+		"members.$[oldOwner].role": models.RoomRoleModerator,
+	}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+		bson.M{"newOwner._id": to},
+		bson.M{"oldOwner._id": from},
+	}})
+	res, err := s.c.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return mongoErr(err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *mongoRooms) RemoveMember(ctx context.Context, roomID, userID primitive.ObjectID) error {
+	update := bson.M{"$pull": bson.M{"members": bson.M{"_id": userID}}}
+	res, err := s.c.UpdateOne(ctx, bson.M{"_id": roomID}, update)
+	if err != nil {
+		return mongoErr(err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoRooms) SetArchived(ctx context.Context, id primitive.ObjectID, archived bool) error {
+	if !archived {
+		return updateByID(ctx, s.c, id, bson.M{"$unset": bson.M{"archived": "", "archived_at": ""}})
+	}
+	return updateByID(ctx, s.c, id, bson.M{"$set": bson.M{"archived": true, "archived_at": time.Now().UTC()}})
+}
+
+func (s *mongoRooms) Touch(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	return updateByID(ctx, s.c, id, bson.M{"$max": bson.M{"last_activity_at": at.UTC()}})
+}
+
+func (s *mongoRooms) Delete(ctx context.Context, id primitive.ObjectID) error {
+	res, err := s.c.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return mongoErr(err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoMessages struct {
+	c *mongo.Collection
+}
+
+func (s *mongoMessages) Create(ctx context.Context, m *models.Message) error {
+	if m.ID.IsZero() {
+		m.ID = primitive.NewObjectID()
+	}
+	_, err := s.c.InsertOne(ctx, m)
+	return mongoErr(err)
+}
+
+func (s *mongoMessages) ByID(ctx context.Context, roomID, id primitive.ObjectID) (models.Message, error) {
+	var m models.Message
+	err := s.c.FindOne(ctx, bson.M{"_id": id, "room_id": roomID}).Decode(&m)
+	return m, mongoErr(err)
+}
+
+func (s *mongoMessages) ListByRoom(ctx context.Context, roomID primitive.ObjectID, q MessageQuery) ([]models.Message, bool, error) {
+	// parent_id null ตรงกับเอกสารที่ไม่มี field นี้ด้วย จึงใช้ index เดียวกันได้ทั้งห้องและ thread
+	filter := bson.M{"room_id": roomID, "parent_id": q.ParentID}
+	// อ่านจาก cursor ออกไปทางที่ขอ แล้วค่อยกลับลำดับให้เป็นเก่าไปใหม่
+	dir, op, c := -1, "$lt", q.Before
+	if q.After != nil {
+		dir, op, c = 1, "$gt", q.After
+	}
+	if c != nil {
+		filter["$or"] = bson.A{
+			bson.M{"created_at": bson.M{op: c.CreatedAt}},
+			bson.M{"created_at": c.CreatedAt, "_id": bson.M{op: c.ID}},
+		}
+	}
+	// ขอเกินหนึ่งตัวเพื่อรู้ว่ายังมีต่อหรือไม่
+	limit := messagePageSize(q.Limit)
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: dir}, {Key: "_id", Value: dir}}).
+		SetLimit(int64(limit + 1))
+	cursor, err := s.c.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	messages := []models.Message{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, false, err
+	}
+	more := len(messages) > limit
+	if more {
+		messages = messages[:limit]
+	}
+	if dir < 0 {
+		reverseMessages(messages)
+	}
+	return messages, more, nil
+}
+
+func (s *mongoMessages) Edit(ctx context.Context, roomID, id primitive.ObjectID, content string, at time.Time, keepHistory bool) (models.Message, error) {
+	set := bson.M{"content": bson.M{"$literal": content}, "edited_at": at}
+	if keepHistory {
+		// ใช้ pipeline เพื่ออ่านเนื้อหาเดิมและเขียนเนื้อหาใหม่ในคำสั่งเดียว แก้พร้อมกันสองครั้งก็ไม่หาย
+		set["edits"] = bson.M{"$concatArrays": bson.A{
+			bson.M{"$ifNull": bson.A{"$edits", bson.A{}}},
+			bson.A{bson.M{"content": "$content", "edited_at": at}},
+		}}
+	}
+	var m models.Message
+	err := s.c.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "room_id": roomID, "deleted_at": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: set}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&m)
+	return m, mongoErr(err)
+}
+
+func (s *mongoMessages) AddReply(ctx context.Context, roomID, parentID primitive.ObjectID, at time.Time) (models.Message, error) {
+	var m models.Message
+	err := s.c.FindOneAndUpdate(ctx,
+		bson.M{"_id": parentID, "room_id": roomID},
+		bson.M{
+			"$inc": bson.M{"reply_count": 1},
+			"$max": bson.M{"last_reply_at": at},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&m)
+	return m, mongoErr(err)
+}
+
+func (s *mongoMessages) RemoveReply(ctx context.Context, roomID, parentID primitive.ObjectID) (models.Message, error) {
+	var latest models.Message
+	err := s.c.FindOne(ctx,
+		bson.M{"room_id": roomID, "parent_id": parentID, "deleted_at": bson.M{"$exists": false}},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}),
+	).Decode(&latest)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Message{}, err
+	}
+
+	update := bson.M{"$inc": bson.M{"reply_count": -1}}
+	if err == nil {
+		update["$set"] = bson.M{"last_reply_at": latest.CreatedAt}
+	} else {
+		update["$unset"] = bson.M{"last_reply_at": ""}
+	}
+	var m models.Message
+	err = s.c.FindOneAndUpdate(ctx,
+		bson.M{"_id": parentID, "room_id": roomID, "reply_count": bson.M{"$gt": 0}},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&m)
+	return m, mongoErr(err)
+}
+
+func (s *mongoMessages) SoftDelete(ctx context.Context, roomID, id, by primitive.ObjectID, at time.Time) (models.Message, error) {
+	var m models.Message
+	err := s.c.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "room_id": roomID, "deleted_at": bson.M{"$exists": false}},
+		bson.M{
+			"$set":   bson.M{"content": "", "deleted_at": at, "deleted_by": by},
+			"$unset": bson.M{"edits": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&m)
+	return m, mongoErr(err)
+}
+
+func (s *mongoMessages) DeleteByRoom(ctx context.Context, roomID primitive.ObjectID) (int64, error) {
+	res, err := s.c.DeleteMany(ctx, bson.M{"room_id": roomID})
+	if err != nil {
+		return 0, mongoErr(err)
+	}
+	return res.DeletedCount, nil
+}
+
+type mongoInvitations struct {
+	c *mongo.Collection
+}
+
+func (s *mongoInvitations) Create(ctx context.Context, inv *models.Invitation) error {
+	// unique index บางส่วน (room_id, invitee_id) เฉพาะ pending กันเชิญซ้ำพร้อมกัน ส่วนนี้ทำให้ได้ error ที่ชัดก่อน
+	filter := bson.M{"room_id": inv.RoomID, "invitee_id": inv.InviteeID, "status": models.InvitePending}
+	count, err := s.c.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrConflict
+	}
+	if inv.ID.IsZero() {
+		inv.ID = primitive.NewObjectID()
+	}
+	_, err = s.c.InsertOne(ctx, inv)
+	return mongoErr(err)
+}
+
+func (s *mongoInvitations) ByID(ctx context.Context, id primitive.ObjectID) (models.Invitation, error) {
+	var inv models.Invitation
+	err := s.c.FindOne(ctx, bson.M{"_id": id}).Decode(&inv)
+	return inv, mongoErr(err)
+}
+
+func (s *mongoInvitations) list(ctx context.Context, filter bson.M, status string) ([]models.Invitation, error) {
+	if status != "" {
+		filter["status"] = status
+	}
+	cursor, err := s.c.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	invitations := []models.Invitation{}
+	if err := cursor.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (s *mongoInvitations) ListByRoom(ctx context.Context, roomID primitive.ObjectID, status string) ([]models.Invitation, error) {
+	return s.list(ctx, bson.M{"room_id": roomID}, status)
+}
+
+func (s *mongoInvitations) ListByInvitee(ctx context.Context, userID primitive.ObjectID, status string) ([]models.Invitation, error) {
+	return s.list(ctx, bson.M{"invitee_id": userID}, status)
+}
+
+func (s *mongoInvitations) Respond(ctx context.Context, id primitive.ObjectID, status string) error {
+	filter := bson.M{"_id": id, "status": models.InvitePending}
+	update := bson.M{"$set": bson.M{"status": status, "responded_at": time.Now().UTC()}}
+	res, err := s.c.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return mongoErr(err)
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+	count, err := s.c.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrConflict
+}
+
+func (s *mongoInvitations) Reopen(ctx context.Context, id primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "status": models.InviteAccepted}
+	update := bson.M{"$set": bson.M{"status": models.InvitePending}, "$unset": bson.M{"responded_at": ""}}
+	res, err := s.c.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return mongoErr(err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *mongoInvitations) DeleteByRoom(ctx context.Context, roomID primitive.ObjectID) error {
+	_, err := s.c.DeleteMany(ctx, bson.M{"room_id": roomID})
+	return mongoErr(err)
+}
+
+type mongoInviteLinks struct {
+	c *mongo.Collection
+}
+
+func (s *mongoInviteLinks) Create(ctx context.Context, l *models.InviteLink) error {
+	if l.ID.IsZero() {
+		l.ID = primitive.NewObjectID()
+	}
+	_, err := s.c.InsertOne(ctx, l)
+	return mongoErr(err)
+}
+
+func (s *mongoInviteLinks) ByCode(ctx context.Context, code string) (models.InviteLink, error) {
+	var l models.InviteLink
+	err := s.c.FindOne(ctx, bson.M{"code": code}).Decode(&l)
+	return l, mongoErr(err)
+}
+
+func (s *mongoInviteLinks) ListByRoom(ctx context.Context, roomID primitive.ObjectID) ([]models.InviteLink, error) {
+	cursor, err := s.c.Find(ctx, bson.M{"room_id": roomID}, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	links := []models.InviteLink{}
+	if err := cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func (s *mongoInviteLinks) Revoke(ctx context.Context, roomID, id primitive.ObjectID) error {
+	// ไม่ทับ revoked_at เดิม จะได้รู้ว่าเพิกถอนครั้งแรกเมื่อไร
+	filter := bson.M{"_id": id, "room_id": roomID, "revoked_at": bson.M{"$exists": false}}
+	res, err := s.c.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now().UTC()}})
+	if err != nil {
+		return mongoErr(err)
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+	count, err := s.c.CountDocuments(ctx, bson.M{"_id": id, "room_id": roomID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoInviteLinks) Use(ctx context.Context, code string, now time.Time) (models.InviteLink, error) {
+	// ตรวจเงื่อนไขและนับในคำสั่งเดียว คนใช้พร้อมกันจะไม่เกิน max_uses
+	filter := bson.M{
+		"code":       code,
+		"revoked_at": bson.M{"$exists": false},
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"expires_at": bson.M{"$exists": false}},
+				bson.M{"expires_at": bson.M{"$gt": now}},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"max_uses": bson.M{"$exists": false}},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$uses", "$max_uses"}}},
+			}},
+		},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var l models.InviteLink
+	err := s.c.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"uses": 1}}, opts).Decode(&l)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return l, mongoErr(err)
+	}
+	count, err := s.c.CountDocuments(ctx, bson.M{"code": code})
+	if err != nil {
+		return l, err
+	}
+	if count == 0 {
+		return l, ErrNotFound
+	}
+	return l, ErrConflict
+}
+
+func (s *mongoInviteLinks) Release(ctx context.Context, code string) error {
+	res, err := s.c.UpdateOne(ctx, bson.M{"code": code, "uses": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"uses": -1}})
+	if err != nil {
+		return mongoErr(err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoInviteLinks) DeleteByRoom(ctx context.Context, roomID primitive.ObjectID) error {
+	_, err := s.c.DeleteMany(ctx, bson.M{"room_id": roomID})
+	return mongoErr(err)
+}
+
+type mongoAudit struct {
+	c *mongo.Collection
+}
+
+func auditQuery(f AuditFilter) bson.M {
+	q := bson.M{}
+	if f.Action != "" {
+		q["action"] = f.Action
+	}
+	if f.Outcome != "" {
+		q["outcome"] = f.Outcome
+	}
+	if f.ActorID != "" {
+		q["actor_id"] = f.ActorID
+	}
+	if f.TargetID != "" {
+		q["target_id"] = f.TargetID
+	}
+	if f.RequestID != "" {
+		q["request_id"] = f.RequestID
+	}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		created := bson.M{}
+		if !f.From.IsZero() {
+			created["$gte"] = f.From
+		}
+		if !f.To.IsZero() {
+			created["$lt"] = f.To
+		}
+		q["created_at"] = created
+	}
+	return q
+}
+
+func (s *mongoAudit) Insert(ctx context.Context, ev models.AuditEvent) error {
+	_, err := s.c.InsertOne(ctx, ev)
+	return mongoErr(err)
+}
+
+func (s *mongoAudit) Query(ctx context.Context, f AuditFilter, page, limit int) ([]models.AuditEvent, int64, error) {
+	page, limit = auditPage(page, limit)
+
+	q := auditQuery(f)
+	total, err := s.c.CountDocuments(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cursor, err := s.c.Find(ctx, q, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	events := []models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+func (s *mongoAudit) Stream(ctx context.Context, f AuditFilter, fn func(models.AuditEvent) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := s.c.Find(ctx, auditQuery(f), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var ev models.AuditEvent
+		if err := cursor.Decode(&ev); err != nil {
+			return err
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+type mongoKeys struct {
+	c *mongo.Collection
+}
+
+func (s *mongoKeys) List(ctx context.Context) ([]models.SigningKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "active_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := s.c.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	keys := []models.SigningKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *mongoKeys) Create(ctx context.Context, k models.SigningKey) error {
+	_, err := s.c.InsertOne(ctx, k)
+	return mongoErr(err)
+}
+
+func (s *mongoKeys) Delete(ctx context.Context, id string) error {
+	res, err := s.c.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return mongoErr(err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func messagePageSize(limit int) int {
+	if limit <= 0 || limit > MaxMessagePageSize {
+		return MaxMessagePageSize
+	}
+	return limit
+}
+
+func reverseMessages(m []models.Message) {
+	for i, j := 0, len(m)-1; i < j; i, j = i+1, j-1 {
+		m[i], m[j] = m[j], m[i]
+	}
+}
+
+func auditPage(page, limit int) (int, int) {
+	if limit <= 0 || limit > MaxAuditPageSize {
+		limit = MaxAuditPageSize
+	}
+	if page < 1 {
+		page = 1
+	}
+	return page, limit
+}
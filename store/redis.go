@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NewRedisSessionStore เก็บ token ที่ถูกเพิกถอนเป็น key "blacklist:<token>" ที่หมดอายุพร้อม token
+// และเวลาที่เพิกถอนทั้ง user เป็น key "revoked_before:<userID>" (unix seconds)
+func NewRedisSessionStore(c *redis.Client) SessionStore {
+	return &redisSessions{c: c}
+}
+
+type redisSessions struct {
+	c *redis.Client
+}
+
+func (s *redisSessions) Revoke(ctx context.Context, token string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		ttl = time.Hour // fallback กันไว้ 1 ชม.
+	}
+	return s.c.Set(ctx, "blacklist:"+token, "1", ttl).Err()
+}
+
+func (s *redisSessions) IsRevoked(ctx context.Context, token string) (bool, error) {
+	err := s.c.Get(ctx, "blacklist:"+token).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *redisSessions) RevokeUser(ctx context.Context, userID string, issuedBefore, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	return s.c.Set(ctx, "revoked_before:"+userID, issuedBefore.Unix(), ttl).Err()
+}
+
+func (s *redisSessions) RevokedBefore(ctx context.Context, userID string) (time.Time, error) {
+	v, err := s.c.Get(ctx, "revoked_before:"+userID).Result()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0), nil
+}
@@ -0,0 +1,208 @@
+// Package store แยกการเข้าถึงข้อมูลออกจาก handler
+// มี implementation จริงบน Mongo/Redis และแบบ in-memory สำหรับรัน HTTP/WebSocket ทั้งชุดใน process เดียว
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"mychat-auth/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFound คือหาเอกสารที่ขอไม่เจอ
+	ErrNotFound = errors.New("store: not found")
+	// ErrConflict คือชนกับข้อมูลที่มีอยู่ (ค่าที่ต้อง unique ซ้ำ หรือข้อมูลเปลี่ยนไประหว่างทำงาน)
+	ErrConflict = errors.New("store: conflict")
+)
+
+// MaxAuditPageSize คือจำนวน audit event สูงสุดต่อหน้า
+const MaxAuditPageSize = 100
+
+// MaxMessagePageSize คือจำนวนข้อความสูงสุดที่ ListByRoom คืนต่อครั้ง
+const MaxMessagePageSize = 100
+
+// Stores รวม store ทุกตัวที่ Server ใช้
+type Stores struct {
+	Users       UserStore
+	Rooms       RoomStore
+	Messages    MessageStore
+	Sessions    SessionStore
+	Audit       AuditStore
+	Keys        KeyStore
+	Invitations InvitationStore
+	InviteLinks InviteLinkStore
+}
+
+type UserStore interface {
+	// Create กำหนด ID ให้ user แล้วบันทึก คืน ErrConflict ถ้าอีเมลซ้ำ
+	Create(ctx context.Context, u *models.User) error
+	ByID(ctx context.Context, id primitive.ObjectID) (models.User, error)
+	ByEmail(ctx context.Context, email string) (models.User, error)
+	// ByIDs คืนเฉพาะ user ที่เจอ ไม่รับประกันลำดับ
+	ByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error)
+	// SetRole, SetPassword และ SetDisabled คืน ErrNotFound ถ้าไม่มี user
+	SetRole(ctx context.Context, id primitive.ObjectID, role string) error
+	SetPassword(ctx context.Context, id primitive.ObjectID, hash string) error
+	SetDisabled(ctx context.Context, id primitive.ObjectID, disabled bool) error
+}
+
+// RoomUpdate คือช่องที่แก้ได้ของห้อง ช่องที่เป็น nil จะไม่ถูกแตะ
+type RoomUpdate struct {
+	Name        *string
+	Type        *string
+	Topic       *string
+	Description *string
+}
+
+// Empty บอกว่าไม่มีช่องไหนต้องแก้
+func (u RoomUpdate) Empty() bool {
+	return u.Name == nil && u.Type == nil && u.Topic == nil && u.Description == nil
+}
+
+type RoomStore interface {
+	List(ctx context.Context) ([]models.Room, error)
+	// ListVisible คืนห้องที่ยังไม่ archive ซึ่ง user เห็นได้: ห้อง public ทุกห้องและห้อง private ที่เป็นสมาชิก
+	// ไม่รวม DM ซึ่งดูได้จาก ListDMs
+	ListVisible(ctx context.Context, userID primitive.ObjectID) ([]models.Room, error)
+	// ListDMs คืน DM ของ user เรียงจากที่มีความเคลื่อนไหวล่าสุด
+	ListDMs(ctx context.Context, userID primitive.ObjectID) ([]models.Room, error)
+	ByID(ctx context.Context, id primitive.ObjectID) (models.Room, error)
+	// DMByKey หา DM ของคนกลุ่มนี้ตาม models.DMKey เฉพาะห้องแบบ dm เท่านั้น
+	DMByKey(ctx context.Context, key string) (models.Room, error)
+	// Create คืน ErrConflict ถ้าชื่อห้องซ้ำ
+	Create(ctx context.Context, room *models.Room) error
+	// Update คืน ErrConflict ถ้าเปลี่ยนชื่อไปซ้ำกับห้องอื่น
+	Update(ctx context.Context, id primitive.ObjectID, u RoomUpdate) error
+	// AddMember เพิ่มสมาชิกถ้ายังไม่อยู่ในห้อง (ไม่ทับ role เดิม) คืน ErrNotFound ถ้าไม่มีห้อง
+	AddMember(ctx context.Context, roomID primitive.ObjectID, m models.RoomMember) error
+	SetMemberRole(ctx context.Context, roomID, userID primitive.ObjectID, role string) error
+	// TransferOwnership ย้าย owner และลด owner เดิมเป็น moderator ในครั้งเดียว
+	// คืน ErrConflict ถ้าคนใดคนหนึ่งไม่ได้อยู่ในห้องแล้ว
+	TransferOwnership(ctx context.Context, roomID, from, to primitive.ObjectID) error
+	RemoveMember(ctx context.Context, roomID, userID primitive.ObjectID) error
+	// SetArchived คืน ErrNotFound ถ้าไม่มีห้อง
+	SetArchived(ctx context.Context, id primitive.ObjectID, archived bool) error
+	// Touch ตั้ง LastActivityAt ของห้อง
+	Touch(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	// Delete ลบเฉพาะเอกสารของห้อง ข้อความและคำเชิญผู้เรียกต้องลบเอง คืน ErrNotFound ถ้าไม่มีห้อง
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// MessageCursor คือตำแหน่งในประวัติข้อความ ข้อความเรียงตาม (created_at, _id) เสมอ
+// _id ใช้ตัดสินเมื่อ created_at เท่ากัน
+type MessageCursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+}
+
+// CursorOf คืนตำแหน่งของข้อความ m
+func CursorOf(m models.Message) *MessageCursor {
+	return &MessageCursor{CreatedAt: m.CreatedAt, ID: m.ID}
+}
+
+// MessageQuery เลือกช่วงของประวัติข้อความ ระบุ Before หรือ After ได้อย่างใดอย่างหนึ่ง
+type MessageQuery struct {
+	// ParentID nil คือข้อความนอก thread ไม่งั้นคือ reply ใน thread ของข้อความนั้น
+	ParentID *primitive.ObjectID
+	// Before เอาข้อความที่เก่ากว่า cursor ส่วนที่ใกล้ cursor ที่สุด
+	Before *MessageCursor
+	// After เอาข้อความที่ใหม่กว่า cursor ส่วนที่ใกล้ cursor ที่สุด
+	After *MessageCursor
+	// Limit ที่ไม่อยู่ใน 1..MaxMessagePageSize จะใช้ MaxMessagePageSize
+	Limit int
+}
+
+type MessageStore interface {
+	Create(ctx context.Context, m *models.Message) error
+	// ByID หาข้อความในห้องที่ระบุเท่านั้น
+	ByID(ctx context.Context, roomID, id primitive.ObjectID) (models.Message, error)
+	// ListByRoom คืนข้อความตาม q เรียงจากเก่าไปใหม่ ไม่ระบุ cursor คือข้อความล่าสุด
+	// more บอกว่ายังมีข้อความถัดไปในทิศที่อ่าน (เก่ากว่าสำหรับ Before และแบบไม่มี cursor, ใหม่กว่าสำหรับ After)
+	ListByRoom(ctx context.Context, roomID primitive.ObjectID, q MessageQuery) (messages []models.Message, more bool, err error)
+	// Edit เปลี่ยนเนื้อหาข้อความที่ยังไม่ถูกลบ keepHistory เก็บเนื้อหาเดิมไว้ใน Edits
+	// ข้อความที่ไม่มีหรือลบไปแล้วคืน ErrNotFound
+	Edit(ctx context.Context, roomID, id primitive.ObjectID, content string, at time.Time, keepHistory bool) (models.Message, error)
+	// SoftDelete ล้างเนื้อหาและประวัติการแก้ เหลือ tombstone ไว้ในห้อง
+	// ข้อความที่ไม่มีหรือลบไปแล้วคืน ErrNotFound
+	SoftDelete(ctx context.Context, roomID, id, by primitive.ObjectID, at time.Time) (models.Message, error)
+	// AddReply นับ reply เพิ่มหนึ่งและเลื่อนเวลา reply ล่าสุดของ parent คืน parent หลังอัปเดต
+	AddReply(ctx context.Context, roomID, parentID primitive.ObjectID, at time.Time) (models.Message, error)
+	// RemoveReply นับ reply ลดหนึ่งหลัง reply ถูกลบ และตั้งเวลา reply ล่าสุดใหม่จาก reply ที่ยังไม่ถูกลบ
+	// คืน parent หลังอัปเดต
+	RemoveReply(ctx context.Context, roomID, parentID primitive.ObjectID) (models.Message, error)
+	// DeleteByRoom ลบทุกข้อความในห้อง คืนจำนวนที่ลบ
+	DeleteByRoom(ctx context.Context, roomID primitive.ObjectID) (int64, error)
+}
+
+type InvitationStore interface {
+	// Create คืน ErrConflict ถ้า user มีคำเชิญที่ยัง pending ในห้องนี้อยู่แล้ว
+	Create(ctx context.Context, inv *models.Invitation) error
+	ByID(ctx context.Context, id primitive.ObjectID) (models.Invitation, error)
+	// ListByRoom และ ListByInvitee เรียงจากใหม่ไปเก่า status "" คือทุกสถานะ
+	ListByRoom(ctx context.Context, roomID primitive.ObjectID, status string) ([]models.Invitation, error)
+	ListByInvitee(ctx context.Context, userID primitive.ObjectID, status string) ([]models.Invitation, error)
+	// Respond เปลี่ยนคำเชิญที่ยัง pending เป็น status คืน ErrConflict ถ้าคำเชิญไม่ pending แล้ว
+	Respond(ctx context.Context, id primitive.ObjectID, status string) error
+	// Reopen คืนคำเชิญที่เพิ่ง accepted กลับเป็น pending ใช้ย้อนเมื่อเข้าห้องไม่สำเร็จ
+	// คืน ErrConflict ถ้าคำเชิญไม่ได้อยู่ในสถานะ accepted
+	Reopen(ctx context.Context, id primitive.ObjectID) error
+	DeleteByRoom(ctx context.Context, roomID primitive.ObjectID) error
+}
+
+type InviteLinkStore interface {
+	Create(ctx context.Context, l *models.InviteLink) error
+	ByCode(ctx context.Context, code string) (models.InviteLink, error)
+	// ListByRoom เรียงจากใหม่ไปเก่า
+	ListByRoom(ctx context.Context, roomID primitive.ObjectID) ([]models.InviteLink, error)
+	// Revoke คืน ErrNotFound ถ้าไม่มีลิงก์นี้ในห้อง เพิกถอนซ้ำไม่เป็น error
+	Revoke(ctx context.Context, roomID, id primitive.ObjectID) error
+	// Use นับการใช้ลิงก์หนึ่งครั้งถ้ายังใช้ได้ ณ เวลา now และคืนลิงก์หลังนับ
+	// คืน ErrConflict ถ้าลิงก์ถูกเพิกถอน หมดอายุ หรือใช้ครบแล้ว
+	Use(ctx context.Context, code string, now time.Time) (models.InviteLink, error)
+	// Release คืนการใช้ลิงก์หนึ่งครั้งที่ Use นับไว้ ใช้ย้อนเมื่อเข้าห้องไม่สำเร็จ
+	Release(ctx context.Context, code string) error
+	DeleteByRoom(ctx context.Context, roomID primitive.ObjectID) error
+}
+
+// SessionStore เก็บ token ที่ถูกเพิกถอน (logout) จนกว่า token นั้นจะหมดอายุเอง
+type SessionStore interface {
+	Revoke(ctx context.Context, token string, until time.Time) error
+	IsRevoked(ctx context.Context, token string) (bool, error)
+	// RevokeUser เพิกถอน token ทุกตัวของ user ที่ออกก่อน issuedBefore
+	// เก็บไว้ถึง until ซึ่งควรเป็นเวลาที่ token ตัวสุดท้ายที่ออกก่อนหน้านั้นหมดอายุ
+	RevokeUser(ctx context.Context, userID string, issuedBefore, until time.Time) error
+	// RevokedBefore คืนเวลาที่ตั้งไว้ด้วย RevokeUser หรือ zero time ถ้าไม่มี
+	RevokedBefore(ctx context.Context, userID string) (time.Time, error)
+}
+
+// AuditFilter คือเงื่อนไขค้นหา audit event ทุกช่องเป็น optional
+type AuditFilter struct {
+	Action    string
+	Outcome   string
+	ActorID   string
+	TargetID  string
+	RequestID string
+	From      time.Time
+	To        time.Time
+}
+
+// KeyStore เก็บ keyring ของ JWT ที่ทุก replica ใช้ร่วมกัน
+type KeyStore interface {
+	// List คืน key ทั้งหมดเรียงตาม ActiveAt จากเก่าไปใหม่
+	List(ctx context.Context) ([]models.SigningKey, error)
+	Create(ctx context.Context, k models.SigningKey) error
+	Delete(ctx context.Context, id string) error
+}
+
+// AuditStore ตั้งใจไม่มี update หรือ delete event ที่บันทึกแล้วแก้ผ่านแอปไม่ได้ (database ไม่ได้บังคับ ดู package audit)
+type AuditStore interface {
+	Insert(ctx context.Context, ev models.AuditEvent) error
+	// Query คืน event เรียงจากใหม่ไปเก่า พร้อมจำนวนทั้งหมดที่ตรง filter
+	Query(ctx context.Context, f AuditFilter, page, limit int) ([]models.AuditEvent, int64, error)
+	// Stream เรียก fn ทีละ event เรียงจากเก่าไปใหม่
+	Stream(ctx context.Context, f AuditFilter, fn func(models.AuditEvent) error) error
+}
@@ -0,0 +1,430 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"mychat-auth/migrate"
+	"mychat-auth/models"
+	"mychat-auth/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ทุก implementation ของ store ต้องผ่านชุดเดียวกันนี้ handler test ใช้ memory แทน Mongo ได้ก็เพราะสองตัวนี้ทำงานเหมือนกัน
+
+func TestMemoryStores(t *testing.T) {
+	runStoreSuite(t, func(*testing.T) store.Stores { return store.NewMemory() })
+}
+
+// TestMongoStores รันกับ Mongo จริงเมื่อตั้ง MONGO_TEST_URI ไว้ แต่ละ test ได้ database ใหม่ที่ผ่าน migration แล้ว
+func TestMongoStores(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	runStoreSuite(t, func(t *testing.T) store.Stores {
+		db := client.Database("mychat_test_" + primitive.NewObjectID().Hex())
+		t.Cleanup(func() { _ = db.Drop(context.Background()) })
+		if _, err := migrate.Up(context.Background(), db); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		return store.NewMongo(db)
+	})
+}
+
+func runStoreSuite(t *testing.T, newStores func(*testing.T) store.Stores) {
+	tests := []struct {
+		name string
+		run  func(*testing.T, store.Stores)
+	}{
+		{"UserEmailUnique", testUserEmailUnique},
+		{"ListVisible", testListVisible},
+		{"ListDMs", testListDMs},
+		{"DMByKey", testDMByKey},
+		{"MessagePaging", testMessagePaging},
+		{"EditAndSoftDelete", testEditAndSoftDelete},
+		{"Replies", testReplies},
+		{"InvitationReopen", testInvitationReopen},
+		{"InviteLinkRelease", testInviteLinkRelease},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStores(t))
+		})
+	}
+}
+
+// baseTime ตัดเหลือระดับ millisecond เพราะ Mongo เก็บเวลาได้ละเอียดแค่นั้น
+var baseTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newUser(t *testing.T, st store.Stores, email string) models.User {
+	t.Helper()
+	u := models.User{Email: email, Password: "hash", Role: "member", CreatedAt: baseTime}
+	if err := st.Users.Create(context.Background(), &u); err != nil {
+		t.Fatalf("create user %s: %v", email, err)
+	}
+	return u
+}
+
+func newRoom(t *testing.T, st store.Stores, room models.Room) models.Room {
+	t.Helper()
+	if room.Members == nil {
+		room.Members = []models.RoomMember{}
+	}
+	room.CreatedAt = baseTime
+	if err := st.Rooms.Create(context.Background(), &room); err != nil {
+		t.Fatalf("create room %s: %v", room.Name, err)
+	}
+	return room
+}
+
+func member(u models.User, role string) models.RoomMember {
+	return models.RoomMember{SafeUser: u.ToSafeUser(), Role: role}
+}
+
+func newDM(t *testing.T, st store.Stores, lastActivity time.Time, users ...models.User) models.Room {
+	t.Helper()
+	ids := make([]primitive.ObjectID, len(users))
+	members := make([]models.RoomMember, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+		members[i] = member(u, models.RoomRoleMember)
+	}
+	key := models.DMKey(ids)
+	return newRoom(t, st, models.Room{Name: models.DMName(key), Type: models.RoomTypeDM, DMKey: key, Members: members, LastActivityAt: &lastActivity})
+}
+
+func newMessage(t *testing.T, st store.Stores, roomID primitive.ObjectID, sender models.User, content string, at time.Time, parentID *primitive.ObjectID) models.Message {
+	t.Helper()
+	m := models.Message{RoomID: roomID, SenderID: sender.ID, Sender: sender.Email, Content: content, CreatedAt: at, ParentID: parentID}
+	if err := st.Messages.Create(context.Background(), &m); err != nil {
+		t.Fatalf("create message %q: %v", content, err)
+	}
+	return m
+}
+
+func roomNames(rooms []models.Room) []string {
+	names := make([]string, len(rooms))
+	for i, r := range rooms {
+		names[i] = r.Name
+	}
+	return names
+}
+
+func contents(messages []models.Message) []string {
+	out := make([]string, len(messages))
+	for i, m := range messages {
+		out[i] = m.Content
+	}
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testUserEmailUnique(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	alice := newUser(t, st, "alice@example.com")
+
+	dup := models.User{Email: "alice@example.com", Password: "hash", CreatedAt: baseTime}
+	if err := st.Users.Create(ctx, &dup); !errors.Is(err, store.ErrConflict) {
+		t.Fatalf("duplicate email: got %v, want ErrConflict", err)
+	}
+	got, err := st.Users.ByEmail(ctx, "alice@example.com")
+	if err != nil || got.ID != alice.ID {
+		t.Fatalf("ByEmail = %v, %v; want %v", got.ID, err, alice.ID)
+	}
+	if _, err := st.Users.ByID(ctx, primitive.NewObjectID()); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("ByID unknown: got %v, want ErrNotFound", err)
+	}
+}
+
+func testListVisible(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	alice := newUser(t, st, "alice@example.com")
+	bob := newUser(t, st, "bob@example.com")
+
+	newRoom(t, st, models.Room{Name: "general", Type: models.RoomTypePublic})
+	newRoom(t, st, models.Room{Name: "alice-only", Type: models.RoomTypePrivate, Members: []models.RoomMember{member(alice, models.RoomRoleOwner)}})
+	archived := newRoom(t, st, models.Room{Name: "old", Type: models.RoomTypePublic})
+	if err := st.Rooms.SetArchived(ctx, archived.ID, true); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	newDM(t, st, baseTime, alice, bob)
+
+	for _, tc := range []struct {
+		user models.User
+		want []string
+	}{
+		{alice, []string{"general", "alice-only"}},
+		{bob, []string{"general"}},
+	} {
+		rooms, err := st.Rooms.ListVisible(ctx, tc.user.ID)
+		if err != nil {
+			t.Fatalf("ListVisible: %v", err)
+		}
+		if got := roomNames(rooms); !equalStrings(got, tc.want) {
+			t.Errorf("ListVisible(%s) = %v, want %v", tc.user.Email, got, tc.want)
+		}
+	}
+}
+
+func testListDMs(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	alice := newUser(t, st, "alice@example.com")
+	bob := newUser(t, st, "bob@example.com")
+	carol := newUser(t, st, "carol@example.com")
+
+	withBob := newDM(t, st, baseTime, alice, bob)
+	withCarol := newDM(t, st, baseTime.Add(time.Minute), alice, carol)
+	newDM(t, st, baseTime.Add(2*time.Minute), bob, carol)
+	newRoom(t, st, models.Room{Name: "general", Type: models.RoomTypePublic, Members: []models.RoomMember{member(alice, models.RoomRoleMember)}})
+
+	rooms, err := st.Rooms.ListDMs(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("ListDMs: %v", err)
+	}
+	if got, want := roomNames(rooms), []string{withCarol.Name, withBob.Name}; !equalStrings(got, want) {
+		t.Fatalf("ListDMs = %v, want %v (newest activity first)", got, want)
+	}
+
+	// Touch ดัน DM ที่มีข้อความใหม่ขึ้นไปบนสุด
+	if err := st.Rooms.Touch(ctx, withBob.ID, baseTime.Add(time.Hour)); err != nil {
+		t.Fatalf("Touch: %v", err)
+	}
+	rooms, err = st.Rooms.ListDMs(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("ListDMs: %v", err)
+	}
+	if got, want := roomNames(rooms), []string{withBob.Name, withCarol.Name}; !equalStrings(got, want) {
+		t.Fatalf("ListDMs after Touch = %v, want %v", got, want)
+	}
+}
+
+func testDMByKey(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	alice := newUser(t, st, "alice@example.com")
+	bob := newUser(t, st, "bob@example.com")
+	dm := newDM(t, st, baseTime, alice, bob)
+
+	got, err := st.Rooms.DMByKey(ctx, models.DMKey([]primitive.ObjectID{bob.ID, alice.ID}))
+	if err != nil || got.ID != dm.ID {
+		t.Fatalf("DMByKey = %v, %v; want %v", got.ID, err, dm.ID)
+	}
+
+	// คนกลุ่มเดียวกันมี DM ได้ห้องเดียว
+	again := models.Room{Name: dm.Name + "-again", Type: models.RoomTypeDM, DMKey: dm.DMKey, Members: []models.RoomMember{}, CreatedAt: baseTime}
+	if err := st.Rooms.Create(ctx, &again); !errors.Is(err, store.ErrConflict) {
+		t.Fatalf("duplicate DM key: got %v, want ErrConflict", err)
+	}
+
+	// ห้องธรรมดาที่ชื่อเหมือน key ไม่ถูกนับเป็น DM
+	carol := newUser(t, st, "carol@example.com")
+	key := models.DMKey([]primitive.ObjectID{alice.ID, carol.ID})
+	newRoom(t, st, models.Room{Name: key, Type: models.RoomTypePublic})
+	if _, err := st.Rooms.DMByKey(ctx, key); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("DMByKey for a non-DM room: got %v, want ErrNotFound", err)
+	}
+}
+
+func testMessagePaging(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	alice := newUser(t, st, "alice@example.com")
+	room := newRoom(t, st, models.Room{Name: "general", Type: models.RoomTypePublic})
+	other := newRoom(t, st, models.Room{Name: "other", Type: models.RoomTypePublic})
+
+	// m2 กับ m3 มีเวลาเท่ากัน ลำดับต้องตัดสินด้วย _id
+	var msgs []models.Message
+	for i, offset := range []time.Duration{0, time.Second, 2 * time.Second, 2 * time.Second, 3 * time.Second} {
+		msgs = append(msgs, newMessage(t, st, room.ID, alice, fmt.Sprintf("m%d", i), baseTime.Add(offset), nil))
+	}
+	newMessage(t, st, other.ID, alice, "elsewhere", baseTime.Add(time.Second), nil)
+	newMessage(t, st, room.ID, alice, "reply", baseTime.Add(4*time.Second), &msgs[0].ID)
+
+	page := func(q store.MessageQuery) ([]string, bool) {
+		t.Helper()
+		got, more, err := st.Messages.ListByRoom(ctx, room.ID, q)
+		if err != nil {
+			t.Fatalf("ListByRoom: %v", err)
+		}
+		return contents(got), more
+	}
+
+	for _, tc := range []struct {
+		name     string
+		q        store.MessageQuery
+		want     []string
+		wantMore bool
+	}{
+		{"latest", store.MessageQuery{Limit: 2}, []string{"m3", "m4"}, true},
+		{"before", store.MessageQuery{Limit: 2, Before: store.CursorOf(msgs[3])}, []string{"m1", "m2"}, true},
+		{"before oldest page", store.MessageQuery{Limit: 2, Before: store.CursorOf(msgs[1])}, []string{"m0"}, false},
+		{"after", store.MessageQuery{Limit: 2, After: store.CursorOf(msgs[1])}, []string{"m2", "m3"}, true},
+		{"after newest page", store.MessageQuery{Limit: 2, After: store.CursorOf(msgs[3])}, []string{"m4"}, false},
+		{"all", store.MessageQuery{}, []string{"m0", "m1", "m2", "m3", "m4"}, false},
+		{"thread", store.MessageQuery{ParentID: &msgs[0].ID}, []string{"reply"}, false},
+	} {
+		got, more := page(tc.q)
+		if !equalStrings(got, tc.want) || more != tc.wantMore {
+			t.Errorf("%s: got %v more=%v, want %v more=%v", tc.name, got, more, tc.want, tc.wantMore)
+		}
+	}
+}
+
+func testEditAndSoftDelete(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	alice := newUser(t, st, "alice@example.com")
+	room := newRoom(t, st, models.Room{Name: "general", Type: models.RoomTypePublic})
+	m := newMessage(t, st, room.ID, alice, "first", baseTime, nil)
+
+	edited, err := st.Messages.Edit(ctx, room.ID, m.ID, "second", baseTime.Add(time.Second), true)
+	if err != nil {
+		t.Fatalf("Edit: %v", err)
+	}
+	if edited.Content != "second" || edited.EditedAt == nil || len(edited.Edits) != 1 || edited.Edits[0].Content != "first" {
+		t.Fatalf("Edit = %+v, want content second with one prior edit", edited)
+	}
+	if _, err := st.Messages.Edit(ctx, primitive.NewObjectID(), m.ID, "x", baseTime, true); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Edit in another room: got %v, want ErrNotFound", err)
+	}
+
+	deleted, err := st.Messages.SoftDelete(ctx, room.ID, m.ID, alice.ID, baseTime.Add(2*time.Second))
+	if err != nil {
+		t.Fatalf("SoftDelete: %v", err)
+	}
+	if !deleted.IsDeleted() || deleted.Content != "" || len(deleted.Edits) != 0 || deleted.DeletedBy == nil || *deleted.DeletedBy != alice.ID {
+		t.Fatalf("SoftDelete = %+v, want an empty tombstone deleted by alice", deleted)
+	}
+
+	// tombstone ยังอยู่ในประวัติ แต่แก้หรือลบซ้ำไม่ได้
+	list, _, err := st.Messages.ListByRoom(ctx, room.ID, store.MessageQuery{})
+	if err != nil || len(list) != 1 || !list[0].IsDeleted() {
+		t.Fatalf("ListByRoom after delete = %+v, %v; want one tombstone", list, err)
+	}
+	if _, err := st.Messages.Edit(ctx, room.ID, m.ID, "again", baseTime, true); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Edit deleted: got %v, want ErrNotFound", err)
+	}
+	if _, err := st.Messages.SoftDelete(ctx, room.ID, m.ID, alice.ID, baseTime); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("SoftDelete twice: got %v, want ErrNotFound", err)
+	}
+}
+
+func testReplies(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	alice := newUser(t, st, "alice@example.com")
+	room := newRoom(t, st, models.Room{Name: "general", Type: models.RoomTypePublic})
+	parent := newMessage(t, st, room.ID, alice, "parent", baseTime, nil)
+
+	var replies []models.Message
+	for i := 1; i <= 2; i++ {
+		r := newMessage(t, st, room.ID, alice, "reply", baseTime.Add(time.Duration(i)*time.Minute), &parent.ID)
+		if _, err := st.Messages.AddReply(ctx, room.ID, parent.ID, r.CreatedAt); err != nil {
+			t.Fatalf("AddReply: %v", err)
+		}
+		replies = append(replies, r)
+	}
+
+	// ลบ reply ล่าสุด เวลา reply ล่าสุดต้องถอยกลับไปที่ reply ที่ยังเหลือ
+	if _, err := st.Messages.SoftDelete(ctx, room.ID, replies[1].ID, alice.ID, baseTime.Add(time.Hour)); err != nil {
+		t.Fatalf("SoftDelete: %v", err)
+	}
+	got, err := st.Messages.RemoveReply(ctx, room.ID, parent.ID)
+	if err != nil {
+		t.Fatalf("RemoveReply: %v", err)
+	}
+	if got.ReplyCount != 1 || got.LastReplyAt == nil || !got.LastReplyAt.Equal(replies[0].CreatedAt) {
+		t.Fatalf("after removing newest reply: count=%d last=%v, want 1 at %v", got.ReplyCount, got.LastReplyAt, replies[0].CreatedAt)
+	}
+
+	if _, err := st.Messages.SoftDelete(ctx, room.ID, replies[0].ID, alice.ID, baseTime.Add(time.Hour)); err != nil {
+		t.Fatalf("SoftDelete: %v", err)
+	}
+	got, err = st.Messages.RemoveReply(ctx, room.ID, parent.ID)
+	if err != nil {
+		t.Fatalf("RemoveReply: %v", err)
+	}
+	if got.ReplyCount != 0 || got.LastReplyAt != nil {
+		t.Fatalf("after removing every reply: count=%d last=%v, want 0 and nil", got.ReplyCount, got.LastReplyAt)
+	}
+	if _, err := st.Messages.RemoveReply(ctx, room.ID, parent.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("RemoveReply below zero: got %v, want ErrNotFound", err)
+	}
+}
+
+func testInvitationReopen(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	alice := newUser(t, st, "alice@example.com")
+	room := newRoom(t, st, models.Room{Name: "staff", Type: models.RoomTypePrivate})
+	inv := models.Invitation{RoomID: room.ID, RoomName: room.Name, InviteeID: alice.ID, InviterID: primitive.NewObjectID(), Status: models.InvitePending, CreatedAt: baseTime}
+	if err := st.Invitations.Create(ctx, &inv); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := st.Invitations.Reopen(ctx, inv.ID); !errors.Is(err, store.ErrConflict) {
+		t.Fatalf("Reopen pending: got %v, want ErrConflict", err)
+	}
+	if err := st.Invitations.Respond(ctx, inv.ID, models.InviteAccepted); err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+	if err := st.Invitations.Respond(ctx, inv.ID, models.InviteAccepted); !errors.Is(err, store.ErrConflict) {
+		t.Fatalf("Respond twice: got %v, want ErrConflict", err)
+	}
+	if err := st.Invitations.Reopen(ctx, inv.ID); err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+	got, err := st.Invitations.ByID(ctx, inv.ID)
+	if err != nil || got.Status != models.InvitePending || got.RespondedAt != nil {
+		t.Fatalf("after Reopen = %+v, %v; want pending with no response time", got, err)
+	}
+}
+
+func testInviteLinkRelease(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	room := newRoom(t, st, models.Room{Name: "staff", Type: models.RoomTypePrivate})
+	link := models.InviteLink{RoomID: room.ID, Code: "code-1", CreatedBy: primitive.NewObjectID(), MaxUses: 1, CreatedAt: baseTime}
+	if err := st.InviteLinks.Create(ctx, &link); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := st.InviteLinks.Release(ctx, link.Code); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Release unused: got %v, want ErrNotFound", err)
+	}
+	now := baseTime.Add(time.Minute)
+	if _, err := st.InviteLinks.Use(ctx, link.Code, now); err != nil {
+		t.Fatalf("Use: %v", err)
+	}
+	if _, err := st.InviteLinks.Use(ctx, link.Code, now); !errors.Is(err, store.ErrConflict) {
+		t.Fatalf("Use past max_uses: got %v, want ErrConflict", err)
+	}
+	if err := st.InviteLinks.Release(ctx, link.Code); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, err := st.InviteLinks.Use(ctx, link.Code, now); err != nil {
+		t.Fatalf("Use after Release: %v", err)
+	}
+}
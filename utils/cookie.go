@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"mychat-auth/config"
+)
+
+const (
+	accessCookieName  = "token"
+	refreshCookieName = "refresh_token"
+	csrfCookieName    = "csrf_token"
+	hostPrefix        = "__Host-"
+)
+
+// CookiePolicy เป็นจุดเดียวที่สร้าง auth cookie ทุกตัว
+// ค่า Secure, Domain, SameSite, ชื่อ cookie และอายุ มาจาก config และอายุของ token
+type CookiePolicy struct {
+	Secure     bool
+	Domain     string
+	SameSite   http.SameSite
+	HostPrefix bool
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// NewCookiePolicy คำนวณนโยบาย cookie จาก config
+// production บังคับ Secure, SameSite=None ก็บังคับ Secure (browser ไม่รับถ้าไม่ Secure)
+// และ __Host- prefix ต้อง Secure กับไม่มี Domain ตาม spec
+func NewCookiePolicy(cfg *config.Config, accessTTL, refreshTTL time.Duration) *CookiePolicy {
+	p := &CookiePolicy{
+		Secure:     cfg.Cookie.Secure || cfg.IsProduction(),
+		Domain:     cfg.Cookie.Domain,
+		SameSite:   parseSameSite(cfg.Cookie.SameSite),
+		HostPrefix: cfg.Cookie.HostPrefix,
+		AccessTTL:  accessTTL,
+		RefreshTTL: refreshTTL,
+	}
+	if p.SameSite == http.SameSiteNoneMode {
+		p.Secure = true
+	}
+	if p.HostPrefix {
+		p.Secure = true
+		p.Domain = ""
+	}
+	return p
+}
+
+func parseSameSite(v string) http.SameSite {
+	switch strings.ToLower(v) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
+
+// AccessCookieName คืนชื่อ cookie ของ access token (รวม prefix ถ้ามี)
+func (p *CookiePolicy) AccessCookieName() string {
+	return p.name(accessCookieName)
+}
+
+// RefreshCookieName คืนชื่อ cookie ของ refresh token (รวม prefix ถ้ามี)
+func (p *CookiePolicy) RefreshCookieName() string {
+	return p.name(refreshCookieName)
+}
+
+// CSRFCookieName คืนชื่อ cookie ของ CSRF token
+// cookie นี้เป็น host-only เสมอ จึงใช้ __Host- ได้ทุกครั้งที่ Secure ไม่ต้องรอ COOKIE_HOST_PREFIX
+func (p *CookiePolicy) CSRFCookieName() string {
+	if p.Secure {
+		return hostPrefix + csrfCookieName
+	}
+	return csrfCookieName
+}
+
+func (p *CookiePolicy) name(base string) string {
+	if p.HostPrefix {
+		return hostPrefix + base
+	}
+	return base
+}
+
+// AccessToken อ่าน access token จาก cookie ของ request คืน "" ถ้าไม่มี
+func (p *CookiePolicy) AccessToken(r *http.Request) string {
+	c, err := r.Cookie(p.AccessCookieName())
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// RefreshToken อ่าน refresh token จาก cookie ของ request คืน "" ถ้าไม่มี
+func (p *CookiePolicy) RefreshToken(r *http.Request) string {
+	c, err := r.Cookie(p.RefreshCookieName())
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// CSRFToken อ่าน CSRF token จาก cookie ของ request คืน "" ถ้าไม่มี
+func (p *CookiePolicy) CSRFToken(r *http.Request) string {
+	c, err := r.Cookie(p.CSRFCookieName())
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// SetCSRFCookie ตั้ง CSRF cookie ให้อายุเท่า refresh token
+// ไม่เป็น HttpOnly เพราะ SPA ต้องอ่านค่าไปใส่ header X-CSRF-Token
+// ไม่ใส่ Domain ไม่ว่าตั้ง COOKIE_DOMAIN ไว้อย่างไร subdomain อื่นจะได้อ่านหรือวาง cookie นี้ไม่ได้
+func (p *CookiePolicy) SetCSRFCookie(w http.ResponseWriter, token string) {
+	c := p.cookie(p.CSRFCookieName(), token, p.RefreshTTL)
+	c.HttpOnly = false
+	c.Domain = ""
+	http.SetCookie(w, c)
+
+	// ลบ cookie รุ่นก่อนที่เคยตั้งพร้อม Domain ไม่งั้น browser ส่งมาคู่กันแล้วอาจอ่านได้ตัวเก่า
+	if p.Domain != "" {
+		old := p.cookie(csrfCookieName, "", 0)
+		old.HttpOnly = false
+		old.MaxAge = -1
+		old.Expires = time.Unix(0, 0)
+		http.SetCookie(w, old)
+	}
+}
+
+// SetAuthCookies ตั้งทั้ง access และ refresh cookie หลัง login
+func (p *CookiePolicy) SetAuthCookies(w http.ResponseWriter, accessToken, refreshToken string) {
+	http.SetCookie(w, p.cookie(p.AccessCookieName(), accessToken, p.AccessTTL))
+	http.SetCookie(w, p.cookie(p.RefreshCookieName(), refreshToken, p.RefreshTTL))
+}
+
+// SetAccessCookie ตั้งเฉพาะ access cookie ใหม่ตอน refresh
+func (p *CookiePolicy) SetAccessCookie(w http.ResponseWriter, accessToken string) {
+	http.SetCookie(w, p.cookie(p.AccessCookieName(), accessToken, p.AccessTTL))
+}
+
+// ClearAuthCookies ลบ auth cookie ทั้งสองตัว (ต้องใช้ attribute เดียวกับตอนตั้ง browser ถึงจะลบให้)
+func (p *CookiePolicy) ClearAuthCookies(w http.ResponseWriter) {
+	for _, name := range []string{p.AccessCookieName(), p.RefreshCookieName()} {
+		c := p.cookie(name, "", 0)
+		c.MaxAge = -1
+		c.Expires = time.Unix(0, 0)
+		http.SetCookie(w, c)
+	}
+}
+
+func (p *CookiePolicy) cookie(name, value string, ttl time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   p.Domain,
+		Expires:  time.Now().Add(ttl),
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   p.Secure,
+		SameSite: p.SameSite,
+	}
+}
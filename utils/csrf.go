@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// CSRFSigner ออกและตรวจ CSRF token แบบ signed double-submit
+// token = nonce.HMAC(subject, nonce) โดย subject คือ user ID ของ session ("" ถ้ายังไม่ login)
+// token ที่ขอมาจาก session อื่นหรือก่อน login จึงใช้กับ session นี้ไม่ได้ แม้จะวาง cookie ได้ก็ตาม
+type CSRFSigner struct {
+	key []byte
+}
+
+// NewCSRFSigner สร้าง signer จาก CSRF_SECRET ถ้าว่าง (ใช้ได้นอก production เท่านั้น ดู config.Validate)
+// จะสุ่ม key ใหม่ทุกครั้งที่ start token เดิมจึงใช้ไม่ได้หลัง restart และใช้ข้าม replica ไม่ได้
+// ไม่ derive จาก JWT_SECRET เพราะ secret นั้นถูก rotate ออกจาก keyring ได้แต่ยังอาจหลุดไปแล้ว
+func NewCSRFSigner(secret string) (*CSRFSigner, error) {
+	if secret == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return &CSRFSigner{key: key}, nil
+	}
+	return &CSRFSigner{key: []byte(secret)}, nil
+}
+
+// NewToken สุ่ม token ใหม่ที่ผูกกับ subject
+func (s *CSRFSigner) NewToken(subject string) (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	n := base64.RawURLEncoding.EncodeToString(nonce)
+	return n + "." + s.sign(subject, n), nil
+}
+
+// Valid ตรวจว่า token ถูกเซ็นโดย service นี้ให้ subject นี้จริง
+func (s *CSRFSigner) Valid(token, subject string) bool {
+	nonce, sig, ok := strings.Cut(token, ".")
+	if !ok || nonce == "" {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.sign(subject, nonce)))
+}
+
+// Matches ตรวจว่า token จาก header ตรงกับ token ใน cookie และเป็น token ของ subject นี้
+func (s *CSRFSigner) Matches(headerToken, cookieToken, subject string) bool {
+	if headerToken == "" || cookieToken == "" {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(headerToken), []byte(cookieToken)) != 1 {
+		return false
+	}
+	return s.Valid(cookieToken, subject)
+}
+
+func (s *CSRFSigner) sign(subject, nonce string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(subject))
+	mac.Write([]byte{0})
+	mac.Write([]byte(nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CSRFSubject คืน user ID ของ session จาก refresh หรือ access cookie ที่ยังใช้ได้ คืน "" ถ้ายังไม่ login
+// ดู refresh ก่อนเพราะอยู่นานกว่า access ที่หมดอายุแล้วจะได้ยัง POST /auth/refresh ได้
+func CSRFSubject(r *http.Request, cookies *CookiePolicy, jwt *JWTManager) string {
+	for _, token := range []string{cookies.RefreshToken(r), cookies.AccessToken(r)} {
+		if token == "" {
+			continue
+		}
+		if claims, err := jwt.ValidateToken(token); err == nil {
+			return claims.UserID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCSRFSignerMatches(t *testing.T) {
+	s, err := NewCSRFSigner("csrf-secret")
+	if err != nil {
+		t.Fatalf("NewCSRFSigner: %v", err)
+	}
+	token, err := s.NewToken("user-1")
+	if err != nil {
+		t.Fatalf("NewToken: %v", err)
+	}
+	other, _ := s.NewToken("user-1")
+	if other == token {
+		t.Fatal("NewToken returned the same token twice")
+	}
+
+	if !s.Matches(token, token, "user-1") {
+		t.Fatal("Matches rejected a token signed for the same subject")
+	}
+	for _, tc := range []struct {
+		name                 string
+		header, cookie, subj string
+	}{
+		{"another subject", token, token, "user-2"},
+		{"anonymous subject", token, token, ""},
+		{"header differs from cookie", other, token, "user-1"},
+		{"missing header", "", token, "user-1"},
+		{"missing cookie", token, "", "user-1"},
+		{"no signature", "nonce", "nonce", "user-1"},
+		{"tampered signature", token + "x", token + "x", "user-1"},
+	} {
+		if s.Matches(tc.header, tc.cookie, tc.subj) {
+			t.Errorf("%s: Matches accepted the token", tc.name)
+		}
+	}
+
+	// token ของ secret อื่นใช้ไม่ได้ แม้ nonce เดียวกัน
+	s2, _ := NewCSRFSigner("another-secret")
+	if s2.Valid(token, "user-1") {
+		t.Fatal("Valid accepted a token signed with another secret")
+	}
+	nonce, _, _ := strings.Cut(token, ".")
+	if forged := nonce + "." + s2.sign("user-1", nonce); s.Valid(forged, "user-1") {
+		t.Fatal("Valid accepted a forged signature")
+	}
+}
+
+func TestCSRFSignerRandomKey(t *testing.T) {
+	a, err := NewCSRFSigner("")
+	if err != nil {
+		t.Fatalf("NewCSRFSigner: %v", err)
+	}
+	b, _ := NewCSRFSigner("")
+	token, _ := a.NewToken("")
+	if !a.Valid(token, "") {
+		t.Fatal("Valid rejected its own token")
+	}
+	// ไม่ตั้ง secret แต่ละ process สุ่ม key ของตัวเอง
+	if b.Valid(token, "") {
+		t.Fatal("two signers without a secret share a key")
+	}
+}
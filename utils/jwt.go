@@ -1,10 +1,16 @@
 package utils
 
 import (
+	"context"
 	"errors"
-	"os"
+	"log/slog"
+	"sync"
 	"time"
 
+	"mychat-auth/metrics"
+	"mychat-auth/models"
+	"mychat-auth/store"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -17,58 +23,185 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-// GenerateToken สร้าง JWT token สำหรับผู้ใช้คนหนึ่ง
-func GenerateTokens(userID, email, role, imageURL string) (accessToken string, refreshToken string, err error) {
-	secret := os.Getenv("JWT_SECRET")
+// JWTManager ออกและตรวจ token ด้วย secret และอายุที่ได้มาจาก config
+// ถ้ามี keyring (ดู SetKeys) จะเซ็นด้วย key ล่าสุดที่ active แล้วใส่ "kid" ใน header
+// token ที่ไม่มี kid (ออกก่อนมี keyring) ตรวจด้วย JWT_SECRET ได้จนกว่า key แรกใน keyring จะ active
+// หลังจากนั้น JWT_SECRET ใช้ไม่ได้อีก คนที่ได้ JWT_SECRET ไปจึงเซ็น token เองต่อไม่ได้หลัง rotate
+type JWTManager struct {
+	secret     []byte
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
 
-	// Access Token: อายุสั้น
-	accessExpire := time.Now().Add(15 * time.Minute)
-	accessClaims := Claims{
-		UserID:   userID,
-		Email:    email,
-		Role:     role,
-		ImageURL: imageURL,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(accessExpire),
-		},
+	mu   sync.RWMutex
+	keys []models.SigningKey // เรียงตาม ActiveAt จากเก่าไปใหม่
+}
+
+var (
+	errUnknownKey       = errors.New("unknown signing key")
+	errLegacyKeyRetired = errors.New("token without kid after the keyring took over")
+)
+
+func NewJWTManager(secret string, accessTTL, refreshTTL time.Duration) *JWTManager {
+	return &JWTManager{
+		secret:     []byte(secret),
+		AccessTTL:  accessTTL,
+		RefreshTTL: refreshTTL,
+	}
+}
+
+// Ready บอกว่ามี key สำหรับเซ็น token แล้ว ใช้ตรวจ readiness
+func (m *JWTManager) Ready() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.secret) > 0 || len(m.keys) > 0
+}
+
+// SetKeys แทนที่ keyring ทั้งชุด keys ต้องเรียงตาม ActiveAt (ตามที่ store.KeyStore.List คืน)
+func (m *JWTManager) SetKeys(keys []models.SigningKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = append([]models.SigningKey(nil), keys...)
+}
+
+// LoadKeys อ่าน keyring จาก store แล้วถอดรหัส secret ด้วย kc มาใช้
+func (m *JWTManager) LoadKeys(ctx context.Context, ks store.KeyStore, kc *KeyCipher) error {
+	keys, err := ks.List(ctx)
+	if err != nil {
+		return err
+	}
+	for i, k := range keys {
+		if keys[i], err = kc.Open(k); err != nil {
+			return err
+		}
+		if !k.Sealed() {
+			slog.Warn("⚠️ Signing key is stored unencrypted, run \"keys rotate\" to encrypt it", "kid", k.ID)
+		}
+	}
+	m.SetKeys(keys)
+	return nil
+}
+
+// WatchKeys โหลด keyring ใหม่ทุก interval จน ctx ถูกยกเลิก เพื่อให้ทุก replica เห็น key ที่ rotate
+// ผ่าน CLI ก่อนถึง ActiveAt ของมัน
+func (m *JWTManager) WatchKeys(ctx context.Context, ks store.KeyStore, kc *KeyCipher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			loadCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			if err := m.LoadKeys(loadCtx, ks, kc); err != nil {
+				slog.Warn("⚠️ Failed to reload signing keys", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// signingKey คืน key ล่าสุดที่ active แล้ว ถ้ายังไม่มีใช้ JWT_SECRET โดยไม่มี kid
+func (m *JWTManager) signingKey(now time.Time) (kid string, secret []byte) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		if !m.keys[i].ActiveAt.After(now) {
+			return m.keys[i].ID, m.keys[i].Secret
+		}
 	}
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessToken, err = at.SignedString([]byte(secret))
+	return "", m.secret
+}
+
+// verifyKey หา secret ตาม kid ใน header ของ token key ที่ยังไม่ถึง ActiveAt ก็ใช้ตรวจได้
+// เผื่อ replica อื่นนาฬิกาเดินเร็วกว่าเล็กน้อย
+func (m *JWTManager) verifyKey(token *jwt.Token) (interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if len(m.secret) == 0 {
+			return nil, errUnknownKey
+		}
+		if len(m.keys) > 0 && !m.keys[0].ActiveAt.After(time.Now()) {
+			return nil, errLegacyKeyRetired
+		}
+		return m.secret, nil
+	}
+	for _, k := range m.keys {
+		if k.ID == kid {
+			return k.Secret, nil
+		}
+	}
+	return nil, errUnknownKey
+}
+
+// GenerateTokens สร้าง access token (อายุสั้น) และ refresh token (อายุยาว) สำหรับผู้ใช้คนหนึ่ง
+func (m *JWTManager) GenerateTokens(userID, email, role, imageURL string) (accessToken string, refreshToken string, err error) {
+	accessToken, err = m.sign(userID, email, role, imageURL, m.AccessTTL)
 	if err != nil {
 		return
 	}
+	refreshToken, err = m.sign(userID, email, role, imageURL, m.RefreshTTL)
+	return
+}
 
-	// Refresh Token: อายุยาว
-	refreshExpire := time.Now().Add(7 * 24 * time.Hour)
-	refreshClaims := Claims{
+func (m *JWTManager) sign(userID, email, role, imageURL string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := Claims{
 		UserID:   userID,
 		Email:    email,
 		Role:     role,
 		ImageURL: imageURL,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(refreshExpire),
+			// iat ใช้ตัดสิน token ที่ออกก่อน "sessions revoke"
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 		},
 	}
-	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshToken, err = rt.SignedString([]byte(secret))
-	return
+	kid, secret := m.signingKey(now)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	return token.SignedString(secret)
 }
 
 // ValidateToken ถอดรหัสและตรวจสอบ JWT token
-func ValidateToken(tokenStr string) (*Claims, error) {
-	secret := os.Getenv("JWT_SECRET")
-
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+func (m *JWTManager) ValidateToken(tokenStr string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, m.verifyKey, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil {
+		metrics.TokenValidationFailures.WithLabelValues(tokenErrorReason(err)).Inc()
 		return nil, err
 	}
 
 	claims, ok := token.Claims.(*Claims)
 	if !ok || !token.Valid {
+		metrics.TokenValidationFailures.WithLabelValues("invalid").Inc()
 		return nil, errors.New("invalid token")
 	}
 
 	return claims, nil
 }
+
+// tokenErrorReason จัดกลุ่ม error จาก jwt ให้เป็น label ที่จำนวนจำกัด
+func tokenErrorReason(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "expired"
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return "malformed"
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return "bad_signature"
+	case errors.Is(err, errUnknownKey):
+		return "unknown_key"
+	case errors.Is(err, errLegacyKeyRetired):
+		return "legacy_key"
+	default:
+		return "invalid"
+	}
+}
+
+// TokenMissing นับกรณี request ไม่มี token มาเลย
+func TokenMissing() {
+	metrics.TokenValidationFailures.WithLabelValues("missing").Inc()
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mychat-auth/models"
+	"mychat-auth/store"
+)
+
+func newTestJWT() *JWTManager {
+	return NewJWTManager("legacy-secret", 15*time.Minute, time.Hour)
+}
+
+func TestLegacySecretUntilKeyringActive(t *testing.T) {
+	m := newTestJWT()
+	legacy, _, err := m.GenerateTokens("u1", "a@example.com", "member", "")
+	if err != nil {
+		t.Fatalf("GenerateTokens: %v", err)
+	}
+	if _, err := m.ValidateToken(legacy); err != nil {
+		t.Fatalf("kid-less token before any keyring key: %v", err)
+	}
+
+	// key ที่ยังไม่ถึง ActiveAt ยังไม่ปิด JWT_SECRET
+	m.SetKeys([]models.SigningKey{{ID: "k1", Secret: []byte("key-one"), ActiveAt: time.Now().Add(time.Hour)}})
+	if _, err := m.ValidateToken(legacy); err != nil {
+		t.Fatalf("kid-less token while the first key is pending: %v", err)
+	}
+
+	m.SetKeys([]models.SigningKey{{ID: "k1", Secret: []byte("key-one"), ActiveAt: time.Now().Add(-time.Second)}})
+	if _, err := m.ValidateToken(legacy); err == nil {
+		t.Fatal("kid-less token accepted after the keyring took over")
+	}
+
+	// token ใหม่เซ็นด้วย key ใน keyring และยังตรวจผ่าน
+	current, _, err := m.GenerateTokens("u1", "a@example.com", "member", "")
+	if err != nil {
+		t.Fatalf("GenerateTokens: %v", err)
+	}
+	claims, err := m.ValidateToken(current)
+	if err != nil || claims.UserID != "u1" {
+		t.Fatalf("keyring token: %v, %v", claims, err)
+	}
+}
+
+func TestUnknownKidRejected(t *testing.T) {
+	signer := newTestJWT()
+	signer.SetKeys([]models.SigningKey{{ID: "other", Secret: []byte("other-secret"), ActiveAt: time.Now().Add(-time.Minute)}})
+	token, _, err := signer.GenerateTokens("u1", "a@example.com", "member", "")
+	if err != nil {
+		t.Fatalf("GenerateTokens: %v", err)
+	}
+	if _, err := newTestJWT().ValidateToken(token); err == nil {
+		t.Fatal("token with an unknown kid was accepted")
+	}
+}
+
+func TestLoadKeysDecrypts(t *testing.T) {
+	ctx := context.Background()
+	ks := store.NewMemory().Keys
+	kc := NewKeyCipher("keyring-secret")
+	sealed, err := kc.Seal(models.SigningKey{ID: "k1", Secret: []byte("key-one"), ActiveAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if err := ks.Create(ctx, sealed); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := newTestJWT().LoadKeys(ctx, ks, nil); err == nil {
+		t.Fatal("LoadKeys without JWT_KEYRING_SECRET succeeded on an encrypted key")
+	}
+	m := newTestJWT()
+	if err := m.LoadKeys(ctx, ks, kc); err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+	token, _, err := m.GenerateTokens("u1", "a@example.com", "member", "")
+	if err != nil {
+		t.Fatalf("GenerateTokens: %v", err)
+	}
+	if _, err := m.ValidateToken(token); err != nil {
+		t.Fatalf("token signed with a loaded key: %v", err)
+	}
+}
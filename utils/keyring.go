@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"mychat-auth/models"
+)
+
+// ErrKeyringSecretMissing คือมี signing key ที่เข้ารหัสไว้แต่ไม่ได้ตั้ง JWT_KEYRING_SECRET
+var ErrKeyringSecretMissing = errors.New("JWT_KEYRING_SECRET is required to use the signing keyring")
+
+// KeyCipher เข้ารหัส secret ของ signing key ด้วย AES-256-GCM ก่อนเก็บลง database
+// key ได้จาก JWT_KEYRING_SECRET ซึ่งไม่ได้อยู่ใน database คนที่ได้ dump ของ signing_keys ไปจึงเซ็น token เองไม่ได้
+type KeyCipher struct {
+	aead cipher.AEAD
+}
+
+// NewKeyCipher คืน nil ถ้า secret ว่าง method ของ nil KeyCipher คืน ErrKeyringSecretMissing
+func NewKeyCipher(secret string) *KeyCipher {
+	if secret == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte("keyring:" + secret))
+	block, _ := aes.NewCipher(sum[:]) // key ยาว 32 byte เสมอ ไม่มีทาง error
+	aead, _ := cipher.NewGCM(block)
+	return &KeyCipher{aead: aead}
+}
+
+// Seal เข้ารหัส k.Secret ลง SealedSecret แล้วล้างช่อง secret แบบไม่เข้ารหัส
+// ใช้ kid เป็น additional data จึงเอา SealedSecret ของ key หนึ่งไปแปะให้อีก key ไม่ได้
+func (c *KeyCipher) Seal(k models.SigningKey) (models.SigningKey, error) {
+	if c == nil {
+		return k, ErrKeyringSecretMissing
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return k, err
+	}
+	k.SealedSecret = c.aead.Seal(nonce, nonce, k.Secret, []byte(k.ID))
+	k.Secret, k.PlainSecret = nil, nil
+	return k, nil
+}
+
+// Open คืน key ที่มี Secret พร้อมใช้ key รุ่นก่อนที่เก็บ secret ไว้ตรง ๆ ใช้ได้โดยไม่ต้องมี KeyCipher
+func (c *KeyCipher) Open(k models.SigningKey) (models.SigningKey, error) {
+	if len(k.SealedSecret) == 0 {
+		k.Secret = k.PlainSecret
+		return k, nil
+	}
+	if c == nil {
+		return k, ErrKeyringSecretMissing
+	}
+	n := c.aead.NonceSize()
+	if len(k.SealedSecret) < n {
+		return k, fmt.Errorf("signing key %s: sealed secret is too short", k.ID)
+	}
+	secret, err := c.aead.Open(nil, k.SealedSecret[:n], k.SealedSecret[n:], []byte(k.ID))
+	if err != nil {
+		return k, fmt.Errorf("signing key %s: cannot decrypt, is JWT_KEYRING_SECRET correct? %w", k.ID, err)
+	}
+	k.Secret = secret
+	return k, nil
+}
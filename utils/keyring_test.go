@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"mychat-auth/models"
+)
+
+func TestKeyCipherRoundTrip(t *testing.T) {
+	kc := NewKeyCipher("keyring-secret")
+	key := models.SigningKey{ID: "kid-1", Secret: []byte("signing-secret"), ActiveAt: time.Now()}
+
+	sealed, err := kc.Seal(key)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if !sealed.Sealed() || sealed.Secret != nil || bytes.Contains(sealed.SealedSecret, key.Secret) {
+		t.Fatalf("Seal = %+v, want only an encrypted secret", sealed)
+	}
+
+	opened, err := kc.Open(sealed)
+	if err != nil || !bytes.Equal(opened.Secret, key.Secret) {
+		t.Fatalf("Open = %q, %v; want the original secret", opened.Secret, err)
+	}
+
+	// secret ของ key หนึ่งเอาไปแปะให้อีก kid ไม่ได้
+	moved := sealed
+	moved.ID = "kid-2"
+	if _, err := kc.Open(moved); err == nil {
+		t.Fatal("Open accepted a sealed secret under another kid")
+	}
+	if _, err := NewKeyCipher("wrong-secret").Open(sealed); err == nil {
+		t.Fatal("Open accepted the wrong keyring secret")
+	}
+}
+
+func TestKeyCipherWithoutSecret(t *testing.T) {
+	kc := NewKeyCipher("")
+	if kc != nil {
+		t.Fatal("NewKeyCipher(\"\") should return nil")
+	}
+	if _, err := kc.Seal(models.SigningKey{ID: "k", Secret: []byte("s")}); !errors.Is(err, ErrKeyringSecretMissing) {
+		t.Fatalf("Seal without secret: got %v, want ErrKeyringSecretMissing", err)
+	}
+	if _, err := kc.Open(models.SigningKey{ID: "k", SealedSecret: []byte("x")}); !errors.Is(err, ErrKeyringSecretMissing) {
+		t.Fatalf("Open sealed without secret: got %v, want ErrKeyringSecretMissing", err)
+	}
+
+	// key รุ่นก่อนที่ยังไม่เข้ารหัสใช้ได้แม้ไม่มี secret
+	legacy, err := kc.Open(models.SigningKey{ID: "k", PlainSecret: []byte("plain")})
+	if err != nil || string(legacy.Secret) != "plain" {
+		t.Fatalf("Open plaintext key = %q, %v; want plain", legacy.Secret, err)
+	}
+}
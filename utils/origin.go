@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OriginPolicy คือ allowlist ของ origin ที่ใช้ร่วมกันทั้ง CORS, CSRF และ WebSocket upgrade
+// รองรับทั้งแบบตรงตัว (https://chat.paodev.xyz) และ wildcard subdomain (https://*.paodev.xyz)
+type OriginPolicy struct {
+	exact     map[string]bool
+	wildcards []wildcardOrigin
+}
+
+type wildcardOrigin struct {
+	scheme string
+	suffix string // เช่น ".paodev.xyz" หรือ ".paodev.xyz:8443"
+}
+
+// NewOriginPolicy แปลงรายการ origin จาก config คืน error ถ้ามีตัวไหนรูปแบบผิด
+func NewOriginPolicy(origins []string) (*OriginPolicy, error) {
+	p := &OriginPolicy{exact: map[string]bool{}}
+	for _, raw := range origins {
+		o := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(raw), "/"))
+		if o == "" {
+			continue
+		}
+
+		scheme, host, ok := strings.Cut(o, "://")
+		if !ok || (scheme != "http" && scheme != "https") || host == "" || strings.ContainsAny(host, "/?#") {
+			return nil, fmt.Errorf("invalid allowed origin %q: expected scheme://host[:port]", raw)
+		}
+
+		if strings.HasPrefix(host, "*.") {
+			p.wildcards = append(p.wildcards, wildcardOrigin{scheme: scheme, suffix: host[1:]})
+			continue
+		}
+		if strings.Contains(host, "*") {
+			return nil, fmt.Errorf("invalid allowed origin %q: wildcard must be the left-most label", raw)
+		}
+		p.exact[o] = true
+	}
+	return p, nil
+}
+
+// Allowed บอกว่า origin นี้อยู่ใน allowlist หรือไม่
+func (p *OriginPolicy) Allowed(origin string) bool {
+	o := strings.ToLower(origin)
+	if p.exact[o] {
+		return true
+	}
+
+	scheme, host, ok := strings.Cut(o, "://")
+	if !ok {
+		return false
+	}
+	for _, w := range p.wildcards {
+		// ต้องมี label อย่างน้อยหนึ่งตัวหน้า suffix: *.paodev.xyz ไม่รวม paodev.xyz เอง
+		if scheme == w.scheme && strings.HasSuffix(host, w.suffix) && len(host) > len(w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowRequest ใช้เป็น CheckOrigin ของ WebSocket ได้ตรง ๆ
+// ไม่มี Origin (client ที่ไม่ใช่ browser) หรือ same-origin ถือว่าผ่าน
+func (p *OriginPolicy) AllowRequest(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	return p.SameOriginOrAllowed(r, origin)
+}
+
+// SameOriginOrAllowed ตรวจ origin ที่ได้มา (จาก Origin หรือ Referer) กับ host ของ request และ allowlist
+func (p *OriginPolicy) SameOriginOrAllowed(r *http.Request, origin string) bool {
+	if origin == "null" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return p.Allowed(u.Scheme + "://" + u.Host)
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginPolicyAllowed(t *testing.T) {
+	p, err := NewOriginPolicy([]string{"https://chat.example.com/", "https://*.example.org", "http://*.dev.test:8443"})
+	if err != nil {
+		t.Fatalf("NewOriginPolicy: %v", err)
+	}
+	for origin, want := range map[string]bool{
+		"https://chat.example.com":          true,
+		"HTTPS://CHAT.EXAMPLE.COM":          true,
+		"http://chat.example.com":           false,
+		"https://other.example.com":         false,
+		"https://a.example.org":             true,
+		"https://a.b.example.org":           true,
+		"https://example.org":               false, // wildcard ต้องมี subdomain
+		"http://a.example.org":              false,
+		"https://a.example.org:8443":        false,
+		"https://evilexample.org":           false,
+		"https://a.example.org.evil.com":    false,
+		"http://app.dev.test:8443":          true,
+		"http://app.dev.test":               false,
+		"https://chat.example.com.evil.com": false,
+	} {
+		if got := p.Allowed(origin); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestNewOriginPolicyRejectsInvalid(t *testing.T) {
+	for _, origin := range []string{"chat.example.com", "ftp://chat.example.com", "https://", "https://a.*.example.com", "https://chat.example.com/path"} {
+		if _, err := NewOriginPolicy([]string{origin}); err == nil {
+			t.Errorf("NewOriginPolicy(%q) accepted an invalid origin", origin)
+		}
+	}
+}
+
+func TestSameOriginOrAllowed(t *testing.T) {
+	p, _ := NewOriginPolicy([]string{"https://*.example.org"})
+	r := httptest.NewRequest("POST", "https://api.example.com/login", nil)
+
+	for origin, want := range map[string]bool{
+		"https://api.example.com":              true, // same origin
+		"https://api.example.com/app/page?x=1": true, // Referer เต็ม URL
+		"https://a.example.org":                true,
+		"https://evil.com":                     false,
+		"https://api.example.com.evil.com":     false,
+		"null":                                 false,
+		"not a url":                            false,
+	} {
+		if got := p.SameOriginOrAllowed(r, origin); got != want {
+			t.Errorf("SameOriginOrAllowed(%q) = %v, want %v", origin, got, want)
+		}
+	}
+
+	// ไม่มี Origin คือ client ที่ไม่ใช่ browser
+	if !p.AllowRequest(r) {
+		t.Error("AllowRequest rejected a request without Origin")
+	}
+	r.Header.Set("Origin", "https://evil.com")
+	if p.AllowRequest(r) {
+		t.Error("AllowRequest accepted a disallowed Origin")
+	}
+}
@@ -2,41 +2,48 @@ package utils
 
 import (
 	"context"
-	"fmt"
-	"os"
-	"time"
+	"errors"
+	"log/slog"
 
+	"mychat-auth/metrics"
+
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
 
-var ctx = context.Background()
-
 var RedisClient *redis.Client
 
-func InitRedis() {
-
-	url := os.Getenv("REDIS_URL") // จาก docker-compose
-	fmt.Println("🔧 REDIS_URL:", url)
-	RedisClient = redis.NewClient(&redis.Options{
-		Addr: url,
+// InitRedis สร้าง client แล้ว ping เพื่อยืนยันว่าเชื่อมได้ (redis.NewClient เองไม่ได้ต่อ server)
+func InitRedis(c context.Context, addr string) error {
+	client := redis.NewClient(&redis.Options{
+		Addr: addr,
 	})
+	client.AddHook(metrics.RedisHook{})
+	if err := redisotel.InstrumentTracing(client); err != nil {
+		client.Close()
+		return err
+	}
+	if err := client.Ping(c).Err(); err != nil {
+		client.Close()
+		return err
+	}
+	RedisClient = client
+	slog.Info("✅ Connected to Redis", "redis_url", addr)
+	return nil
 }
 
-func IsTokenBlacklisted(token string) (bool, error) {
-	_, err := RedisClient.Get(ctx, "blacklist:"+token).Result()
-	if err == redis.Nil {
-		return false, nil // ยังไม่ถูก block
-	}
-	if err != nil {
-		return false, err
+// PingRedis ใช้ตรวจ readiness
+func PingRedis(c context.Context) error {
+	if RedisClient == nil {
+		return errors.New("redis client not initialized")
 	}
-	return true, nil // เจอ → แปลว่าเคย logout แล้ว
+	return RedisClient.Ping(c).Err()
 }
 
-func BlacklistToken(token string, exp time.Time) error {
-	ttl := time.Until(exp)
-	if ttl <= 0 {
-		ttl = time.Hour // fallback กันไว้ 1 ชม.
+// CloseRedis ปิด connection ของ Redis ใช้ตอน shutdown
+func CloseRedis() error {
+	if RedisClient == nil {
+		return nil
 	}
-	return RedisClient.Set(ctx, "blacklist:"+token, "1", ttl).Err()
+	return RedisClient.Close()
 }
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RetryPolicy กำหนดการลองใหม่แบบ exponential backoff ตอนเชื่อม dependency ครั้งแรก
+type RetryPolicy struct {
+	Attempts       int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Retry เรียก fn จนสำเร็จหรือครบจำนวนครั้ง รอเพิ่มเป็นเท่าตัวระหว่างรอบ (ไม่เกิน MaxBackoff)
+// คืน error สุดท้ายถ้าไม่สำเร็จเลย
+func Retry(ctx context.Context, name string, p RetryPolicy, fn func(context.Context) error) error {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := p.InitialBackoff
+
+	var err error
+	for i := 1; i <= attempts; i++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+		if i == attempts {
+			break
+		}
+
+		slog.Warn("⏳ Dependency not ready, retrying", "dependency", name, "attempt", i, "of", attempts, "backoff", backoff, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+	return err
+}
@@ -2,67 +2,54 @@ package utils
 
 import (
 	"context"
-	"log"
+	"errors"
 	"time"
 
-	"mychat-auth/database"
 	"mychat-auth/models"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mychat-auth/store"
 )
 
-func SeedAdminUser() {
-	adminEmail := "admin@admin.com"
-	adminRole := "admin"
-	adminPassword := "123123"
-	adminAvatar := "https://cdn.example.com/avatars/admin.png"
-
+// SeedAdminUser สร้าง admin จากอีเมลและรหัสผ่านที่ได้จาก "mychat-auth seed"
+// คืน user ที่มีอยู่แล้วหรือที่สร้างใหม่ และ created บอกว่าสร้างใหม่หรือไม่
+func SeedAdminUser(ctx context.Context, users store.UserStore, email, password string) (user models.User, created bool, err error) {
 	// ตรวจสอบว่ามี admin อยู่แล้วหรือยัง
-	var existing models.User
-	err := database.UserCollection.FindOne(context.TODO(), bson.M{"email": adminEmail}).Decode(&existing)
+	user, err = users.ByEmail(ctx, email)
 	if err == nil {
-		log.Println("Admin already exists, skip seeding")
-		return
+		return user, false, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return user, false, err
 	}
 
-	hashed, _ := HashPassword(adminPassword)
-	newAdmin := models.User{
-		ID:        primitive.NewObjectID(),
-		Email:     adminEmail,
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return user, false, err
+	}
+	user = models.User{
+		Email:     email,
 		Password:  hashed,
-		Role:      adminRole,
-		ImageURL:  adminAvatar,
+		Role:      "admin",
 		CreatedAt: time.Now(),
 	}
-
-	_, err = database.UserCollection.InsertOne(context.TODO(), newAdmin)
-	if err != nil {
-		log.Println("Failed to seed admin:", err)
-	} else {
-		log.Println("Admin user seeded successfully")
+	if err := users.Create(ctx, &user); err != nil {
+		return user, false, err
 	}
+	return user, true, nil
 }
 
-func SeedRoom() {
-	var existing models.Room
-	err := database.RoomCollection.FindOne(context.TODO(), bson.M{"name": "general"}).Decode(&existing)
-	if err == nil {
-		log.Println("Room 'general' already exists, skip seeding")
-		return
-	}
-
+// SeedRoom สร้างห้อง public ชื่อ name โดยมี owner เป็นเจ้าของ ถ้ามีห้องชื่อนี้แล้วคืน created=false
+func SeedRoom(ctx context.Context, rooms store.RoomStore, name string, owner models.User) (created bool, err error) {
 	room := models.Room{
-		Name:      "general",
-		Type:      "public",
-		Members:   []models.SafeUser{},
+		Name:      name,
+		Type:      models.RoomTypePublic,
+		OwnerID:   owner.ID,
+		Members:   []models.RoomMember{{SafeUser: owner.ToSafeUser(), Role: models.RoomRoleOwner}},
 		CreatedAt: time.Now(),
 	}
 
-	_, err = database.RoomCollection.InsertOne(context.TODO(), room)
-	if err != nil {
-		log.Println("Failed to seed room:", err)
-	} else {
-		log.Println("Room 'general' seeded successfully")
+	err = rooms.Create(ctx, &room)
+	if errors.Is(err, store.ErrConflict) {
+		return false, nil
 	}
+	return err == nil, err
 }
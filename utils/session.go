@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"mychat-auth/metrics"
+	"mychat-auth/store"
+)
+
+// RevokeUserSessions เพิกถอน token ทุกตัวของ user ที่ออกมาจนถึงตอนนี้ (ทั้ง access และ refresh)
+// ใช้ตอน "sessions revoke", reset password และ disable user
+func (m *JWTManager) RevokeUserSessions(ctx context.Context, sessions store.SessionStore, userID string) error {
+	// iat ละเอียดแค่วินาที ปัดขึ้นเพื่อให้ token ที่ออกในวินาทีเดียวกันถูกเพิกถอนด้วย
+	before := time.Now().Truncate(time.Second).Add(time.Second)
+	return sessions.RevokeUser(ctx, userID, before, before.Add(m.RefreshTTL))
+}
+
+// SessionRevoked บอกว่า token นี้ออกก่อนเวลาที่ user ถูกเพิกถอน session ทั้งหมดหรือไม่
+// token เก่าที่ไม่มี iat ถือว่าถูกเพิกถอนถ้ามีการเพิกถอนอยู่
+func SessionRevoked(ctx context.Context, sessions store.SessionStore, claims *Claims) (bool, error) {
+	before, err := sessions.RevokedBefore(ctx, claims.UserID)
+	if err != nil || before.IsZero() {
+		return false, err
+	}
+	if claims.IssuedAt != nil && !claims.IssuedAt.Time.Before(before) {
+		return false, nil
+	}
+	metrics.TokenValidationFailures.WithLabelValues("revoked").Inc()
+	return true, nil
+}